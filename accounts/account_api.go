@@ -0,0 +1,183 @@
+package accounts
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"sketch-to-ui-final-proj/ai"
+	"sketch-to-ui-final-proj/auth"
+	"sketch-to-ui-final-proj/utils/htmx"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultFreeGenerations is the daily number of generations with the shared key when
+// FREE_GENERATIONS_PER_DAY is not set.
+const DefaultFreeGenerations = 10
+
+// AccountHandler serves the account settings of the logged-in user
+type AccountHandler struct {
+	store   *AccountStore
+	keyring *Keyring
+}
+
+// SaveAPIKeyRequest is the API key form of the settings page
+type SaveAPIKeyRequest struct {
+	APIKey string `form:"api_key" binding:"required,max=512"`
+}
+
+// SetupAccounts registers the account settings routes and returns the Keyring that
+// picks the provider each user generates with. API keys are encrypted with a key
+// derived from API_KEY_SECRET, which is required.
+// FREE_GENERATIONS_PER_DAY sets the quota of users without their own key.
+func SetupAccounts(router *gin.Engine, db *sql.DB, providerName string, sharedProvider ai.LLMProvider, client *http.Client) (*Keyring, error) {
+	// The secret is not shared with sessions: rotating the session secret must not
+	// make the stored keys unreadable. Keys stored while the session secret was used
+	// are read by setting API_KEY_SECRET to that secret.
+	secret := os.Getenv("API_KEY_SECRET")
+	if secret == "" {
+		return nil, errors.New("API_KEY_SECRET is not set; it encrypts the API keys users store")
+	}
+	cipher, err := NewKeyCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	freeGenerations := DefaultFreeGenerations
+	if value := os.Getenv("FREE_GENERATIONS_PER_DAY"); value != "" {
+		freeGenerations, err = strconv.Atoi(value)
+		if err != nil || freeGenerations < 0 {
+			return nil, fmt.Errorf("FREE_GENERATIONS_PER_DAY must be a non-negative number, got %q", value)
+		}
+	}
+	if providerName == "" {
+		providerName = ai.ProviderOpenRouter
+	}
+	slog.Info("Setting up accounts", "provider", providerName, "free_generations", freeGenerations)
+
+	store := NewAccountStore(db)
+	keyring := NewKeyring(store, cipher, providerName, sharedProvider, client, freeGenerations)
+
+	handler := &AccountHandler{store: store, keyring: keyring}
+	handler.RegisterRoutes(router)
+
+	return keyring, nil
+}
+
+// RenderSettings renders the account settings page with the user's key and quota
+func (h *AccountHandler) RenderSettings(c *gin.Context) {
+	userID, exists := auth.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	key, err := h.store.GetAPIKey(c.Request.Context(), userID)
+	if err != nil && !errors.Is(err, ErrNoAPIKey) {
+		slog.ErrorContext(c.Request.Context(), "Failed to get API key", "user_id", userID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load account settings"})
+		return
+	}
+
+	used, err := h.store.FreeGenerationsUsed(c.Request.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to get free generation usage", "user_id", userID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load account settings"})
+		return
+	}
+
+	c.HTML(http.StatusOK, "account-settings.html", gin.H{
+		"Provider":        h.keyring.providerName,
+		"UsesAPIKey":      ai.UsesAPIKey(h.keyring.providerName),
+		"Key":             key,
+		"KeyMismatch":     key != nil && key.Provider != h.keyring.providerName,
+		"FreeGenerations": h.keyring.freeGenerations,
+		"FreeUsed":        min(used, h.keyring.freeGenerations),
+	})
+}
+
+// SaveAPIKey handles POST requests that store the user's own API key
+func (h *AccountHandler) SaveAPIKey(c *gin.Context) {
+	userID, exists := auth.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req SaveAPIKeyRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload", "details": err.Error()})
+		return
+	}
+	apiKey := strings.TrimSpace(req.APIKey)
+	if apiKey == "" || strings.ContainsAny(apiKey, " \t\r\n") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The API key must not contain spaces"})
+		return
+	}
+
+	encrypted, err := h.keyring.cipher.Encrypt(apiKey, userID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to encrypt API key", "user_id", userID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save API key"})
+		return
+	}
+
+	key := StoredKey{UserID: userID, Provider: h.keyring.providerName, EncryptedKey: encrypted, Hint: keyHint(apiKey)}
+	if err := h.store.SaveAPIKey(c.Request.Context(), key); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to save API key", "user_id", userID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save API key"})
+		return
+	}
+
+	h.reloadSettings(c, "Your API Key Was Saved")
+}
+
+// DeleteAPIKey handles DELETE requests that remove the user's own API key
+func (h *AccountHandler) DeleteAPIKey(c *gin.Context) {
+	userID, exists := auth.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := h.store.DeleteAPIKey(c.Request.Context(), userID); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to delete API key", "user_id", userID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove API key"})
+		return
+	}
+
+	h.reloadSettings(c, "Your API Key Was Removed")
+}
+
+// reloadSettings sends the browser back to the settings page with a toast
+func (h *AccountHandler) reloadSettings(c *gin.Context, message string) {
+	location := map[string]interface{}{
+		"path":   "/account/settings",
+		"target": "#content",
+	}
+	locationJSON, err := json.Marshal(location)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal HX-Location"})
+		return
+	}
+	htmx.TriggerToast(c, htmx.InfoLevel, message)
+	c.Header("HX-Location", string(locationJSON))
+	c.Status(http.StatusOK)
+}
+
+// RegisterRoutes registers the account settings routes
+func (h *AccountHandler) RegisterRoutes(router *gin.Engine) {
+	accountGroup := router.Group("/account")
+	accountGroup.Use(auth.AuthRequiredMiddleware())
+
+	accountGroup.GET("/settings", h.RenderSettings)
+	accountGroup.POST("/api-key", h.SaveAPIKey)
+	accountGroup.DELETE("/api-key", h.DeleteAPIKey)
+}
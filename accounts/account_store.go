@@ -0,0 +1,139 @@
+package accounts
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"sketch-to-ui-final-proj/tracing"
+)
+
+// ErrNoAPIKey is returned when a user has not stored an API key.
+var ErrNoAPIKey = errors.New("no API key stored")
+
+// StoredKey is a user's encrypted API key.
+type StoredKey struct {
+	UserID       int
+	Provider     string
+	EncryptedKey []byte
+	Hint         string
+	UpdatedAt    time.Time
+}
+
+// AccountStore persists the API keys and free generation usage of users.
+type AccountStore struct {
+	db *sql.DB
+}
+
+func NewAccountStore(db *sql.DB) *AccountStore {
+	return &AccountStore{
+		db: db,
+	}
+}
+
+// startSpan starts a client span for a single store operation.
+func (as *AccountStore) startSpan(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "AccountStore."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation", operation),
+		),
+	)
+}
+
+// SaveAPIKey stores the encrypted key of a user, replacing any key stored before
+func (as *AccountStore) SaveAPIKey(ctx context.Context, key StoredKey) (err error) {
+	ctx, span := as.startSpan(ctx, "SaveAPIKey")
+	defer func() { tracing.End(span, err) }()
+
+	sqlQuery := `
+		INSERT INTO user_api_keys (user_id, provider, encrypted_key, key_hint)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE
+		SET provider = EXCLUDED.provider, encrypted_key = EXCLUDED.encrypted_key,
+			key_hint = EXCLUDED.key_hint, updated_at = CURRENT_TIMESTAMP`
+
+	if _, err = as.db.ExecContext(ctx, sqlQuery, key.UserID, key.Provider, key.EncryptedKey, key.Hint); err != nil {
+		return fmt.Errorf("failed to save API key: %w", err)
+	}
+	return nil
+}
+
+// GetAPIKey retrieves the encrypted key of a user, or ErrNoAPIKey
+func (as *AccountStore) GetAPIKey(ctx context.Context, userID int) (_ *StoredKey, err error) {
+	ctx, span := as.startSpan(ctx, "GetAPIKey")
+	defer func() { tracing.End(span, err) }()
+
+	key := StoredKey{UserID: userID}
+	err = as.db.QueryRowContext(ctx,
+		`SELECT provider, encrypted_key, key_hint, updated_at FROM user_api_keys WHERE user_id = $1`,
+		userID,
+	).Scan(&key.Provider, &key.EncryptedKey, &key.Hint, &key.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNoAPIKey
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	return &key, nil
+}
+
+// DeleteAPIKey removes the key of a user, if any
+func (as *AccountStore) DeleteAPIKey(ctx context.Context, userID int) (err error) {
+	ctx, span := as.startSpan(ctx, "DeleteAPIKey")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err = as.db.ExecContext(ctx, `DELETE FROM user_api_keys WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete API key: %w", err)
+	}
+	return nil
+}
+
+// UseFreeGeneration counts one generation with the shared key against today's quota
+// of a user. It reports false, without counting, when limit generations were
+// already made today.
+func (as *AccountStore) UseFreeGeneration(ctx context.Context, userID int, limit int) (_ bool, err error) {
+	ctx, span := as.startSpan(ctx, "UseFreeGeneration")
+	defer func() { tracing.End(span, err) }()
+
+	// The conditional update makes the check and the increment one atomic statement
+	sqlQuery := `
+		INSERT INTO free_generation_usage (user_id, day, generations)
+		VALUES ($1, CURRENT_DATE, 1)
+		ON CONFLICT (user_id, day) DO UPDATE
+		SET generations = free_generation_usage.generations + 1
+		WHERE free_generation_usage.generations < $2
+		RETURNING generations`
+
+	var generations int
+	err = as.db.QueryRowContext(ctx, sqlQuery, userID, limit).Scan(&generations)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to count free generation: %w", err)
+	}
+	return true, nil
+}
+
+// FreeGenerationsUsed returns how many generations a user made with the shared key today
+func (as *AccountStore) FreeGenerationsUsed(ctx context.Context, userID int) (_ int, err error) {
+	ctx, span := as.startSpan(ctx, "FreeGenerationsUsed")
+	defer func() { tracing.End(span, err) }()
+
+	var generations int
+	err = as.db.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(generations), 0) FROM free_generation_usage WHERE user_id = $1 AND day = CURRENT_DATE`,
+		userID,
+	).Scan(&generations)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get free generation usage: %w", err)
+	}
+	return generations, nil
+}
@@ -0,0 +1,79 @@
+// Package accounts keeps the account settings of each user: the provider API key a
+// user brings, stored encrypted, and the free quota of generations made with the
+// shared key.
+package accounts
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// keyInfo separates the API key encryption key from anything else derived from the
+// same server secret.
+const keyInfo = "sketch-to-ui user api keys v1"
+
+// KeyCipher encrypts API keys at rest with AES-256-GCM under a key derived from a
+// server secret. Each ciphertext is bound to its user, so a row copied to another
+// user does not decrypt.
+type KeyCipher struct {
+	aead cipher.AEAD
+}
+
+// NewKeyCipher derives the encryption key from secret with HKDF-SHA256.
+func NewKeyCipher(secret string) (*KeyCipher, error) {
+	if len(secret) < 16 {
+		return nil, errors.New("API key secret must be at least 16 characters")
+	}
+
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(secret), nil, []byte(keyInfo)), key); err != nil {
+		return nil, fmt.Errorf("failed to derive API key encryption key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return &KeyCipher{aead: aead}, nil
+}
+
+// Encrypt returns the nonce followed by the sealed apiKey of userID.
+func (k *KeyCipher) Encrypt(apiKey string, userID int) ([]byte, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return k.aead.Seal(nonce, nonce, []byte(apiKey), []byte(strconv.Itoa(userID))), nil
+}
+
+// Decrypt opens a key sealed by Encrypt for userID.
+func (k *KeyCipher) Decrypt(sealed []byte, userID int) (string, error) {
+	size := k.aead.NonceSize()
+	if len(sealed) < size {
+		return "", errors.New("encrypted API key is too short")
+	}
+	apiKey, err := k.aead.Open(nil, sealed[:size], sealed[size:], []byte(strconv.Itoa(userID)))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt API key: %w", err)
+	}
+	return string(apiKey), nil
+}
+
+// keyHint is the part of an API key shown back to its owner.
+func keyHint(apiKey string) string {
+	if len(apiKey) <= 8 {
+		return "…"
+	}
+	return "…" + apiKey[len(apiKey)-4:]
+}
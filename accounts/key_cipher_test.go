@@ -0,0 +1,62 @@
+package accounts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "a-server-secret-for-tests"
+
+func TestKeyCipherRoundTrip(t *testing.T) {
+	cipher, err := NewKeyCipher(testSecret)
+	require.NoError(t, err)
+
+	sealed, err := cipher.Encrypt("sk-or-v1-abcdef123456", 7)
+	require.NoError(t, err)
+	assert.NotContains(t, string(sealed), "abcdef123456")
+
+	apiKey, err := cipher.Decrypt(sealed, 7)
+	require.NoError(t, err)
+	assert.Equal(t, "sk-or-v1-abcdef123456", apiKey)
+}
+
+func TestKeyCipherUsesFreshNonces(t *testing.T) {
+	cipher, err := NewKeyCipher(testSecret)
+	require.NoError(t, err)
+
+	first, err := cipher.Encrypt("sk-same", 7)
+	require.NoError(t, err)
+	second, err := cipher.Encrypt("sk-same", 7)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+}
+
+func TestKeyCipherRejectsOtherUserAndSecret(t *testing.T) {
+	cipher, err := NewKeyCipher(testSecret)
+	require.NoError(t, err)
+	sealed, err := cipher.Encrypt("sk-or-v1-abcdef123456", 7)
+	require.NoError(t, err)
+
+	_, err = cipher.Decrypt(sealed, 8)
+	assert.Error(t, err, "a key copied to another user must not decrypt")
+
+	other, err := NewKeyCipher("another-server-secret")
+	require.NoError(t, err)
+	_, err = other.Decrypt(sealed, 7)
+	assert.Error(t, err)
+
+	_, err = cipher.Decrypt(sealed[:4], 7)
+	assert.Error(t, err)
+}
+
+func TestNewKeyCipherRequiresSecret(t *testing.T) {
+	_, err := NewKeyCipher("short")
+	assert.Error(t, err)
+}
+
+func TestKeyHint(t *testing.T) {
+	assert.Equal(t, "…3456", keyHint("sk-or-v1-abcdef123456"))
+	assert.Equal(t, "…", keyHint("short"))
+}
@@ -0,0 +1,113 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"sketch-to-ui-final-proj/ai"
+)
+
+// ErrFreeQuotaUsed is returned when a user without an API key has made all of
+// today's free generations.
+var ErrFreeQuotaUsed = errors.New("free generation quota used")
+
+// KeyStore holds the API keys and free generation usage the Keyring reads.
+// AccountStore implements it.
+type KeyStore interface {
+	GetAPIKey(ctx context.Context, userID int) (*StoredKey, error)
+	UseFreeGeneration(ctx context.Context, userID int, limit int) (bool, error)
+	FreeGenerationsUsed(ctx context.Context, userID int) (int, error)
+}
+
+// Charge counts a generation against the free quota of the user it was made for.
+// It is called once the generation succeeded, so failed generations do not use up
+// the quota.
+type Charge func(ctx context.Context) error
+
+// noCharge is the Charge of generations that do not use the shared key.
+func noCharge(context.Context) error { return nil }
+
+// Keyring picks the provider each user generates with: the user's own API key when
+// one is stored, otherwise the shared key within the user's free daily quota.
+type Keyring struct {
+	store           KeyStore
+	cipher          *KeyCipher
+	providerName    string
+	shared          ai.LLMProvider
+	client          *http.Client
+	freeGenerations int
+}
+
+// NewKeyring creates a Keyring for the configured provider. freeGenerations is the
+// number of generations per user and day made with the shared key.
+func NewKeyring(store KeyStore, cipher *KeyCipher, providerName string, shared ai.LLMProvider, client *http.Client, freeGenerations int) *Keyring {
+	return &Keyring{
+		store:           store,
+		cipher:          cipher,
+		providerName:    providerName,
+		shared:          shared,
+		client:          client,
+		freeGenerations: freeGenerations,
+	}
+}
+
+// ProviderFor returns the provider to generate for userID with, and the Charge to
+// call once the generation succeeded. Generations with the shared key fail with
+// ErrFreeQuotaUsed once the free quota is used up; they are only counted by Charge.
+func (k *Keyring) ProviderFor(ctx context.Context, userID int) (ai.LLMProvider, Charge, error) {
+	// A provider without API keys, like a local Ollama, costs nothing to share
+	if !ai.UsesAPIKey(k.providerName) {
+		return k.shared, noCharge, nil
+	}
+
+	apiKey, err := k.userKey(ctx, userID)
+	if err == nil {
+		provider, err := ai.NewProviderWithKey(k.providerName, apiKey, k.client)
+		return provider, noCharge, err
+	}
+	if !errors.Is(err, ErrNoAPIKey) {
+		return nil, nil, err
+	}
+
+	if k.freeGenerations <= 0 {
+		return nil, nil, ErrFreeQuotaUsed
+	}
+	used, err := k.store.FreeGenerationsUsed(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if used >= k.freeGenerations {
+		return nil, nil, ErrFreeQuotaUsed
+	}
+
+	charge := func(ctx context.Context) error {
+		// Concurrent generations may all have started within the quota; the ones
+		// saved after it ran out are not counted
+		ok, err := k.store.UseFreeGeneration(ctx, userID, k.freeGenerations)
+		if err == nil && !ok {
+			err = ErrFreeQuotaUsed
+		}
+		return err
+	}
+	return k.shared, charge, nil
+}
+
+// userKey returns the decrypted API key of userID for the configured provider.
+func (k *Keyring) userKey(ctx context.Context, userID int) (string, error) {
+	stored, err := k.store.GetAPIKey(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	// A key for another provider cannot authenticate with the configured one
+	if stored.Provider != k.providerName {
+		return "", ErrNoAPIKey
+	}
+
+	apiKey, err := k.cipher.Decrypt(stored.EncryptedKey, userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to read API key of user %d: %w", userID, err)
+	}
+	return apiKey, nil
+}
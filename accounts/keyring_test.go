@@ -0,0 +1,125 @@
+package accounts
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sketch-to-ui-final-proj/ai"
+)
+
+// memoryKeyStore is a KeyStore in memory.
+type memoryKeyStore struct {
+	keys map[int]*StoredKey
+	used map[int]int
+}
+
+func (m *memoryKeyStore) GetAPIKey(_ context.Context, userID int) (*StoredKey, error) {
+	if key, ok := m.keys[userID]; ok {
+		return key, nil
+	}
+	return nil, ErrNoAPIKey
+}
+
+func (m *memoryKeyStore) UseFreeGeneration(_ context.Context, userID int, limit int) (bool, error) {
+	if m.used[userID] >= limit {
+		return false, nil
+	}
+	m.used[userID]++
+	return true, nil
+}
+
+func (m *memoryKeyStore) FreeGenerationsUsed(_ context.Context, userID int) (int, error) {
+	return m.used[userID], nil
+}
+
+// sharedProvider stands in for the provider of the shared key.
+type sharedProvider struct{}
+
+func (sharedProvider) RequestChatCompletion(context.Context, []ai.Message, string, ai.CompletionOptions) (string, error) {
+	return "", nil
+}
+
+func newTestKeyring(t *testing.T, freeGenerations int) (*Keyring, *memoryKeyStore) {
+	cipher, err := NewKeyCipher(testSecret)
+	require.NoError(t, err)
+	store := &memoryKeyStore{keys: map[int]*StoredKey{}, used: map[int]int{}}
+	return NewKeyring(store, cipher, ai.ProviderOpenRouter, sharedProvider{}, nil, freeGenerations), store
+}
+
+func storeKey(t *testing.T, k *Keyring, store *memoryKeyStore, userID int, provider string, apiKey string) {
+	encrypted, err := k.cipher.Encrypt(apiKey, userID)
+	require.NoError(t, err)
+	store.keys[userID] = &StoredKey{UserID: userID, Provider: provider, EncryptedKey: encrypted}
+}
+
+func TestProviderForUsesOwnKey(t *testing.T) {
+	keyring, store := newTestKeyring(t, 1)
+	storeKey(t, keyring, store, 7, ai.ProviderOpenRouter, "sk-or-own-key")
+
+	provider, charge, err := keyring.ProviderFor(context.Background(), 7)
+	require.NoError(t, err)
+	openRouter, ok := provider.(*ai.OpenRouterProvider)
+	require.True(t, ok)
+	assert.Equal(t, "sk-or-own-key", openRouter.APIKey)
+
+	// Generations with the user's own key are not counted
+	require.NoError(t, charge(context.Background()))
+	assert.Zero(t, store.used[7])
+}
+
+func TestProviderForIgnoresKeyOfAnotherProvider(t *testing.T) {
+	keyring, store := newTestKeyring(t, 1)
+	storeKey(t, keyring, store, 7, ai.ProviderAnthropic, "sk-ant-key")
+
+	provider, _, err := keyring.ProviderFor(context.Background(), 7)
+	require.NoError(t, err)
+	assert.Equal(t, sharedProvider{}, provider)
+}
+
+func TestProviderForChargesFreeQuotaOnceSaved(t *testing.T) {
+	keyring, store := newTestKeyring(t, 2)
+	ctx := context.Background()
+
+	// A generation that is not saved is not counted
+	provider, _, err := keyring.ProviderFor(ctx, 7)
+	require.NoError(t, err)
+	assert.Equal(t, sharedProvider{}, provider)
+	assert.Zero(t, store.used[7])
+
+	for range 2 {
+		_, charge, err := keyring.ProviderFor(ctx, 7)
+		require.NoError(t, err)
+		require.NoError(t, charge(ctx))
+	}
+	assert.Equal(t, 2, store.used[7])
+
+	_, _, err = keyring.ProviderFor(ctx, 7)
+	assert.ErrorIs(t, err, ErrFreeQuotaUsed)
+	// Other users keep their quota
+	_, _, err = keyring.ProviderFor(ctx, 8)
+	assert.NoError(t, err)
+}
+
+func TestProviderForChargeAfterQuotaRanOut(t *testing.T) {
+	keyring, _ := newTestKeyring(t, 1)
+	ctx := context.Background()
+
+	// Both generations start within the quota; only the first one saved is counted
+	_, first, err := keyring.ProviderFor(ctx, 7)
+	require.NoError(t, err)
+	_, second, err := keyring.ProviderFor(ctx, 7)
+	require.NoError(t, err)
+
+	assert.NoError(t, first(ctx))
+	assert.ErrorIs(t, second(ctx), ErrFreeQuotaUsed)
+}
+
+func TestProviderForWithoutFreeQuota(t *testing.T) {
+	keyring, _ := newTestKeyring(t, 0)
+
+	_, _, err := keyring.ProviderFor(context.Background(), 7)
+	assert.ErrorIs(t, err, ErrFreeQuotaUsed)
+}
@@ -0,0 +1,109 @@
+package ai
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	agentPlanReply   = `{"elements":[{"type":"heading","text":"Sign in","location":"top"},{"type":"button","text":"Log in","location":"bottom"}]}`
+	agentBrokenReply = `{"components":[{"title":"Login","type":"Form","code":"<div><h1>Sign in</h1>"}]}`
+	agentFixedReply  = `{"components":[{"title":"Login","type":"Form","code":"<div><h1>Sign in</h1><button>Log in</button></div>"}]}`
+)
+
+// agentProvider answers each agent step by its system prompt. critiques are returned
+// in order, repeating the last one.
+func agentProvider(t *testing.T, fixReply string, critiques ...string) *FakeProvider {
+	prompts, err := Prompts(DefaultPromptVersion)
+	require.NoError(t, err)
+
+	generated := false
+	return &FakeProvider{Respond: func(messages []Message, modelID string) (string, error) {
+		switch messages[0].Text() {
+		case prompts.Plan:
+			return agentPlanReply, nil
+		case prompts.Critique:
+			reply := critiques[0]
+			if len(critiques) > 1 {
+				critiques = critiques[1:]
+			}
+			return reply, nil
+		default:
+			if !generated {
+				generated = true
+				return agentBrokenReply, nil
+			}
+			return fixReply, nil
+		}
+	}}
+}
+
+func stepNames(steps []AgentStep) []string {
+	names := make([]string, 0, len(steps))
+	for _, step := range steps {
+		names = append(names, step.Name)
+	}
+	return names
+}
+
+func TestAgentPipelineCritiquesAndFixes(t *testing.T) {
+	provider := agentProvider(t, agentFixedReply,
+		`{"missing":["button \"Log in\""],"problems":[],"done":false}`,
+		`{"missing":[],"problems":[],"done":true}`)
+
+	resp, err := GenerateUICode(context.Background(), "Build this", "data:image/png;base64,aGVsbG8=", provider, GenerationSettings{Pipeline: PipelineAgent})
+	require.NoError(t, err)
+	require.Len(t, resp.Components, 1)
+	assert.Contains(t, resp.Components[0].Code, "<button>Log in</button>")
+	assert.Equal(t, []string{"plan", "generate", "critique", "fix", "critique"}, stepNames(resp.Steps))
+	for _, step := range resp.Steps {
+		assert.Positive(t, step.Tokens)
+		assert.Empty(t, step.Error)
+	}
+
+	calls := provider.Calls()
+	require.Len(t, calls, 5)
+	assert.Contains(t, calls[1].Messages[1].Text(), `- button "Log in" (bottom)`)
+
+	critique := calls[2].Messages[1].Text()
+	assert.Contains(t, critique, `- heading "Sign in" (top)`)
+	assert.Contains(t, critique, "Login: unclosed <div>")
+
+	fix := calls[3].Messages[1].Text()
+	assert.Contains(t, fix, `<div><h1>Sign in</h1>`)
+	assert.Contains(t, fix, `- button "Log in"`)
+	assert.Contains(t, fix, "Login: unclosed <div>")
+	assert.NotEmpty(t, calls[3].Messages[1].Images())
+}
+
+func TestAgentPipelineStopsAtMaxSteps(t *testing.T) {
+	provider := agentProvider(t, agentBrokenReply, `{"missing":[],"problems":["still broken"],"done":false}`)
+
+	resp, err := GenerateUICode(context.Background(), "Build this", "data:image/png;base64,aGVsbG8=", provider, GenerationSettings{Pipeline: PipelineAgent, MaxSteps: 5})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"plan", "generate", "critique", "fix"}, stepNames(resp.Steps))
+}
+
+func TestAgentPipelineStopsAtTokenBudget(t *testing.T) {
+	provider := agentProvider(t, agentFixedReply, `{"missing":[],"problems":["still broken"],"done":false}`)
+
+	resp, err := GenerateUICode(context.Background(), "Build this", "data:image/png;base64,aGVsbG8=", provider, GenerationSettings{Pipeline: PipelineAgent, TokenBudget: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"plan", "generate"}, stepNames(resp.Steps))
+	assert.Equal(t, "<div><h1>Sign in</h1>", resp.Components[0].Code)
+}
+
+func TestAgentPipelineKeepsCodeWhenFixFails(t *testing.T) {
+	provider := agentProvider(t, "not json", `{"missing":["button"],"problems":[],"done":false}`)
+
+	resp, err := GenerateUICode(context.Background(), "Build this", "data:image/png;base64,aGVsbG8=", provider, GenerationSettings{Pipeline: PipelineAgent})
+	require.NoError(t, err)
+	assert.Equal(t, "<div><h1>Sign in</h1>", resp.Components[0].Code)
+
+	require.Len(t, resp.Steps, 4)
+	assert.Equal(t, "fix", resp.Steps[3].Name)
+	assert.Contains(t, resp.Steps[3].Error, "failed to parse response JSON")
+}
@@ -0,0 +1,141 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// anthropicVersion is the Messages API version sent with every request.
+const anthropicVersion = "2023-06-01"
+
+// AnthropicMaxTemperature is the highest temperature the Messages API accepts;
+// higher temperatures are sent as this one.
+const AnthropicMaxTemperature = 1.0
+
+// anthropicMaxTokens caps the response length; the Messages API requires a limit.
+const anthropicMaxTokens = 8192
+
+// AnthropicProvider implements LLMProvider using the Anthropic Messages API.
+type AnthropicProvider struct {
+	// APIKey is the authentication key for the Anthropic API
+	APIKey string
+
+	// BaseURL is the root URL for the API endpoints, e.g. https://api.anthropic.com
+	BaseURL string
+
+	// Client is a reusable HTTP client for making API requests
+	Client *http.Client
+}
+
+// NewAnthropicProvider creates a new instance of AnthropicProvider.
+func NewAnthropicProvider(apiKey string, baseURL string, client *http.Client) *AnthropicProvider {
+	return &AnthropicProvider{
+		APIKey:  apiKey,
+		BaseURL: baseURL,
+		Client:  client,
+	}
+}
+
+// RequestChatCompletion makes a synchronous call to the Messages API and returns a complete response.
+// The Messages API has no seed or response format, and routing preferences only apply
+// to OpenRouter; those options are ignored. Temperatures are clamped to
+// AnthropicMaxTemperature.
+func (p *AnthropicProvider) RequestChatCompletion(ctx context.Context, messages []Message, modelID string, opts CompletionOptions) (string, error) {
+	return instrumentCompletion(ctx, ProviderAnthropic, modelID, messages, func(ctx context.Context) (string, Usage, error) {
+		system, converted, err := toAnthropicMessages(messages)
+		if err != nil {
+			return "", Usage{}, err
+		}
+
+		payload := map[string]any{
+			"model":      modelID,
+			"max_tokens": anthropicMaxTokens,
+			"messages":   converted,
+		}
+		if system != "" {
+			payload["system"] = system
+		}
+		if opts.MaxTokens > 0 {
+			payload["max_tokens"] = opts.MaxTokens
+		}
+		if opts.Temperature != nil {
+			payload["temperature"] = min(*opts.Temperature, AnthropicMaxTemperature)
+		}
+		if opts.TopP != nil {
+			payload["top_p"] = *opts.TopP
+		}
+		if len(opts.Stop) > 0 {
+			payload["stop_sequences"] = opts.Stop
+		}
+
+		var result struct {
+			Content []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"content"`
+			Usage struct {
+				InputTokens  int `json:"input_tokens"`
+				OutputTokens int `json:"output_tokens"`
+			} `json:"usage"`
+		}
+
+		headers := map[string]string{
+			"x-api-key":         p.APIKey,
+			"anthropic-version": anthropicVersion,
+		}
+		url := fmt.Sprintf("%s/v1/messages", p.BaseURL)
+		if err := postJSON(ctx, p.Client, url, headers, payload, &result); err != nil {
+			return "", Usage{}, err
+		}
+
+		var text strings.Builder
+		for _, block := range result.Content {
+			if block.Type == "text" {
+				text.WriteString(block.Text)
+			}
+		}
+		if text.Len() == 0 {
+			return "", Usage{}, errors.New("no text content returned")
+		}
+
+		return text.String(), Usage{InputTokens: result.Usage.InputTokens, OutputTokens: result.Usage.OutputTokens}, nil
+	})
+}
+
+// toAnthropicMessages translates messages to the Messages API format. System
+// messages are lifted into the separate system prompt.
+func toAnthropicMessages(messages []Message) (string, []map[string]any, error) {
+	var system []string
+	out := make([]map[string]any, 0, len(messages))
+
+	for _, m := range messages {
+		if m.Role == RoleSystem {
+			system = append(system, m.Text())
+			continue
+		}
+
+		content := make([]map[string]any, 0, len(m.Parts))
+		for _, part := range m.Parts {
+			switch part.Type {
+			case PartText:
+				content = append(content, map[string]any{"type": "text", "text": part.Text})
+			case PartImage:
+				source := map[string]any{"type": "url", "url": part.ImageURL}
+				if strings.HasPrefix(part.ImageURL, "data:") {
+					mediaType, data, err := ParseDataURI(part.ImageURL)
+					if err != nil {
+						return "", nil, err
+					}
+					source = map[string]any{"type": "base64", "media_type": mediaType, "data": data}
+				}
+				content = append(content, map[string]any{"type": "image", "source": source})
+			}
+		}
+		out = append(out, map[string]any{"role": m.Role, "content": content})
+	}
+
+	return strings.Join(system, "\n\n"), out, nil
+}
@@ -0,0 +1,109 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"sketch-to-ui-final-proj/layout"
+)
+
+// MaxComponentDepth is the deepest component hierarchy accepted from the model:
+// page, section and component.
+const MaxComponentDepth = 3
+
+// ChildrenSlot marks where a page or section places its children. Without the
+// slot, the children follow the parent's own markup.
+const ChildrenSlot = "<!-- children -->"
+
+// checkHierarchy rejects component trees nested deeper than MaxComponentDepth.
+func checkHierarchy(components []UIComponentDTO, depth int) error {
+	if depth > MaxComponentDepth && len(components) > 0 {
+		return fmt.Errorf("components are nested deeper than %d levels", MaxComponentDepth)
+	}
+	for _, c := range components {
+		if err := checkHierarchy(c.Children, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ComposeCode builds the code of a page or section from its own markup and the
+// code of its children, in order.
+func ComposeCode(template string, children []string) string {
+	joined := strings.Join(children, "\n")
+	if strings.Contains(template, ChildrenSlot) {
+		return strings.Replace(template, ChildrenSlot, joined, 1)
+	}
+	if template == "" {
+		return joined
+	}
+	return template + "\n" + joined
+}
+
+// ComposedCode returns the code of the component with its children composed in, as
+// the app saves it.
+func (c UIComponentDTO) ComposedCode() string {
+	if len(c.Children) == 0 {
+		return c.Code
+	}
+	codes := make([]string, 0, len(c.Children))
+	for _, child := range c.Children {
+		codes = append(codes, child.ComposedCode())
+	}
+	return ComposeCode(c.Code, codes)
+}
+
+// PartRequest describes one part of a sketched page, or a whole sketched component,
+// that is generated again.
+type PartRequest struct {
+	Title string
+	Type  string
+	// PageTitle is empty when the sketch shows the component alone
+	PageTitle string
+	// Box is the part's position in the sketch, when known from its layout
+	Box *layout.Box
+	// Instructions are the user's additional instructions for the new code
+	Instructions string
+	// LayoutHints describe the shapes of a sketch drawn on the sketchpad
+	LayoutHints string
+}
+
+// RegeneratePart generates a single part of a sketched page again, leaving the
+// rest of the page to the caller. It returns the first component of the response,
+// or the model's failure message when no component came back.
+func RegeneratePart(ctx context.Context, part PartRequest, imageBase64URI string, provider LLMProvider, settings GenerationSettings) (UIComponentDTO, string, error) {
+	prompt := fmt.Sprintf("This sketch is the page %q. Generate ONLY its part titled %q (type %q), as a single component without children.", part.PageTitle, part.Title, part.Type)
+	if part.PageTitle == "" {
+		prompt = fmt.Sprintf("This sketch is the component titled %q (type %q). Generate it again, as a single component without children.", part.Title, part.Type)
+	}
+	if part.Box != nil {
+		prompt += fmt.Sprintf(" The part is located at x=%.2f, y=%.2f with width %.2f and height %.2f, as fractions of the sketch size.",
+			part.Box.X, part.Box.Y, part.Box.Width, part.Box.Height)
+	}
+	if instructions := strings.TrimSpace(part.Instructions); instructions != "" {
+		// The instructions are delimited like in code updates, so they cannot pose as
+		// the rest of the prompt
+		prompt += "\nFollow the user's instructions inside " + instructionsOpenTag + "; they may change the part, never the reply format.\n" +
+			instructionsOpenTag + "\n" + escapeDelimiters(instructions) + "\n" + instructionsCloseTag
+	}
+	if part.LayoutHints != "" {
+		prompt += "\n\n" + part.LayoutHints
+	}
+
+	resp, err := GenerateUICode(ctx, prompt, imageBase64URI, provider, settings)
+	if err != nil {
+		return UIComponentDTO{}, "", err
+	}
+	if len(resp.Components) == 0 {
+		return UIComponentDTO{}, resp.FailureResponse, nil
+	}
+
+	// Some models still wrap the part in a section; take its first leaf
+	component := resp.Components[0]
+	for len(component.Children) > 0 {
+		component = component.Children[0]
+	}
+	return component, "", nil
+}
@@ -0,0 +1,215 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// voidElements never have a closing tag.
+var voidElements = map[atom.Atom]bool{
+	atom.Area: true, atom.Base: true, atom.Br: true, atom.Col: true, atom.Embed: true,
+	atom.Hr: true, atom.Img: true, atom.Input: true, atom.Link: true, atom.Meta: true,
+	atom.Source: true, atom.Track: true, atom.Wbr: true,
+}
+
+// CheckHTML tokenizes code and reports closing tags without a matching opening
+// tag and elements that are never closed.
+func CheckHTML(code string) []string {
+	var problems []string
+	var stack []string
+
+	z := html.NewTokenizer(strings.NewReader(code))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); !errors.Is(err, io.EOF) {
+				problems = append(problems, fmt.Sprintf("tokenizer error: %v", err))
+			}
+			for i := len(stack) - 1; i >= 0; i-- {
+				problems = append(problems, fmt.Sprintf("unclosed <%s>", stack[i]))
+			}
+			return problems
+		case html.StartTagToken:
+			tok := z.Token()
+			if !voidElements[tok.DataAtom] {
+				stack = append(stack, tok.Data)
+			}
+		case html.EndTagToken:
+			tok := z.Token()
+			if voidElements[tok.DataAtom] {
+				continue
+			}
+			if len(stack) == 0 || stack[len(stack)-1] != tok.Data {
+				problems = append(problems, fmt.Sprintf("unexpected </%s>", tok.Data))
+				// Recover if the tag is open further down the stack
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == tok.Data {
+						for j := len(stack) - 1; j > i; j-- {
+							problems = append(problems, fmt.Sprintf("unclosed <%s>", stack[j]))
+						}
+						stack = stack[:i]
+						break
+					}
+				}
+				continue
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+// documentWrappers are the document level elements a component must not contain.
+var documentWrappers = map[atom.Atom]bool{atom.Html: true, atom.Head: true, atom.Body: true}
+
+// impliedEnd lists elements whose end tag may be left out before a sibling of the
+// same kind.
+var impliedEnd = map[atom.Atom]bool{
+	atom.Li: true, atom.P: true, atom.Option: true, atom.Dt: true, atom.Dd: true,
+	atom.Tr: true, atom.Td: true, atom.Th: true,
+}
+
+// VerifyHTML reports every problem that keeps code from being stored as a component:
+// empty output, the well-formedness problems of CheckHTML, duplicate IDs and
+// <!DOCTYPE>, <html>, <head> or <body> wrappers.
+func VerifyHTML(code string) []string {
+	if strings.TrimSpace(code) == "" {
+		return []string{"empty output"}
+	}
+
+	problems := CheckHTML(code)
+	ids := map[string]int{}
+	wrappers := map[string]bool{}
+
+	z := html.NewTokenizer(strings.NewReader(code))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		switch tt {
+		case html.DoctypeToken:
+			problems = append(problems, "stray <!DOCTYPE>")
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			if documentWrappers[tok.DataAtom] && !wrappers[tok.Data] {
+				wrappers[tok.Data] = true
+				problems = append(problems, fmt.Sprintf("stray <%s> wrapper", tok.Data))
+			}
+			if id := tokenAttr(tok, "id"); id != "" {
+				ids[id]++
+				if ids[id] == 2 {
+					problems = append(problems, fmt.Sprintf("duplicate id %q", id))
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// FixHTML corrects the problems of VerifyHTML that have a deterministic fix: wrappers
+// are removed, unexpected closing tags dropped, unclosed elements closed and
+// duplicate IDs renamed. It returns the fixed code and a description of each fix.
+// Empty output cannot be fixed here.
+func FixHTML(code string) (string, []string) {
+	var b strings.Builder
+	var fixes []string
+	var stack []string
+	ids := map[string]int{}
+	removed := map[string]bool{}
+
+	closeTo := func(n int) {
+		for j := len(stack) - 1; j >= n; j-- {
+			b.WriteString("</" + stack[j] + ">")
+			fixes = append(fixes, fmt.Sprintf("closed <%s>", stack[j]))
+		}
+		stack = stack[:n]
+	}
+
+	z := html.NewTokenizer(strings.NewReader(code))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		raw := string(z.Raw())
+
+		switch tt {
+		case html.DoctypeToken:
+			fixes = append(fixes, "removed <!DOCTYPE>")
+			continue
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			if documentWrappers[tok.DataAtom] {
+				if !removed[tok.Data] {
+					removed[tok.Data] = true
+					fixes = append(fixes, fmt.Sprintf("removed <%s> wrapper", tok.Data))
+				}
+				continue
+			}
+
+			for i, a := range tok.Attr {
+				if a.Key != "id" || a.Val == "" {
+					continue
+				}
+				ids[a.Val]++
+				if n := ids[a.Val]; n > 1 {
+					renamed := fmt.Sprintf("%s-%d", a.Val, n)
+					fixes = append(fixes, fmt.Sprintf("renamed duplicate id %q to %q", a.Val, renamed))
+					tok.Attr[i].Val = renamed
+					raw = tok.String()
+				}
+			}
+
+			if tt == html.StartTagToken && !voidElements[tok.DataAtom] {
+				if impliedEnd[tok.DataAtom] && len(stack) > 0 && stack[len(stack)-1] == tok.Data {
+					closeTo(len(stack) - 1)
+				}
+				stack = append(stack, tok.Data)
+			}
+
+		case html.EndTagToken:
+			tok := z.Token()
+			if documentWrappers[tok.DataAtom] {
+				continue
+			}
+			if voidElements[tok.DataAtom] {
+				break
+			}
+
+			open := -1
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i] == tok.Data {
+					open = i
+					break
+				}
+			}
+			if open < 0 {
+				fixes = append(fixes, fmt.Sprintf("removed unexpected </%s>", tok.Data))
+				continue
+			}
+			closeTo(open + 1)
+			stack = stack[:open]
+		}
+
+		b.WriteString(raw)
+	}
+
+	closeTo(0)
+	return b.String(), fixes
+}
+
+func tokenAttr(tok html.Token, key string) string {
+	for _, a := range tok.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
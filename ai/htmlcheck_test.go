@@ -0,0 +1,42 @@
+package ai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyHTML(t *testing.T) {
+	assert.Empty(t, VerifyHTML(`<style>.a{}</style><form><label for="e">Email</label><input id="e"><br></form>`))
+	assert.Equal(t, []string{"empty output"}, VerifyHTML(" \n"))
+
+	problems := VerifyHTML(`<!DOCTYPE html><html><body><div id="a"><p id="a">Hi</span></body></html>`)
+	assert.Contains(t, problems, "stray <!DOCTYPE>")
+	assert.Contains(t, problems, "stray <html> wrapper")
+	assert.Contains(t, problems, "stray <body> wrapper")
+	assert.Contains(t, problems, `duplicate id "a"`)
+	assert.Contains(t, problems, "unexpected </span>")
+}
+
+func TestFixHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want string
+	}{
+		{"valid code is unchanged", `<div class="x"><!-- children --><img src="a.png"></div>`, `<div class="x"><!-- children --><img src="a.png"></div>`},
+		{"wrappers are removed", "<!DOCTYPE html><html><head><style>p{}</style></head><body><p>Hi</p></body></html>", "<style>p{}</style><p>Hi</p>"},
+		{"unclosed elements are closed", "<section><div><p>Hi", "<section><div><p>Hi</p></div></section>"},
+		{"elements left open inside a closed parent are closed", "<ul><li>One<li>Two</ul>", "<ul><li>One</li><li>Two</li></ul>"},
+		{"unexpected closing tags are dropped", "<div>Hi</span></div></div>", "<div>Hi</div>"},
+		{"duplicate ids are renamed", `<input id="q"><input id="q">`, `<input id="q"><input id="q-2">`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixed, _ := FixHTML(tt.code)
+			assert.Equal(t, tt.want, fixed)
+			assert.Empty(t, VerifyHTML(fixed))
+		})
+	}
+}
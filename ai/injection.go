@@ -0,0 +1,105 @@
+package ai
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Delimiters that separate the user's instructions from the component code in
+// update requests. The update prompts tell the model to treat the code section as data.
+// Text-only generation wraps the description the same way.
+const (
+	instructionsOpenTag  = "<instructions>"
+	instructionsCloseTag = "</instructions>"
+	codeOpenTag          = "<component_code>"
+	codeCloseTag         = "</component_code>"
+	descriptionOpenTag   = "<description>"
+	descriptionCloseTag  = "</description>"
+)
+
+// removedCommentText replaces the body of a comment that reads like instructions to the model.
+const removedCommentText = "[removed: instruction-like comment]"
+
+var (
+	htmlCommentRe  = regexp.MustCompile(`(?s)<!--(.*?)-->`)
+	blockCommentRe = regexp.MustCompile(`(?s)/\*(.*?)\*/`)
+	// Line comments must not be preceded by ':' so URLs such as https://... are left alone
+	lineCommentRe = regexp.MustCompile(`(?m)(^|[^:"'\\/])//([^\n]*)`)
+
+	// delimiterRe matches opening or closing delimiter tags, so that neither the
+	// instructions nor the code can close their own section and open another one.
+	delimiterRe = regexp.MustCompile(`(?i)<(/?)(\s*)(instructions|component_code|description)\b`)
+)
+
+// injectionPatterns match text that addresses the model rather than a developer
+// reading the code.
+var injectionPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(ignore|disregard|forget|skip)\s+(all\s+|any\s+|the\s+|your\s+)*(previous|prior|above|earlier|preceding|original|system|user)\b`),
+	regexp.MustCompile(`(?i)\b(ignore|disregard|forget)\s+(all\s+|any\s+|the\s+|your\s+)*(instructions|rules|prompt)\b`),
+	regexp.MustCompile(`(?i)\b(new|updated|real|actual|hidden)\s+(instructions?|task|rules)\s*:`),
+	regexp.MustCompile(`(?i)\b(system|developer)\s+(prompt|message|instructions?)\b`),
+	regexp.MustCompile(`(?i)\b(note|message|instructions?)\s+(to|for)\s+(the\s+)?(ai|llm|assistant|model|language\s+model)\b`),
+	regexp.MustCompile(`(?i)\byou\s+(are\s+now|must\s+now|will\s+now|should\s+now)\b`),
+	regexp.MustCompile(`(?i)\b(act|behave|respond)\s+as\s+(an?\s+|the\s+)?(ai|assistant|model|system|admin|developer)\b`),
+	regexp.MustCompile(`(?i)\bpretend\s+(to\s+be|you\s+are)\b`),
+	regexp.MustCompile(`(?i)\bdo\s+not\s+(follow|obey|listen\s+to)\b`),
+	regexp.MustCompile(`(?i)\boverride\b.{0,30}\b(instructions?|rules|prompt)\b`),
+	regexp.MustCompile(`(?im)^\s*(system|assistant|user)\s*:`),
+	regexp.MustCompile(`(?i)\bfailure_response\b`),
+	regexp.MustCompile(`(?i)<\|im_(start|end)\|>|\[/?INST\]|<</?SYS>>`),
+}
+
+// looksLikeInstruction reports whether text reads like an instruction to the model.
+func looksLikeInstruction(text string) bool {
+	for _, re := range injectionPatterns {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// NeutralizeCodeComments replaces the body of every HTML, CSS or JavaScript comment
+// in code that reads like an instruction to the model. It returns the cleaned code
+// and the original text of the removed comments. Other comments are kept as they are.
+func NeutralizeCodeComments(code string) (string, []string) {
+	var removed []string
+
+	neutralize := func(re *regexp.Regexp, open, close string, prefixGroup bool) {
+		code = re.ReplaceAllStringFunc(code, func(match string) string {
+			groups := re.FindStringSubmatch(match)
+			prefix, body := "", groups[1]
+			if prefixGroup {
+				prefix, body = groups[1], groups[2]
+			}
+			if !looksLikeInstruction(body) {
+				return match
+			}
+			removed = append(removed, strings.TrimSpace(body))
+			return prefix + strings.TrimRight(open+" "+removedCommentText+" "+close, " ")
+		})
+	}
+
+	neutralize(htmlCommentRe, "<!--", "-->", false)
+	neutralize(blockCommentRe, "/*", "*/", false)
+	neutralize(lineCommentRe, "//", "", true)
+
+	return code, removed
+}
+
+// escapeDelimiters defuses any section delimiter tags contained in text.
+func escapeDelimiters(text string) string {
+	return delimiterRe.ReplaceAllString(text, "&lt;$1$2$3")
+}
+
+// updateCodeContent builds the user message parts of a code update request: the
+// instructions and the code are sent as separate, delimited parts. It also returns
+// the comments that were removed from the code.
+func updateCodeContent(instructions string, code string) ([]ContentPart, []string) {
+	cleanCode, removed := NeutralizeCodeComments(code)
+
+	return []ContentPart{
+		TextPart(instructionsOpenTag + "\n" + escapeDelimiters(instructions) + "\n" + instructionsCloseTag),
+		TextPart(codeOpenTag + "\n" + escapeDelimiters(cleanCode) + "\n" + codeCloseTag),
+	}, removed
+}
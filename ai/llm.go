@@ -7,54 +7,164 @@ import (
 	"fmt"
 	"log/slog"
 	"strings"
+
+	"sketch-to-ui-final-proj/layout"
 )
 
 type UIGenerationResponse struct {
 	Components      []UIComponentDTO `json:"components"`
 	FailureResponse string           `json:"failure response,omitempty"`
+
+	// Steps records each model call of the agent pipeline (PipelineAgent)
+	Steps []AgentStep `json:"-"`
 }
 
 // UIComponent represents a UI component with its title, type, and code.
+// Layout is set when the code was rendered from a layout tree (PipelineLayout).
+// A component with Children is a page or section; its code is the markup that
+// wraps the children at ChildrenSlot.
 type UIComponentDTO struct {
-	Title string `json:"title"`
-	Type  string `json:"type"`
-	Code  string `json:"code"`
+	Title    string           `json:"title"`
+	Type     string           `json:"type"`
+	Code     string           `json:"code"`
+	Layout   *layout.Node     `json:"layout,omitempty"`
+	Children []UIComponentDTO `json:"children,omitempty"`
 }
 
 //go:embed prompts/system_prompt.txt
 var systemPrompt string
 
-// GenerateUICode generates UI code from a user prompt and image using OpenRouter's LLM.
-// It sends the prompt and base64-encoded image to the specified model and returns
-// a structured UIGenerationResponse containing the generated UI code.
-func GenerateUICode(ctx context.Context, userPrompt string, imageBase64URI string, op *OpenRouterProvider) (UIGenerationResponse, error) {
-	messages := []map[string]any{
-		{"role": "system", "content": systemPrompt},
-		{"role": "user", "content": []map[string]any{{"type": "text", "text": userPrompt}, {
-			"type": "image_url",
-			"image_url": map[string]string{
-				"url": imageBase64URI,
-			},
-		}},
-		}}
-	modelID := "google/gemini-2.0-flash-exp:free"
-	response, err := op.RequestChatCompletion(ctx, messages, modelID)
+// GenerateUICode generates UI code from a user prompt and image using the given provider.
+// It sends the prompt and base64-encoded image to the model and prompt version chosen
+// in settings and returns a structured UIGenerationResponse containing the generated UI code.
+func GenerateUICode(ctx context.Context, userPrompt string, imageBase64URI string, provider LLMProvider, settings GenerationSettings) (UIGenerationResponse, error) {
+	settings = settings.Resolved()
+	prompts, err := Prompts(settings.PromptVersion)
+	if err != nil {
+		return UIGenerationResponse{}, err
+	}
+
+	ctx, recordRuns := startRunLog(ctx, "generate", settings)
+	defer recordRuns()
+
+	switch settings.Pipeline {
+	case PipelineLayout:
+		return generateFromLayout(ctx, prompts.Layout, userPrompt, imageBase64URI, provider, settings)
+	case PipelineAgent:
+		return generateWithAgent(ctx, prompts, userPrompt, imageBase64URI, provider, settings)
+	}
+
+	messages := []Message{
+		SystemMessage(prompts.Generate),
+		UserMessage(TextPart(userPrompt), ImagePart(imageBase64URI)),
+	}
+	response, err := provider.RequestChatCompletion(ctx, messages, settings.ModelID, settings.Options)
 	if err != nil {
-		return UIGenerationResponse{}, fmt.Errorf("failed to generate response from OpenRouter: %w", err)
+		return UIGenerationResponse{}, fmt.Errorf("failed to generate response from provider: %w", err)
 	}
 
+	return parseGenerationResponse(ctx, response)
+}
+
+// parseGenerationResponse parses a model reply in the code generation format.
+func parseGenerationResponse(ctx context.Context, response string) (UIGenerationResponse, error) {
 	cleanResponse := cleanLLMResponse(response)
 
 	var uiGenResp UIGenerationResponse
-	err = json.Unmarshal([]byte(cleanResponse), &uiGenResp)
+	err := json.Unmarshal([]byte(cleanResponse), &uiGenResp)
+	if err == nil {
+		err = checkHierarchy(uiGenResp.Components, 1)
+	}
+	observeParse(ctx, "generate", cleanResponse, err)
 	if err != nil {
-		slog.Debug("Failed to parse UI Generation Response", "error", err, "response", cleanResponse)
+		slog.DebugContext(ctx, "Failed to parse UI Generation Response", "error", err, "response", cleanResponse)
 		return UIGenerationResponse{}, fmt.Errorf("failed to parse response JSON: %w", err)
 	}
 
 	return uiGenResp, nil
 }
 
+// layoutComponent is one component of the layout pipeline output. Leaves carry a
+// layout tree; pages and sections carry children instead.
+type layoutComponent struct {
+	Title    string            `json:"title"`
+	Type     string            `json:"type"`
+	Layout   *layout.Node      `json:"layout,omitempty"`
+	Children []layoutComponent `json:"children,omitempty"`
+}
+
+// layoutGenerationResponse is the model output of the layout pipeline.
+type layoutGenerationResponse struct {
+	Components      []layoutComponent `json:"components"`
+	FailureResponse string            `json:"failure_response,omitempty"`
+}
+
+// generateFromLayout is the first stage of the layout pipeline: the model describes
+// each component as a layout tree, which is validated and then rendered to code with
+// the default render target.
+func generateFromLayout(ctx context.Context, systemPrompt string, userPrompt string, imageBase64URI string, provider LLMProvider, settings GenerationSettings) (UIGenerationResponse, error) {
+	messages := []Message{
+		SystemMessage(systemPrompt),
+		UserMessage(TextPart(userPrompt), ImagePart(imageBase64URI)),
+	}
+	response, err := provider.RequestChatCompletion(ctx, messages, settings.ModelID, settings.Options)
+	if err != nil {
+		return UIGenerationResponse{}, fmt.Errorf("failed to generate response from provider: %w", err)
+	}
+
+	cleanResponse := cleanLLMResponse(response)
+
+	var layoutResp layoutGenerationResponse
+	var components []UIComponentDTO
+	err = json.Unmarshal([]byte(cleanResponse), &layoutResp)
+	if err == nil {
+		components, err = renderLayoutComponents(layoutResp.Components, 1)
+	}
+	observeParse(ctx, "generate", cleanResponse, err)
+	if err != nil {
+		slog.DebugContext(ctx, "Failed to parse Layout Generation Response", "error", err, "response", cleanResponse)
+		return UIGenerationResponse{}, fmt.Errorf("failed to parse layout response: %w", err)
+	}
+
+	return UIGenerationResponse{Components: components, FailureResponse: layoutResp.FailureResponse}, nil
+}
+
+// renderLayoutComponents validates and renders the layout of every leaf component.
+func renderLayoutComponents(components []layoutComponent, depth int) ([]UIComponentDTO, error) {
+	if depth > MaxComponentDepth && len(components) > 0 {
+		return nil, fmt.Errorf("components are nested deeper than %d levels", MaxComponentDepth)
+	}
+
+	var out []UIComponentDTO
+	for _, c := range components {
+		dto := UIComponentDTO{Title: c.Title, Type: c.Type}
+		if len(c.Children) > 0 {
+			children, err := renderLayoutComponents(c.Children, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			dto.Children = children
+			out = append(out, dto)
+			continue
+		}
+
+		if c.Layout == nil {
+			return nil, fmt.Errorf("component %q has neither a layout nor children", c.Title)
+		}
+		if err := c.Layout.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid layout for component %q: %w", c.Title, err)
+		}
+		code, err := layout.Render(layout.DefaultTarget, *c.Layout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render layout: %w", err)
+		}
+		dto.Code = code
+		dto.Layout = c.Layout
+		out = append(out, dto)
+	}
+	return out, nil
+}
+
 //go:embed prompts/update_code_system_prompt.txt
 var updateCodeSystemPrompt string
 
@@ -64,25 +174,47 @@ type CodeUpdateResponse struct {
 	FailureResponse string         `json:"failure_response,omitempty"`
 }
 
-// UpdateCode updates UI code based on a user prompt using OpenRouter's LLM.
-func UpdateCode(ctx context.Context, userPrompt string, op *OpenRouterProvider) (CodeUpdateResponse, error) {
-	messages := []map[string]any{
-		{"role": "system", "content": updateCodeSystemPrompt},
-		{"role": "user", "content": userPrompt},
+// UpdateCode updates UI code following the user's instructions using the given provider
+// and the model and prompt version chosen in settings. The instructions and the code are
+// sent as separate, delimited message parts, and instruction-like comments are removed
+// from the code first, so text embedded in the code cannot steer the model.
+func UpdateCode(ctx context.Context, instructions string, code string, provider LLMProvider, settings GenerationSettings) (CodeUpdateResponse, error) {
+	settings = settings.Resolved()
+	prompts, err := Prompts(settings.PromptVersion)
+	if err != nil {
+		return CodeUpdateResponse{}, err
+	}
+
+	ctx, recordRuns := startRunLog(ctx, "update", settings)
+	defer recordRuns()
+
+	content, removed := updateCodeContent(instructions, code)
+	if len(removed) > 0 {
+		slog.WarnContext(ctx, "Removed instruction-like comments from component code", "count", len(removed))
+	}
+
+	return requestCodeUpdate(ctx, "update", prompts.UpdateCode, content, provider, settings)
+}
+
+// requestCodeUpdate sends a code update request and parses the updated component.
+func requestCodeUpdate(ctx context.Context, operation string, systemPrompt string, content []ContentPart, provider LLMProvider, settings GenerationSettings) (CodeUpdateResponse, error) {
+	messages := []Message{
+		SystemMessage(systemPrompt),
+		UserMessage(content...),
 	}
 
-	modelID := "google/gemini-2.0-flash-exp:free"
-	response, err := op.RequestChatCompletion(ctx, messages, modelID)
+	response, err := provider.RequestChatCompletion(ctx, messages, settings.ModelID, settings.Options)
 	if err != nil {
-		return CodeUpdateResponse{}, fmt.Errorf("failed to generate response from OpenRouter: %w", err)
+		return CodeUpdateResponse{}, fmt.Errorf("failed to generate response from provider: %w", err)
 	}
 
 	cleanResponse := cleanLLMResponse(response)
 
 	var codeUpdateResp CodeUpdateResponse
 	err = json.Unmarshal([]byte(cleanResponse), &codeUpdateResp)
+	observeParse(ctx, operation, cleanResponse, err)
 	if err != nil {
-		slog.Debug("Failed to parse Code Update Response", "error", err, "response", cleanResponse)
+		slog.DebugContext(ctx, "Failed to parse Code Update Response", "error", err, "response", cleanResponse)
 		return CodeUpdateResponse{}, fmt.Errorf("failed to parse response JSON: %w", err)
 	}
 
@@ -22,8 +22,7 @@ import (
 // creating an OpenRouter provider, reading a test image, and verifying that UI code
 // generation works correctly with image input.
 func TestGenerateUICode(t *testing.T) {
-	err := godotenv.Load("../.env")
-	require.NoError(t, err, "Failed to load .env file")
+	_ = godotenv.Load("../.env") // Optional: credentials may come from the environment instead
 	apiKey := os.Getenv("OPENROUTER_API_KEY")
 	baseURL := os.Getenv("OPENROUTER_BASE_URL")
 
@@ -49,7 +48,7 @@ func TestGenerateUICode(t *testing.T) {
 	defer cancel()
 
 	userPrompt := "Analyze the following sketch image from the image url I sent and generate the corresponding UI component code (using  HTML and tailwindcss) in JSON format."
-	uiCode, err := GenerateUICode(ctx, userPrompt, "data:image/png;base64,"+imageBase64, openrouter)
+	uiCode, err := GenerateUICode(ctx, userPrompt, "data:image/png;base64,"+imageBase64, openrouter, GenerationSettings{})
 
 	assert.NoError(t, err, "GenerateUICode should not return an error")
 	assert.NotEmpty(t, uiCode, "GenerateUICode should return a non-empty string")
@@ -62,8 +61,7 @@ func TestGenerateUICode(t *testing.T) {
 // TestUpdateCode tests the UpdateCode function by loading environment variables,
 // creating an OpenRouter provider, and verifying that code update works correctly.
 func TestUpdateCode(t *testing.T) {
-	err := godotenv.Load("../.env")
-	require.NoError(t, err, "Failed to load .env file")
+	_ = godotenv.Load("../.env") // Optional: credentials may come from the environment instead
 	apiKey := os.Getenv("OPENROUTER_API_KEY")
 	baseURL := os.Getenv("OPENROUTER_BASE_URL")
 
@@ -82,14 +80,10 @@ func TestUpdateCode(t *testing.T) {
 	defer cancel()
 
 	// Sample existing component to update
-	oldComponent := `{
-		"title": "Simple Button",
-		"type": "button",
-		"code": "<button class=\"px-4 py-2 bg-gray-500 text-white\">Click Me</button>"
-	}`
-	
-	userPrompt := "Update the following button component to have a blue background and rounded corners. Here is the current component: " + oldComponent + ". Return the updated code in JSON format."
-	codeUpdateResp, err := UpdateCode(ctx, userPrompt, openrouter)
+	oldCode := `<button class="px-4 py-2 bg-gray-500 text-white">Click Me</button>`
+
+	userPrompt := "Update the button component to have a blue background and rounded corners."
+	codeUpdateResp, err := UpdateCode(ctx, userPrompt, oldCode, openrouter, GenerationSettings{})
 
 	assert.NoError(t, err, "UpdateCode should not return an error")
 	assert.NotEmpty(t, codeUpdateResp, "UpdateCode should return a non-empty response")
@@ -97,3 +91,39 @@ func TestUpdateCode(t *testing.T) {
 	// Log the response for manual inspection
 	slog.Info("Code Update Response:", "response", codeUpdateResp)
 }
+
+// TestGenerateUICodeLayoutPipeline checks that the layout pipeline asks for a layout
+// tree and renders it to code without a second model call.
+func TestGenerateUICodeLayoutPipeline(t *testing.T) {
+	provider := &FakeProvider{Respond: func(messages []Message, modelID string) (string, error) {
+		return "```json\n" + `{"components":[{"title":"Search","type":"Form","layout":{"type":"row","children":[
+			{"type":"input","variant":"search","text":"Search"},{"type":"button","text":"Go"}]}}]}` + "\n```", nil
+	}}
+
+	resp, err := GenerateUICode(context.Background(), "Build this", "data:image/png;base64,aGVsbG8=", provider, GenerationSettings{Pipeline: PipelineLayout})
+	require.NoError(t, err)
+	require.Len(t, resp.Components, 1)
+
+	component := resp.Components[0]
+	require.NotNil(t, component.Layout)
+	assert.Equal(t, "row", component.Layout.Type)
+	assert.Contains(t, component.Code, `<input type="search"`)
+	assert.Contains(t, component.Code, `<button type="button"`)
+
+	calls := provider.Calls()
+	require.Len(t, calls, 1)
+	prompts, err := Prompts(DefaultPromptVersion)
+	require.NoError(t, err)
+	assert.Equal(t, SystemMessage(prompts.Layout), calls[0].Messages[0])
+}
+
+// TestGenerateUICodeLayoutPipelineRejectsInvalidTree checks that a tree breaking the
+// layout rules is reported as a parse failure.
+func TestGenerateUICodeLayoutPipelineRejectsInvalidTree(t *testing.T) {
+	provider := &FakeProvider{Respond: func(messages []Message, modelID string) (string, error) {
+		return `{"components":[{"title":"Bad","type":"Button","layout":{"type":"button"}}]}`, nil
+	}}
+
+	_, err := GenerateUICode(context.Background(), "Build this", "data:image/png;base64,aGVsbG8=", provider, GenerationSettings{Pipeline: PipelineLayout})
+	assert.ErrorContains(t, err, "invalid layout")
+}
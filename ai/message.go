@@ -0,0 +1,93 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Message roles understood by every provider.
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Content part types.
+const (
+	PartText  = "text"
+	PartImage = "image"
+)
+
+// ContentPart is one piece of a message: either text or an image. ImageURL holds
+// either a remote URL or a base64 data URI (data:image/png;base64,...).
+type ContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+}
+
+// Message is a provider-neutral chat message. Each provider translates it to its
+// native request format.
+type Message struct {
+	Role  string        `json:"role"`
+	Parts []ContentPart `json:"parts"`
+}
+
+// TextPart returns a text content part.
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: PartText, Text: text}
+}
+
+// ImagePart returns an image content part for a URL or data URI.
+func ImagePart(url string) ContentPart {
+	return ContentPart{Type: PartImage, ImageURL: url}
+}
+
+// SystemMessage returns a system message with a single text part.
+func SystemMessage(text string) Message {
+	return Message{Role: RoleSystem, Parts: []ContentPart{TextPart(text)}}
+}
+
+// UserMessage returns a user message made of parts.
+func UserMessage(parts ...ContentPart) Message {
+	return Message{Role: RoleUser, Parts: parts}
+}
+
+// Text returns the text parts of the message joined by blank lines.
+func (m Message) Text() string {
+	var texts []string
+	for _, part := range m.Parts {
+		if part.Type == PartText {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// Images returns the image URLs of the message.
+func (m Message) Images() []string {
+	var images []string
+	for _, part := range m.Parts {
+		if part.Type == PartImage {
+			images = append(images, part.ImageURL)
+		}
+	}
+	return images
+}
+
+// ParseDataURI splits a base64 data URI into its media type and base64 data.
+func ParseDataURI(uri string) (mediaType string, data string, err error) {
+	rest, ok := strings.CutPrefix(uri, "data:")
+	if !ok {
+		return "", "", fmt.Errorf("image is not a data URI")
+	}
+	meta, data, ok := strings.Cut(rest, ",")
+	if !ok {
+		return "", "", fmt.Errorf("malformed data URI")
+	}
+	mediaType, ok = strings.CutSuffix(meta, ";base64")
+	if !ok {
+		return "", "", fmt.Errorf("data URI is not base64 encoded")
+	}
+	return mediaType, data, nil
+}
@@ -0,0 +1,108 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// OllamaProvider implements LLMProvider using the chat API of an Ollama server,
+// so a self-hosted vision model (e.g. llava or llama3.2-vision) can be used.
+type OllamaProvider struct {
+	// BaseURL is the root URL of the Ollama server, e.g. http://localhost:11434
+	BaseURL string
+
+	// Client is a reusable HTTP client for making API requests
+	Client *http.Client
+}
+
+// NewOllamaProvider creates a new instance of OllamaProvider.
+func NewOllamaProvider(baseURL string, client *http.Client) *OllamaProvider {
+	return &OllamaProvider{
+		BaseURL: baseURL,
+		Client:  client,
+	}
+}
+
+// RequestChatCompletion makes a synchronous call to Ollama and returns a complete response.
+// Sampling options are sent as Ollama model options; routing preferences are ignored.
+func (p *OllamaProvider) RequestChatCompletion(ctx context.Context, messages []Message, modelID string, opts CompletionOptions) (string, error) {
+	return instrumentCompletion(ctx, ProviderOllama, modelID, messages, func(ctx context.Context) (string, Usage, error) {
+		converted, err := toOllamaMessages(messages)
+		if err != nil {
+			return "", Usage{}, err
+		}
+
+		payload := map[string]any{
+			"model":    modelID,
+			"messages": converted,
+			"stream":   false,
+		}
+		if options := ollamaOptions(opts); len(options) > 0 {
+			payload["options"] = options
+		}
+		if opts.ResponseFormat == ResponseFormatJSON {
+			payload["format"] = "json"
+		}
+
+		var result struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			PromptEvalCount int `json:"prompt_eval_count"`
+			EvalCount       int `json:"eval_count"`
+		}
+
+		url := fmt.Sprintf("%s/api/chat", p.BaseURL)
+		if err := postJSON(ctx, p.Client, url, nil, payload, &result); err != nil {
+			return "", Usage{}, err
+		}
+
+		return result.Message.Content, Usage{InputTokens: result.PromptEvalCount, OutputTokens: result.EvalCount}, nil
+	})
+}
+
+// ollamaOptions translates the sampling options to Ollama model options.
+func ollamaOptions(opts CompletionOptions) map[string]any {
+	options := map[string]any{}
+	if opts.Temperature != nil {
+		options["temperature"] = *opts.Temperature
+	}
+	if opts.MaxTokens > 0 {
+		options["num_predict"] = opts.MaxTokens
+	}
+	if opts.TopP != nil {
+		options["top_p"] = *opts.TopP
+	}
+	if opts.Seed != nil {
+		options["seed"] = *opts.Seed
+	}
+	if len(opts.Stop) > 0 {
+		options["stop"] = opts.Stop
+	}
+	return options
+}
+
+// toOllamaMessages translates messages to the Ollama chat format, where content is
+// a single string and images are raw base64 strings next to it.
+func toOllamaMessages(messages []Message) ([]map[string]any, error) {
+	out := make([]map[string]any, 0, len(messages))
+	for _, m := range messages {
+		message := map[string]any{"role": m.Role, "content": m.Text()}
+
+		var images []string
+		for _, url := range m.Images() {
+			_, data, err := ParseDataURI(url)
+			if err != nil {
+				return nil, fmt.Errorf("ollama only accepts inline images: %w", err)
+			}
+			images = append(images, data)
+		}
+		if len(images) > 0 {
+			message["images"] = images
+		}
+
+		out = append(out, message)
+	}
+	return out, nil
+}
@@ -1,20 +1,15 @@
 package ai
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"log/slog"
 	"net/http"
-	"time"
 )
 
-// OpenRouterProvider implements both LLMProvider and LLMStreamingProvider
-// using the OpenRouter API. OpenRouter acts as a gateway to multiple LLM providers
-// with a unified API and flexible model selection.
+// OpenRouterProvider implements LLMProvider using the OpenRouter API. OpenRouter
+// acts as a gateway to multiple LLM providers with a unified API and flexible
+// model selection.
 type OpenRouterProvider struct {
 	// APIKey is the authentication key for the OpenRouter API
 	APIKey string
@@ -22,7 +17,6 @@ type OpenRouterProvider struct {
 	// BaseURL is the root URL for the OpenRouter API endpoints
 	BaseURL string
 
-
 	// Client is a reusable HTTP client for making API requests
 	Client *http.Client
 }
@@ -48,46 +42,50 @@ func NewOpenRouterProvider(apiKey string, baseURL string, client *http.Client) *
 //
 // Parameters:
 //   - ctx: Context for request cancellation and timeout
-//   - messages: Array of message objects with role and content fields
+//   - messages: The conversation to send
 //   - modelID: Model identifier to use for generation
+//   - opts: Sampling parameters and provider routing preferences
 //
 // Returns:
 //   - string: The generated response text
 //   - error: Any error encountered during the request
-func (p *OpenRouterProvider) RequestChatCompletion(ctx context.Context, messages []map[string]any, modelID string) (string, error) {
-	requestID := fmt.Sprintf("%d", time.Now().UnixNano())
-	slog.Info("Starting RequestChatCompletion", "requestID", requestID)
+func (p *OpenRouterProvider) RequestChatCompletion(ctx context.Context, messages []Message, modelID string, opts CompletionOptions) (string, error) {
+	return instrumentCompletion(ctx, ProviderOpenRouter, modelID, messages, func(ctx context.Context) (string, Usage, error) {
+		return requestOpenAIChat(ctx, p.Client, p.BaseURL, p.APIKey, messages, modelID, opts)
+	})
+}
 
-	url := fmt.Sprintf("%s/v1/chat/completions", p.BaseURL)
+// requestOpenAIChat calls an OpenAI compatible /v1/chat/completions endpoint. Routing
+// preferences are sent as OpenRouter's provider object; callers talking to other
+// endpoints clear them.
+func requestOpenAIChat(ctx context.Context, client *http.Client, baseURL string, apiKey string, messages []Message, modelID string, opts CompletionOptions) (string, Usage, error) {
+	url := fmt.Sprintf("%s/v1/chat/completions", baseURL)
 
 	payload := map[string]any{
 		"model":    modelID,
-		"messages": messages,
+		"messages": toOpenAIMessages(messages),
 		"stream":   false,
 	}
-
-	payloadBytes, err := json.Marshal(payload)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal payload: %w", err)
+	if opts.Temperature != nil {
+		payload["temperature"] = *opts.Temperature
 	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payloadBytes))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+	if opts.MaxTokens > 0 {
+		payload["max_tokens"] = opts.MaxTokens
 	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+p.APIKey)
-
-	resp, err := p.Client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("request failed: %w", err)
+	if opts.TopP != nil {
+		payload["top_p"] = *opts.TopP
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("non-200 response: %d - %s", resp.StatusCode, string(bodyBytes))
+	if opts.Seed != nil {
+		payload["seed"] = *opts.Seed
+	}
+	if len(opts.Stop) > 0 {
+		payload["stop"] = opts.Stop
+	}
+	if opts.ResponseFormat != "" {
+		payload["response_format"] = map[string]string{"type": opts.ResponseFormat}
+	}
+	if opts.Routing != nil {
+		payload["provider"] = opts.Routing
 	}
 
 	var result struct {
@@ -96,16 +94,48 @@ func (p *OpenRouterProvider) RequestChatCompletion(ctx context.Context, messages
 				Content string `json:"content"`
 			} `json:"message"`
 		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+	headers := map[string]string{"Authorization": "Bearer " + apiKey}
+	if err := postJSON(ctx, client, url, headers, payload, &result); err != nil {
+		return "", Usage{}, err
 	}
 
 	if len(result.Choices) == 0 {
-		return "", errors.New("no choices returned")
+		return "", Usage{}, errors.New("no choices returned")
 	}
 
-	slog.Info("Completed RequestChatCompletion", "requestID", requestID)
-	return result.Choices[0].Message.Content, nil
+	usage := Usage{InputTokens: result.Usage.PromptTokens, OutputTokens: result.Usage.CompletionTokens}
+	return result.Choices[0].Message.Content, usage, nil
+}
+
+// toOpenAIMessages translates messages to the OpenAI chat format. Messages with a
+// single text part keep plain string content.
+func toOpenAIMessages(messages []Message) []map[string]any {
+	out := make([]map[string]any, 0, len(messages))
+	for _, m := range messages {
+		if len(m.Parts) == 1 && m.Parts[0].Type == PartText {
+			out = append(out, map[string]any{"role": m.Role, "content": m.Parts[0].Text})
+			continue
+		}
+
+		content := make([]map[string]any, 0, len(m.Parts))
+		for _, part := range m.Parts {
+			switch part.Type {
+			case PartText:
+				content = append(content, map[string]any{"type": "text", "text": part.Text})
+			case PartImage:
+				content = append(content, map[string]any{
+					"type":      "image_url",
+					"image_url": map[string]string{"url": part.ImageURL},
+				})
+			}
+		}
+		out = append(out, map[string]any{"role": m.Role, "content": content})
+	}
+	return out
 }
@@ -0,0 +1,37 @@
+package ai
+
+import (
+	"context"
+	"net/http"
+)
+
+// OpenAIProvider implements LLMProvider using the OpenAI chat completions API.
+// It also works with any server exposing an OpenAI compatible endpoint.
+type OpenAIProvider struct {
+	// APIKey is the authentication key for the OpenAI API
+	APIKey string
+
+	// BaseURL is the root URL for the API endpoints, e.g. https://api.openai.com
+	BaseURL string
+
+	// Client is a reusable HTTP client for making API requests
+	Client *http.Client
+}
+
+// NewOpenAIProvider creates a new instance of OpenAIProvider.
+func NewOpenAIProvider(apiKey string, baseURL string, client *http.Client) *OpenAIProvider {
+	return &OpenAIProvider{
+		APIKey:  apiKey,
+		BaseURL: baseURL,
+		Client:  client,
+	}
+}
+
+// RequestChatCompletion makes a synchronous call to OpenAI and returns a complete response.
+// Routing preferences only apply to OpenRouter and are not sent.
+func (p *OpenAIProvider) RequestChatCompletion(ctx context.Context, messages []Message, modelID string, opts CompletionOptions) (string, error) {
+	opts.Routing = nil
+	return instrumentCompletion(ctx, ProviderOpenAI, modelID, messages, func(ctx context.Context) (string, Usage, error) {
+		return requestOpenAIChat(ctx, p.Client, p.BaseURL, p.APIKey, messages, modelID, opts)
+	})
+}
@@ -0,0 +1,143 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+)
+
+// Response formats of CompletionOptions.
+const (
+	ResponseFormatText = "text"
+	ResponseFormatJSON = "json_object"
+)
+
+// MaxStopSequences is the most stop sequences every provider accepts.
+const MaxStopSequences = 4
+
+// CompletionOptions are the sampling and routing parameters of a chat completion.
+// Unset fields leave the provider's own defaults in place. Providers ignore the
+// options they do not support: Anthropic has no seed or response format, and only
+// OpenRouter routes between upstream providers.
+type CompletionOptions struct {
+	Temperature    *float64 `json:"temperature,omitempty"`
+	MaxTokens      int      `json:"max_tokens,omitempty"`
+	TopP           *float64 `json:"top_p,omitempty"`
+	Seed           *int     `json:"seed,omitempty"`
+	Stop           []string `json:"stop,omitempty"`
+	ResponseFormat string   `json:"response_format,omitempty"`
+
+	Routing *RoutingPreferences `json:"routing,omitempty"`
+}
+
+// RoutingPreferences choose which upstream providers OpenRouter may send a request to.
+type RoutingPreferences struct {
+	// Order lists provider names to try first, in order
+	Order []string `json:"order,omitempty"`
+
+	// AllowFallbacks allows providers outside Order when those in it are unavailable
+	AllowFallbacks *bool `json:"allow_fallbacks,omitempty"`
+
+	// Sort is "price", "throughput" or "latency"
+	Sort string `json:"sort,omitempty"`
+
+	// DataCollection is "allow" or "deny"; "deny" skips providers that store prompts
+	DataCollection string `json:"data_collection,omitempty"`
+}
+
+// Validate checks the options against the widest ranges the providers accept. A
+// provider with a narrower range clamps the options to it: Anthropic takes
+// temperatures up to AnthropicMaxTemperature only.
+func (o CompletionOptions) Validate() error {
+	// NaN fails every comparison, so it is rejected before the ranges are checked
+	if o.Temperature != nil && (!isFinite(*o.Temperature) || *o.Temperature < 0 || *o.Temperature > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2")
+	}
+	if o.TopP != nil && (!isFinite(*o.TopP) || *o.TopP <= 0 || *o.TopP > 1) {
+		return fmt.Errorf("top_p must be greater than 0 and at most 1")
+	}
+	if o.MaxTokens < 0 {
+		return fmt.Errorf("max_tokens must not be negative")
+	}
+	if len(o.Stop) > MaxStopSequences {
+		return fmt.Errorf("at most %d stop sequences are allowed", MaxStopSequences)
+	}
+	switch o.ResponseFormat {
+	case "", ResponseFormatText, ResponseFormatJSON:
+	default:
+		return fmt.Errorf("unknown response format %q", o.ResponseFormat)
+	}
+
+	if r := o.Routing; r != nil {
+		switch r.Sort {
+		case "", "price", "throughput", "latency":
+		default:
+			return fmt.Errorf("unknown routing sort %q", r.Sort)
+		}
+		switch r.DataCollection {
+		case "", "allow", "deny":
+		default:
+			return fmt.Errorf("unknown routing data collection %q", r.DataCollection)
+		}
+	}
+	return nil
+}
+
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// withDefaults returns the options with every unset field taken from defaults.
+func (o CompletionOptions) withDefaults(defaults CompletionOptions) CompletionOptions {
+	if o.Temperature == nil {
+		o.Temperature = defaults.Temperature
+	}
+	if o.MaxTokens == 0 {
+		o.MaxTokens = defaults.MaxTokens
+	}
+	if o.TopP == nil {
+		o.TopP = defaults.TopP
+	}
+	if o.Seed == nil {
+		o.Seed = defaults.Seed
+	}
+	if len(o.Stop) == 0 {
+		o.Stop = defaults.Stop
+	}
+	if o.ResponseFormat == "" {
+		o.ResponseFormat = defaults.ResponseFormat
+	}
+	if o.Routing == nil {
+		o.Routing = defaults.Routing
+	}
+	return o
+}
+
+// modelDefaults maps a model ID to the options used when a request leaves them unset.
+var modelDefaults = map[string]CompletionOptions{}
+
+// SetModelDefaults replaces the per-model default options.
+func SetModelDefaults(defaults map[string]CompletionOptions) {
+	modelDefaults = defaults
+}
+
+// LoadModelDefaults reads per-model default options from a JSON file mapping model
+// IDs to options, e.g. {"openai/gpt-4o": {"temperature": 0.2, "max_tokens": 4096}}.
+func LoadModelDefaults(path string) (map[string]CompletionOptions, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model defaults file: %w", err)
+	}
+
+	var defaults map[string]CompletionOptions
+	if err := json.Unmarshal(data, &defaults); err != nil {
+		return nil, fmt.Errorf("failed to parse model defaults file: %w", err)
+	}
+	for model, options := range defaults {
+		if err := options.Validate(); err != nil {
+			return nil, fmt.Errorf("model defaults for %s: %w", model, err)
+		}
+	}
+	return defaults, nil
+}
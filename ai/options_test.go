@@ -0,0 +1,72 @@
+package ai
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func floatPtr(v float64) *float64 { return &v }
+
+func TestCompletionOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options CompletionOptions
+		wantErr string
+	}{
+		{name: "empty", options: CompletionOptions{}},
+		{name: "all set", options: testOptions()},
+		{name: "temperature too high", options: CompletionOptions{Temperature: floatPtr(2.5)}, wantErr: "temperature"},
+		{name: "NaN temperature", options: CompletionOptions{Temperature: floatPtr(math.NaN())}, wantErr: "temperature"},
+		{name: "infinite temperature", options: CompletionOptions{Temperature: floatPtr(math.Inf(-1))}, wantErr: "temperature"},
+		{name: "zero top_p", options: CompletionOptions{TopP: floatPtr(0)}, wantErr: "top_p"},
+		{name: "NaN top_p", options: CompletionOptions{TopP: floatPtr(math.NaN())}, wantErr: "top_p"},
+		{name: "negative max tokens", options: CompletionOptions{MaxTokens: -1}, wantErr: "max_tokens"},
+		{name: "too many stop sequences", options: CompletionOptions{Stop: []string{"a", "b", "c", "d", "e"}}, wantErr: "stop sequences"},
+		{name: "unknown response format", options: CompletionOptions{ResponseFormat: "xml"}, wantErr: "response format"},
+		{name: "unknown routing sort", options: CompletionOptions{Routing: &RoutingPreferences{Sort: "cheapest"}}, wantErr: "routing sort"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestResolvedAppliesModelDefaults(t *testing.T) {
+	SetModelDefaults(map[string]CompletionOptions{
+		"test/model": {Temperature: floatPtr(0.2), MaxTokens: 4096},
+	})
+	t.Cleanup(func() { SetModelDefaults(map[string]CompletionOptions{}) })
+
+	settings := GenerationSettings{ModelID: "test/model", Options: CompletionOptions{Temperature: floatPtr(0.8)}}.Resolved()
+
+	assert.Equal(t, 0.8, *settings.Options.Temperature, "request options win over the defaults")
+	assert.Equal(t, 4096, settings.Options.MaxTokens)
+}
+
+func TestLoadModelDefaults(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.json")
+	require.NoError(t, os.WriteFile(valid, []byte(`{"openai/gpt-4o": {"temperature": 0.2, "max_tokens": 4096}}`), 0o600))
+
+	defaults, err := LoadModelDefaults(valid)
+	require.NoError(t, err)
+	assert.Equal(t, 0.2, *defaults["openai/gpt-4o"].Temperature)
+	assert.Equal(t, 4096, defaults["openai/gpt-4o"].MaxTokens)
+
+	invalid := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(invalid, []byte(`{"openai/gpt-4o": {"temperature": 3}}`), 0o600))
+	_, err = LoadModelDefaults(invalid)
+	assert.ErrorContains(t, err, "openai/gpt-4o")
+}
@@ -0,0 +1,135 @@
+package ai
+
+import (
+	_ "embed"
+	"fmt"
+	"sort"
+)
+
+// DefaultPromptVersion is the prompt version used when a caller does not choose one.
+const DefaultPromptVersion = "v1"
+
+// PromptSet holds the system prompts of one prompt version.
+type PromptSet struct {
+	Generate   string
+	UpdateCode string
+
+	// Layout asks for a layout tree instead of code (PipelineLayout)
+	Layout string
+
+	// Plan and Critique are the element listing and review steps of PipelineAgent
+	Plan     string
+	Critique string
+
+	// GenerateText generates from a description alone; RefineSketch updates such a
+	// component once a sketch of it is attached
+	GenerateText string
+	RefineSketch string
+}
+
+//go:embed prompts/layout_system_prompt.txt
+var layoutSystemPrompt string
+
+//go:embed prompts/agent_plan_prompt.txt
+var agentPlanPrompt string
+
+//go:embed prompts/agent_critique_prompt.txt
+var agentCritiquePrompt string
+
+//go:embed prompts/text_system_prompt.txt
+var textSystemPrompt string
+
+//go:embed prompts/refine_sketch_prompt.txt
+var refineSketchPrompt string
+
+//go:embed prompts/v2/system_prompt.txt
+var systemPromptV2 string
+
+//go:embed prompts/v2/update_code_system_prompt.txt
+var updateCodeSystemPromptV2 string
+
+// promptVersions maps a version name to its system prompts. v1 is the original
+// prompt pair; later versions live under prompts/<version>/.
+var promptVersions = map[string]PromptSet{
+	"v1": {Generate: systemPrompt, UpdateCode: updateCodeSystemPrompt, Layout: layoutSystemPrompt, Plan: agentPlanPrompt, Critique: agentCritiquePrompt,
+		GenerateText: textSystemPrompt, RefineSketch: refineSketchPrompt},
+	"v2": {Generate: systemPromptV2, UpdateCode: updateCodeSystemPromptV2, Layout: layoutSystemPrompt, Plan: agentPlanPrompt, Critique: agentCritiquePrompt,
+		GenerateText: textSystemPrompt, RefineSketch: refineSketchPrompt},
+}
+
+// PromptVersions returns the known prompt versions in sorted order.
+func PromptVersions() []string {
+	versions := make([]string, 0, len(promptVersions))
+	for v := range promptVersions {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// Prompts returns the prompt set for version (DefaultPromptVersion when empty).
+func Prompts(version string) (PromptSet, error) {
+	if version == "" {
+		version = DefaultPromptVersion
+	}
+	set, ok := promptVersions[version]
+	if !ok {
+		return PromptSet{}, fmt.Errorf("unknown prompt version %q", version)
+	}
+	return set, nil
+}
+
+// Generation pipelines.
+const (
+	// PipelineDirect asks the model for code straight from the sketch
+	PipelineDirect = "direct"
+	// PipelineLayout asks the model for a layout tree that is rendered to code in Go
+	PipelineLayout = "layout"
+	// PipelineAgent lists the sketch elements, generates code, then critiques and fixes it
+	PipelineAgent = "agent"
+)
+
+// Default bounds of the agent pipeline.
+const (
+	DefaultAgentMaxSteps    = 6
+	DefaultAgentTokenBudget = 60000
+)
+
+// GenerationSettings selects the model, prompt version and pipeline of a generation
+// request. Zero values fall back to DefaultModel(), DefaultPromptVersion and PipelineDirect.
+// MaxSteps and TokenBudget bound the agent pipeline and default to DefaultAgentMaxSteps
+// and DefaultAgentTokenBudget.
+type GenerationSettings struct {
+	ModelID       string `json:"model_id,omitempty"`
+	PromptVersion string `json:"prompt_version,omitempty"`
+	Pipeline      string `json:"pipeline,omitempty"`
+	MaxSteps      int    `json:"max_steps,omitempty"`
+	TokenBudget   int    `json:"token_budget,omitempty"`
+
+	// Options are the sampling parameters of every model call; unset fields fall back
+	// to the defaults configured for the model (SetModelDefaults)
+	Options CompletionOptions `json:"options"`
+}
+
+// Resolved returns the settings with defaults filled in, as they are actually used.
+func (s GenerationSettings) Resolved() GenerationSettings {
+	if s.ModelID == "" {
+		s.ModelID = defaultModel
+	}
+	if s.PromptVersion == "" {
+		s.PromptVersion = DefaultPromptVersion
+	}
+	if s.Pipeline == "" {
+		s.Pipeline = PipelineDirect
+	}
+	s.Options = s.Options.withDefaults(modelDefaults[s.ModelID])
+	if s.Pipeline == PipelineAgent {
+		if s.MaxSteps <= 0 {
+			s.MaxSteps = DefaultAgentMaxSteps
+		}
+		if s.TokenBudget <= 0 {
+			s.TokenBudget = DefaultAgentTokenBudget
+		}
+	}
+	return s
+}
@@ -0,0 +1,288 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"sketch-to-ui-final-proj/metrics"
+	"sketch-to-ui-final-proj/tracing"
+)
+
+// DefaultModelID is the model used when a caller does not choose one, unless
+// SetDefaultModel picked another.
+const DefaultModelID = "google/gemini-2.0-flash-exp:free"
+
+var defaultModel = DefaultModelID
+
+// SetDefaultModel changes the model used when a caller does not choose one, e.g. to
+// a model known to the configured provider. It must be called during startup.
+func SetDefaultModel(modelID string) {
+	defaultModel = modelID
+}
+
+// SetDefaultModelFor changes the default model to modelID, or to a vision model the
+// named provider serves when modelID is empty, so a server configured with only a
+// provider does not send it another provider's model. It must be called during startup.
+func SetDefaultModelFor(provider string, modelID string) {
+	if modelID == "" {
+		modelID = DefaultModelFor(provider)
+	}
+	SetDefaultModel(modelID)
+}
+
+// DefaultModel returns the model used when a caller does not choose one.
+func DefaultModel() string {
+	return defaultModel
+}
+
+// LLMProvider is implemented by every chat completion backend the generation
+// functions can talk to. Each provider translates the messages and options to its
+// native format.
+type LLMProvider interface {
+	RequestChatCompletion(ctx context.Context, messages []Message, modelID string, opts CompletionOptions) (string, error)
+}
+
+// Provider names accepted by NewProvider.
+const (
+	ProviderOpenRouter = "openrouter"
+	ProviderOpenAI     = "openai"
+	ProviderAnthropic  = "anthropic"
+	ProviderOllama     = "ollama"
+)
+
+// NewProvider creates the named provider, reading its API key and base URL from the
+// environment:
+//   - openrouter (default): OPENROUTER_API_KEY, OPENROUTER_BASE_URL
+//   - openai: OPENAI_API_KEY, OPENAI_BASE_URL (default https://api.openai.com)
+//   - anthropic: ANTHROPIC_API_KEY, ANTHROPIC_BASE_URL (default https://api.anthropic.com)
+//   - ollama: OLLAMA_BASE_URL (default http://localhost:11434)
+func NewProvider(name string, client *http.Client) (LLMProvider, error) {
+	return NewProviderWithKey(name, os.Getenv(providerKeyEnv[name]), client)
+}
+
+// providerKeyEnv names the environment variable holding the shared API key of each provider.
+var providerKeyEnv = map[string]string{
+	"":                 "OPENROUTER_API_KEY",
+	ProviderOpenRouter: "OPENROUTER_API_KEY",
+	ProviderOpenAI:     "OPENAI_API_KEY",
+	ProviderAnthropic:  "ANTHROPIC_API_KEY",
+}
+
+// providerDefaultModel names a vision model each provider serves. OpenRouter uses
+// DefaultModelID.
+var providerDefaultModel = map[string]string{
+	ProviderOpenAI:    "gpt-4o-mini",
+	ProviderAnthropic: "claude-3-5-sonnet-latest",
+	ProviderOllama:    "llama3.2-vision",
+}
+
+// DefaultModelFor returns a vision model the named provider serves. Unknown
+// providers get DefaultModelID.
+func DefaultModelFor(provider string) string {
+	if model, ok := providerDefaultModel[provider]; ok {
+		return model
+	}
+	return DefaultModelID
+}
+
+// NewProviderWithKey creates the named provider like NewProvider, but authenticates
+// with apiKey instead of the shared key from the environment.
+func NewProviderWithKey(name string, apiKey string, client *http.Client) (LLMProvider, error) {
+	switch name {
+	case "", ProviderOpenRouter:
+		return NewOpenRouterProvider(apiKey, os.Getenv("OPENROUTER_BASE_URL"), client), nil
+	case ProviderOpenAI:
+		return NewOpenAIProvider(apiKey, envOr("OPENAI_BASE_URL", "https://api.openai.com"), client), nil
+	case ProviderAnthropic:
+		return NewAnthropicProvider(apiKey, envOr("ANTHROPIC_BASE_URL", "https://api.anthropic.com"), client), nil
+	case ProviderOllama:
+		return NewOllamaProvider(envOr("OLLAMA_BASE_URL", "http://localhost:11434"), client), nil
+	default:
+		return nil, fmt.Errorf("unknown AI provider %q", name)
+	}
+}
+
+// UsesAPIKey reports whether the named provider authenticates with an API key.
+func UsesAPIKey(name string) bool {
+	_, ok := providerKeyEnv[name]
+	return ok
+}
+
+func envOr(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// Usage is the token usage reported by a provider for one completion.
+type Usage struct {
+	InputTokens  int
+	OutputTokens int
+}
+
+// UsageTracker adds up the token usage of the completions made with a context
+// returned by WithUsageTracker.
+type UsageTracker struct {
+	mu    sync.Mutex
+	usage Usage
+}
+
+type usageTrackerKey struct{}
+
+// WithUsageTracker returns a context whose completions are counted by the returned tracker.
+func WithUsageTracker(ctx context.Context) (context.Context, *UsageTracker) {
+	tracker := &UsageTracker{}
+	return context.WithValue(ctx, usageTrackerKey{}, tracker), tracker
+}
+
+// Add records the usage of one completion.
+func (t *UsageTracker) Add(usage Usage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.usage.InputTokens += usage.InputTokens
+	t.usage.OutputTokens += usage.OutputTokens
+}
+
+// Usage returns the usage recorded so far.
+func (t *UsageTracker) Usage() Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.usage
+}
+
+// Total returns the number of input and output tokens recorded so far.
+func (u Usage) Total() int {
+	return u.InputTokens + u.OutputTokens
+}
+
+// instrumentCompletion runs a provider call inside the tracing span, logs, LLM
+// metrics and generation run log shared by every provider. system names the
+// provider in the span attributes.
+func instrumentCompletion(ctx context.Context, system string, modelID string, messages []Message, call func(ctx context.Context) (string, Usage, error)) (_ string, err error) {
+	requestID := fmt.Sprintf("%d", time.Now().UnixNano())
+
+	ctx, span := tracing.Tracer().Start(ctx, "ai.RequestChatCompletion",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("gen_ai.system", system),
+			attribute.String("gen_ai.request.model", modelID),
+		),
+	)
+	slog.InfoContext(ctx, "Starting RequestChatCompletion", "provider", system, "requestID", requestID)
+
+	start := time.Now()
+	var raw string
+	var usage Usage
+	defer func() {
+		metrics.ObserveLLMRequest(modelID, time.Since(start), err)
+		logExchange(ctx, system, modelID, messages, raw, usage, time.Since(start), err)
+		tracing.End(span, err)
+	}()
+
+	raw, usage, err = call(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	metrics.AddLLMTokens(modelID, usage.InputTokens, usage.OutputTokens)
+	if tracker, ok := ctx.Value(usageTrackerKey{}).(*UsageTracker); ok {
+		tracker.Add(usage)
+	}
+	span.SetAttributes(
+		attribute.Int("gen_ai.usage.input_tokens", usage.InputTokens),
+		attribute.Int("gen_ai.usage.output_tokens", usage.OutputTokens),
+	)
+
+	slog.InfoContext(ctx, "Completed RequestChatCompletion", "provider", system, "requestID", requestID)
+	return raw, nil
+}
+
+// postJSON sends payload as JSON to url and decodes a 200 response into result.
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, payload any, result any) error {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payloadBytes))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("non-200 response: %d - %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// FakeCall records a single request received by a FakeProvider.
+type FakeCall struct {
+	Messages []Message
+	ModelID  string
+	Options  CompletionOptions
+}
+
+// FakeProvider is an in-process LLMProvider for tests and offline dry runs.
+// Respond decides the reply for each request; when nil, DefaultFakeResponse is returned.
+type FakeProvider struct {
+	Respond func(messages []Message, modelID string) (string, error)
+
+	mu    sync.Mutex
+	calls []FakeCall
+}
+
+// DefaultFakeResponse is a well-formed generation response with a single component.
+const DefaultFakeResponse = `{"components":[{"title":"Email Field","type":"Input","code":"<label for=\"email\">Email</label><input id=\"email\" type=\"email\">"}]}`
+
+// RequestChatCompletion records the call and returns the configured reply.
+func (p *FakeProvider) RequestChatCompletion(ctx context.Context, messages []Message, modelID string, opts CompletionOptions) (string, error) {
+	p.mu.Lock()
+	p.calls = append(p.calls, FakeCall{Messages: messages, ModelID: modelID, Options: opts})
+	p.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	reply, err := DefaultFakeResponse, error(nil)
+	if p.Respond != nil {
+		reply, err = p.Respond(messages, modelID)
+	}
+	logExchange(ctx, "fake", modelID, messages, reply, Usage{}, 0, err)
+	return reply, err
+}
+
+// Calls returns a copy of the requests received so far.
+func (p *FakeProvider) Calls() []FakeCall {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]FakeCall(nil), p.calls...)
+}
@@ -0,0 +1,240 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testImage = "data:image/png;base64,aGVsbG8="
+
+var testMessages = []Message{
+	SystemMessage("You generate UI."),
+	UserMessage(TextPart("Build this form"), ImagePart(testImage)),
+}
+
+// captureServer serves reply on path and stores the decoded request body and headers.
+func captureServer(t *testing.T, path string, reply string, body *map[string]any, header *http.Header) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, path, r.URL.Path)
+		*header = r.Header.Clone()
+		require.NoError(t, json.NewDecoder(r.Body).Decode(body))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(reply))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOpenAIProviderRequestFormat(t *testing.T) {
+	var body map[string]any
+	var header http.Header
+	server := captureServer(t, "/v1/chat/completions",
+		`{"choices":[{"message":{"content":"done"}}],"usage":{"prompt_tokens":3,"completion_tokens":1}}`, &body, &header)
+
+	content, err := NewOpenAIProvider("key", server.URL, server.Client()).RequestChatCompletion(context.Background(), testMessages, "gpt-4o", CompletionOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "done", content)
+
+	assert.Equal(t, "Bearer key", header.Get("Authorization"))
+	assert.Equal(t, "gpt-4o", body["model"])
+	messages := body["messages"].([]any)
+	assert.Equal(t, map[string]any{"role": "system", "content": "You generate UI."}, messages[0])
+	assert.Equal(t, []any{
+		map[string]any{"type": "text", "text": "Build this form"},
+		map[string]any{"type": "image_url", "image_url": map[string]any{"url": testImage}},
+	}, messages[1].(map[string]any)["content"])
+}
+
+func TestAnthropicProviderRequestFormat(t *testing.T) {
+	var body map[string]any
+	var header http.Header
+	server := captureServer(t, "/v1/messages",
+		`{"content":[{"type":"text","text":"do"},{"type":"text","text":"ne"}],"usage":{"input_tokens":3,"output_tokens":1}}`, &body, &header)
+
+	content, err := NewAnthropicProvider("key", server.URL, server.Client()).RequestChatCompletion(context.Background(), testMessages, "claude-model", CompletionOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "done", content)
+
+	assert.Equal(t, "key", header.Get("x-api-key"))
+	assert.Equal(t, anthropicVersion, header.Get("anthropic-version"))
+	assert.Equal(t, "You generate UI.", body["system"])
+	assert.EqualValues(t, anthropicMaxTokens, body["max_tokens"])
+	assert.Equal(t, []any{map[string]any{"role": "user", "content": []any{
+		map[string]any{"type": "text", "text": "Build this form"},
+		map[string]any{"type": "image", "source": map[string]any{"type": "base64", "media_type": "image/png", "data": "aGVsbG8="}},
+	}}}, body["messages"])
+}
+
+func TestOllamaProviderRequestFormat(t *testing.T) {
+	var body map[string]any
+	var header http.Header
+	server := captureServer(t, "/api/chat",
+		`{"message":{"role":"assistant","content":"done"},"prompt_eval_count":3,"eval_count":1}`, &body, &header)
+
+	content, err := NewOllamaProvider(server.URL, server.Client()).RequestChatCompletion(context.Background(), testMessages, "llava", CompletionOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "done", content)
+
+	assert.Equal(t, false, body["stream"])
+	assert.Equal(t, []any{
+		map[string]any{"role": "system", "content": "You generate UI."},
+		map[string]any{"role": "user", "content": "Build this form", "images": []any{"aGVsbG8="}},
+	}, body["messages"])
+}
+
+// testOptions sets every completion option so each provider's mapping can be checked.
+func testOptions() CompletionOptions {
+	temperature, topP, seed, fallbacks := 0.3, 0.9, 7, false
+	return CompletionOptions{
+		Temperature:    &temperature,
+		MaxTokens:      2048,
+		TopP:           &topP,
+		Seed:           &seed,
+		Stop:           []string{"</html>"},
+		ResponseFormat: ResponseFormatJSON,
+		Routing:        &RoutingPreferences{Order: []string{"anthropic"}, AllowFallbacks: &fallbacks, DataCollection: "deny"},
+	}
+}
+
+func TestOpenRouterProviderSendsOptions(t *testing.T) {
+	var body map[string]any
+	var header http.Header
+	server := captureServer(t, "/v1/chat/completions", `{"choices":[{"message":{"content":"done"}}]}`, &body, &header)
+
+	_, err := NewOpenRouterProvider("key", server.URL, server.Client()).RequestChatCompletion(context.Background(), testMessages, "openai/gpt-4o", testOptions())
+	require.NoError(t, err)
+
+	assert.Equal(t, 0.3, body["temperature"])
+	assert.EqualValues(t, 2048, body["max_tokens"])
+	assert.Equal(t, 0.9, body["top_p"])
+	assert.EqualValues(t, 7, body["seed"])
+	assert.Equal(t, []any{"</html>"}, body["stop"])
+	assert.Equal(t, map[string]any{"type": "json_object"}, body["response_format"])
+	assert.Equal(t, map[string]any{"order": []any{"anthropic"}, "allow_fallbacks": false, "data_collection": "deny"}, body["provider"])
+}
+
+func TestOpenAIProviderDropsRouting(t *testing.T) {
+	var body map[string]any
+	var header http.Header
+	server := captureServer(t, "/v1/chat/completions", `{"choices":[{"message":{"content":"done"}}]}`, &body, &header)
+
+	_, err := NewOpenAIProvider("key", server.URL, server.Client()).RequestChatCompletion(context.Background(), testMessages, "gpt-4o", testOptions())
+	require.NoError(t, err)
+
+	assert.Equal(t, 0.3, body["temperature"])
+	assert.NotContains(t, body, "provider")
+}
+
+func TestAnthropicProviderSendsOptions(t *testing.T) {
+	var body map[string]any
+	var header http.Header
+	server := captureServer(t, "/v1/messages", `{"content":[{"type":"text","text":"done"}]}`, &body, &header)
+
+	_, err := NewAnthropicProvider("key", server.URL, server.Client()).RequestChatCompletion(context.Background(), testMessages, "claude-model", testOptions())
+	require.NoError(t, err)
+
+	assert.EqualValues(t, 2048, body["max_tokens"])
+	assert.Equal(t, 0.3, body["temperature"])
+	assert.Equal(t, 0.9, body["top_p"])
+	assert.Equal(t, []any{"</html>"}, body["stop_sequences"])
+	assert.NotContains(t, body, "seed")
+	assert.NotContains(t, body, "response_format")
+}
+
+func TestAnthropicProviderClampsTemperature(t *testing.T) {
+	var body map[string]any
+	var header http.Header
+	server := captureServer(t, "/v1/messages", `{"content":[{"type":"text","text":"done"}]}`, &body, &header)
+
+	_, err := NewAnthropicProvider("key", server.URL, server.Client()).RequestChatCompletion(context.Background(), testMessages, "claude-model", CompletionOptions{Temperature: floatPtr(1.6)})
+	require.NoError(t, err)
+
+	assert.Equal(t, AnthropicMaxTemperature, body["temperature"])
+}
+
+func TestOllamaProviderSendsOptions(t *testing.T) {
+	var body map[string]any
+	var header http.Header
+	server := captureServer(t, "/api/chat", `{"message":{"role":"assistant","content":"done"}}`, &body, &header)
+
+	_, err := NewOllamaProvider(server.URL, server.Client()).RequestChatCompletion(context.Background(), testMessages, "llava", testOptions())
+	require.NoError(t, err)
+
+	assert.Equal(t, "json", body["format"])
+	assert.Equal(t, map[string]any{
+		"temperature": 0.3,
+		"num_predict": float64(2048),
+		"top_p":       0.9,
+		"seed":        float64(7),
+		"stop":        []any{"</html>"},
+	}, body["options"])
+}
+
+func TestOllamaProviderRejectsRemoteImages(t *testing.T) {
+	messages := []Message{UserMessage(TextPart("Build this"), ImagePart("https://example.com/sketch.png"))}
+
+	_, err := NewOllamaProvider("http://127.0.0.1:0", http.DefaultClient).RequestChatCompletion(context.Background(), messages, "llava", CompletionOptions{})
+	assert.ErrorContains(t, err, "inline images")
+}
+
+func TestProviderReportsNon200(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	_, err := NewAnthropicProvider("key", server.URL, server.Client()).RequestChatCompletion(context.Background(), testMessages, "claude-model", CompletionOptions{})
+	assert.ErrorContains(t, err, "429")
+}
+
+func TestNewProviderRejectsUnknownName(t *testing.T) {
+	_, err := NewProvider("bard", http.DefaultClient)
+	assert.Error(t, err)
+
+	provider, err := NewProvider("", http.DefaultClient)
+	require.NoError(t, err)
+	assert.IsType(t, &OpenRouterProvider{}, provider)
+}
+
+func TestNewProviderWithKeyOverridesSharedKey(t *testing.T) {
+	t.Setenv("OPENROUTER_API_KEY", "shared-key")
+
+	shared, err := NewProvider(ProviderOpenRouter, http.DefaultClient)
+	require.NoError(t, err)
+	assert.Equal(t, "shared-key", shared.(*OpenRouterProvider).APIKey)
+
+	own, err := NewProviderWithKey(ProviderOpenRouter, "user-key", http.DefaultClient)
+	require.NoError(t, err)
+	assert.Equal(t, "user-key", own.(*OpenRouterProvider).APIKey)
+
+	assert.True(t, UsesAPIKey(ProviderAnthropic))
+	assert.False(t, UsesAPIKey(ProviderOllama))
+}
+
+func TestDefaultModelFor(t *testing.T) {
+	assert.Equal(t, DefaultModelID, DefaultModelFor(ProviderOpenRouter))
+	assert.Equal(t, DefaultModelID, DefaultModelFor("fake"))
+	for _, provider := range []string{ProviderOpenAI, ProviderAnthropic, ProviderOllama} {
+		assert.NotEqual(t, DefaultModelID, DefaultModelFor(provider), provider)
+	}
+}
+
+func TestSetDefaultModelFor(t *testing.T) {
+	t.Cleanup(func() { SetDefaultModel(DefaultModelID) })
+
+	SetDefaultModelFor(ProviderAnthropic, "")
+	assert.Equal(t, DefaultModelFor(ProviderAnthropic), DefaultModel())
+
+	SetDefaultModelFor(ProviderOllama, "llava")
+	assert.Equal(t, "llava", DefaultModel())
+
+	SetDefaultModelFor("", "")
+	assert.Equal(t, DefaultModelID, DefaultModel())
+}
@@ -0,0 +1,84 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"sketch-to-ui-final-proj/metrics"
+)
+
+// Outcomes of RepairHTML, as counted by metrics.ObserveHTMLRepair.
+const (
+	repairValid      = "valid"
+	repairFixed      = "fixed"
+	repairRepaired   = "model_repaired"
+	repairUnrepaired = "unrepaired"
+)
+
+// RepairHTML verifies the code of a component before it is stored. Problems with a
+// deterministic fix are fixed by FixHTML; the rest are sent to the model for repair.
+// It returns the best code found and the problems still left in it, which are
+// empty when the code is valid.
+func RepairHTML(ctx context.Context, component UIComponentDTO, provider LLMProvider, settings GenerationSettings) (string, []string) {
+	code := component.Code
+	if len(VerifyHTML(code)) == 0 {
+		metrics.ObserveHTMLRepair(repairValid)
+		return code, nil
+	}
+
+	fixed, fixes := FixHTML(code)
+	problems := VerifyHTML(fixed)
+	if len(problems) == 0 {
+		slog.InfoContext(ctx, "Fixed component HTML", "title", component.Title, "fixes", fixes)
+		metrics.ObserveHTMLRepair(repairFixed)
+		return fixed, nil
+	}
+
+	resp, err := UpdateCode(ctx, repairInstructions(component, problems), fixed, provider, settings)
+	if err == nil && resp.FailureResponse != "" {
+		err = fmt.Errorf("model declined the repair: %s", resp.FailureResponse)
+	}
+	if err == nil {
+		repaired, _ := FixHTML(resp.Component.Code)
+		if remaining := VerifyHTML(repaired); len(remaining) < len(problems) {
+			fixed, problems = repaired, remaining
+		}
+	}
+
+	if len(problems) == 0 {
+		slog.InfoContext(ctx, "Repaired component HTML with the model", "title", component.Title)
+		metrics.ObserveHTMLRepair(repairRepaired)
+		return fixed, nil
+	}
+
+	slog.WarnContext(ctx, "Component HTML could not be repaired", "title", component.Title, "problems", problems, "error", err)
+	metrics.ObserveHTMLRepair(repairUnrepaired)
+	return fixed, problems
+}
+
+// RepairComponents runs RepairHTML over every component of a hierarchy in place: the
+// code of each leaf and the wrapper markup of each page or section that has one.
+func RepairComponents(ctx context.Context, components []UIComponentDTO, provider LLMProvider, settings GenerationSettings) {
+	for i := range components {
+		c := &components[i]
+		if len(c.Children) > 0 {
+			RepairComponents(ctx, c.Children, provider, settings)
+			// A page or section without wrapper markup is just its children
+			if c.Code == "" {
+				continue
+			}
+		}
+		c.Code, _ = RepairHTML(ctx, *c, provider, settings)
+	}
+}
+
+// repairInstructions asks the model to fix the problems left after FixHTML.
+func repairInstructions(component UIComponentDTO, problems []string) string {
+	if len(problems) == 1 && problems[0] == "empty output" {
+		return fmt.Sprintf("The %q component (%s) has no code. Write its HTML, with any CSS in a style tag above the HTML.", component.Title, component.Type)
+	}
+	return fmt.Sprintf("Fix only these HTML problems and change nothing else. Return a fragment without <html>, <head> or <body> tags.\n- %s",
+		strings.Join(problems, "\n- "))
+}
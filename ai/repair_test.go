@@ -0,0 +1,54 @@
+package ai
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepairHTMLFixesWithoutTheModel(t *testing.T) {
+	provider := &FakeProvider{}
+
+	code, problems := RepairHTML(context.Background(), UIComponentDTO{Title: "Card", Code: "<body><div>Hi</body>"}, provider, GenerationSettings{})
+	assert.Equal(t, "<div>Hi</div>", code)
+	assert.Empty(t, problems)
+	assert.Empty(t, provider.Calls())
+}
+
+func TestRepairHTMLSendsTheRestToTheModel(t *testing.T) {
+	provider := &FakeProvider{Respond: func(messages []Message, modelID string) (string, error) {
+		return `{"component":{"title":"Card","type":"Card","code":"<div>Card</div>"}}`, nil
+	}}
+
+	code, problems := RepairHTML(context.Background(), UIComponentDTO{Title: "Card", Type: "Card"}, provider, GenerationSettings{})
+	assert.Equal(t, "<div>Card</div>", code)
+	assert.Empty(t, problems)
+
+	calls := provider.Calls()
+	require.Len(t, calls, 1)
+	assert.Contains(t, calls[0].Messages[1].Text(), `The "Card" component (Card) has no code`)
+}
+
+func TestRepairHTMLKeepsBestCodeWhenTheModelFails(t *testing.T) {
+	provider := &FakeProvider{Respond: func(messages []Message, modelID string) (string, error) {
+		return "not json", nil
+	}}
+
+	code, problems := RepairHTML(context.Background(), UIComponentDTO{Title: "Card", Code: "  "}, provider, GenerationSettings{})
+	assert.Equal(t, "  ", code)
+	assert.Equal(t, []string{"empty output"}, problems)
+}
+
+func TestRepairComponentsSkipsEmptyTemplates(t *testing.T) {
+	provider := &FakeProvider{}
+	components := []UIComponentDTO{{Title: "Page", Children: []UIComponentDTO{
+		{Title: "Header", Code: "<header><h1>Hi</header>"},
+	}}}
+
+	RepairComponents(context.Background(), components, provider, GenerationSettings{})
+	assert.Empty(t, components[0].Code)
+	assert.Equal(t, "<header><h1>Hi</h1></header>", components[0].Children[0].Code)
+	assert.Empty(t, provider.Calls())
+}
@@ -0,0 +1,186 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"sketch-to-ui-final-proj/metrics"
+)
+
+// GenerationRun is one model exchange as kept in the generation log: the exact
+// request, the raw and cleaned reply and how parsing it went.
+type GenerationRun struct {
+	ID        int
+	Operation string
+	Provider  string
+	ModelID   string
+	Settings  GenerationSettings
+	Messages  []Message
+
+	RawResponse     string
+	CleanedResponse string
+
+	// ParseOutcome is "parsed" or "parse_error", or empty when the reply was never parsed
+	ParseOutcome string
+	ParseError   string
+	Error        string
+
+	Latency   time.Duration
+	Usage     Usage
+	ReplayOf  int
+	CreatedAt time.Time
+}
+
+// RunRecorder stores the exchanges made by one generation, code update or replay.
+// It sets the ID of each stored run.
+type RunRecorder interface {
+	RecordRuns(ctx context.Context, runs []*GenerationRun) error
+}
+
+var runRecorder RunRecorder
+
+// SetRunRecorder sets where model exchanges are logged. Without a recorder nothing
+// is logged.
+func SetRunRecorder(recorder RunRecorder) {
+	runRecorder = recorder
+}
+
+// runLog collects the exchanges of one operation until they are recorded.
+type runLog struct {
+	mu        sync.Mutex
+	operation string
+	settings  GenerationSettings
+	replayOf  int
+	runs      []*GenerationRun
+}
+
+type runLogKey struct{}
+
+// startRunLog returns a context whose model exchanges are logged as operation, and
+// the function that records them. An operation started inside another one, like a
+// part regeneration, shares the outer log.
+func startRunLog(ctx context.Context, operation string, settings GenerationSettings) (context.Context, func()) {
+	if runRecorder == nil {
+		return ctx, func() {}
+	}
+	if _, ok := ctx.Value(runLogKey{}).(*runLog); ok {
+		return ctx, func() {}
+	}
+
+	log := &runLog{operation: operation, settings: settings}
+	if replayOf, ok := ctx.Value(replayKey{}).(int); ok {
+		log.replayOf = replayOf
+	}
+	ctx = context.WithValue(ctx, runLogKey{}, log)
+
+	return ctx, func() {
+		log.mu.Lock()
+		runs := log.runs
+		log.runs = nil
+		log.mu.Unlock()
+		if len(runs) == 0 {
+			return
+		}
+		// The exchanges are worth keeping even when the request was cancelled
+		if err := runRecorder.RecordRuns(context.WithoutCancel(ctx), runs); err != nil {
+			slog.ErrorContext(ctx, "Failed to record generation runs", "operation", operation, "error", err)
+		}
+	}
+}
+
+// logExchange adds a finished provider call to the run log of ctx, if any.
+func logExchange(ctx context.Context, system string, modelID string, messages []Message, response string, usage Usage, latency time.Duration, err error) {
+	log, ok := ctx.Value(runLogKey{}).(*runLog)
+	if !ok {
+		return
+	}
+
+	run := &GenerationRun{
+		Operation:   log.operation,
+		Provider:    system,
+		ModelID:     modelID,
+		Settings:    log.settings,
+		Messages:    messages,
+		RawResponse: response,
+		Latency:     latency,
+		Usage:       usage,
+		ReplayOf:    log.replayOf,
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	log.mu.Lock()
+	log.runs = append(log.runs, run)
+	log.mu.Unlock()
+}
+
+// observeParse counts the parse outcome of the latest reply for operation and
+// records it, with the cleaned reply, on the latest logged exchange.
+func observeParse(ctx context.Context, operation string, cleanResponse string, err error) {
+	metrics.ObserveGenerationParse(operation, err)
+
+	log, ok := ctx.Value(runLogKey{}).(*runLog)
+	if !ok {
+		return
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	if len(log.runs) == 0 {
+		return
+	}
+
+	run := log.runs[len(log.runs)-1]
+	run.CleanedResponse = cleanResponse
+	run.ParseOutcome = "parsed"
+	if err != nil {
+		run.ParseOutcome = "parse_error"
+		run.ParseError = err.Error()
+	}
+}
+
+type replayKey struct{}
+
+// ReplayRun sends the exact messages of a logged run again, to modelID or to the
+// model of the run when modelID is empty. The replay is logged as a new run that
+// points back to the original, and returned with its ID set.
+func ReplayRun(ctx context.Context, run GenerationRun, modelID string, provider LLMProvider) (*GenerationRun, error) {
+	if runRecorder == nil {
+		return nil, errors.New("generation runs are not being recorded")
+	}
+	if modelID == "" {
+		modelID = run.ModelID
+	}
+	settings := run.Settings
+	settings.ModelID = modelID
+
+	ctx = context.WithValue(ctx, replayKey{}, run.ID)
+	ctx, flush := startRunLog(ctx, "replay", settings)
+	log := ctx.Value(runLogKey{}).(*runLog)
+
+	response, err := provider.RequestChatCompletion(ctx, run.Messages, modelID, settings.Options)
+	if err == nil {
+		cleanResponse := cleanLLMResponse(response)
+		var parsed any
+		observeParse(ctx, "replay", cleanResponse, json.Unmarshal([]byte(cleanResponse), &parsed))
+	}
+
+	// Keep the logged run before the log is emptied by recording it
+	var replay *GenerationRun
+	log.mu.Lock()
+	if len(log.runs) > 0 {
+		replay = log.runs[len(log.runs)-1]
+	}
+	log.mu.Unlock()
+	flush()
+
+	if replay == nil {
+		return nil, fmt.Errorf("failed to replay run %d: %w", run.ID, err)
+	}
+	return replay, nil
+}
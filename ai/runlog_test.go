@@ -0,0 +1,119 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryRecorder keeps recorded runs in memory and numbers them from 1.
+type memoryRecorder struct {
+	mu      sync.Mutex
+	runs    []GenerationRun
+	batches int
+}
+
+func (r *memoryRecorder) RecordRuns(ctx context.Context, runs []*GenerationRun) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches++
+	for _, run := range runs {
+		run.ID = len(r.runs) + 1
+		r.runs = append(r.runs, *run)
+	}
+	return nil
+}
+
+func useRecorder(t *testing.T) *memoryRecorder {
+	recorder := &memoryRecorder{}
+	SetRunRecorder(recorder)
+	t.Cleanup(func() { SetRunRecorder(nil) })
+	return recorder
+}
+
+func TestGenerateUICodeLogsRun(t *testing.T) {
+	recorder := useRecorder(t)
+	provider := &FakeProvider{Respond: func(messages []Message, modelID string) (string, error) {
+		return "```json\n" + DefaultFakeResponse + "\n```", nil
+	}}
+
+	_, err := GenerateUICode(context.Background(), "Build this", "data:image/png;base64,aGVsbG8=", provider, GenerationSettings{ModelID: "test/model"})
+	require.NoError(t, err)
+
+	require.Len(t, recorder.runs, 1)
+	run := recorder.runs[0]
+	assert.Equal(t, "generate", run.Operation)
+	assert.Equal(t, "test/model", run.ModelID)
+	assert.Equal(t, PipelineDirect, run.Settings.Pipeline)
+	assert.Len(t, run.Messages, 2)
+	assert.Contains(t, run.RawResponse, "```json")
+	assert.Equal(t, DefaultFakeResponse, run.CleanedResponse)
+	assert.Equal(t, "parsed", run.ParseOutcome)
+}
+
+func TestRunLogRecordsFailures(t *testing.T) {
+	recorder := useRecorder(t)
+
+	provider := &FakeProvider{Respond: func(messages []Message, modelID string) (string, error) {
+		return "not json", nil
+	}}
+	_, err := UpdateCode(context.Background(), "Make it blue", "<p>Hi</p>", provider, GenerationSettings{})
+	require.Error(t, err)
+
+	provider = &FakeProvider{Respond: func(messages []Message, modelID string) (string, error) {
+		return "", errors.New("rate limited")
+	}}
+	_, err = UpdateCode(context.Background(), "Make it blue", "<p>Hi</p>", provider, GenerationSettings{})
+	require.Error(t, err)
+
+	require.Len(t, recorder.runs, 2)
+	assert.Equal(t, "parse_error", recorder.runs[0].ParseOutcome)
+	assert.NotEmpty(t, recorder.runs[0].ParseError)
+	assert.Equal(t, "rate limited", recorder.runs[1].Error)
+	assert.Empty(t, recorder.runs[1].ParseOutcome)
+}
+
+func TestAgentPipelineLogsEveryStepTogether(t *testing.T) {
+	recorder := useRecorder(t)
+	provider := agentProvider(t, agentFixedReply, `{"missing":[],"problems":[],"done":true}`)
+
+	_, err := GenerateUICode(context.Background(), "Build this", "data:image/png;base64,aGVsbG8=", provider, GenerationSettings{Pipeline: PipelineAgent})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, recorder.batches)
+	require.Len(t, recorder.runs, 5)
+	for _, run := range recorder.runs {
+		assert.Equal(t, "generate", run.Operation)
+		assert.Equal(t, "parsed", run.ParseOutcome)
+	}
+}
+
+func TestReplayRun(t *testing.T) {
+	recorder := useRecorder(t)
+	provider := &FakeProvider{}
+
+	original := GenerationRun{
+		ID:       7,
+		ModelID:  "old/model",
+		Settings: GenerationSettings{ModelID: "old/model", PromptVersion: "v2"},
+		Messages: []Message{SystemMessage("system"), UserMessage(TextPart("Build this"))},
+	}
+
+	replay, err := ReplayRun(context.Background(), original, "new/model", provider)
+	require.NoError(t, err)
+	assert.Equal(t, 1, replay.ID)
+	assert.Equal(t, 7, replay.ReplayOf)
+	assert.Equal(t, "replay", replay.Operation)
+	assert.Equal(t, "new/model", replay.ModelID)
+	assert.Equal(t, "v2", replay.Settings.PromptVersion)
+	assert.Equal(t, "parsed", replay.ParseOutcome)
+
+	calls := provider.Calls()
+	require.Len(t, calls, 1)
+	assert.Equal(t, original.Messages, calls[0].Messages)
+	assert.Len(t, recorder.runs, 1)
+}
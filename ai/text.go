@@ -0,0 +1,57 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// GenerateUICodeFromText generates UI code from a written description alone, for
+// users who want a component without drawing it first. The settings' pipeline is
+// ignored: the layout and agent pipelines both start from a sketch.
+func GenerateUICodeFromText(ctx context.Context, description string, provider LLMProvider, settings GenerationSettings) (UIGenerationResponse, error) {
+	settings.Pipeline = PipelineDirect
+	settings = settings.Resolved()
+	prompts, err := Prompts(settings.PromptVersion)
+	if err != nil {
+		return UIGenerationResponse{}, err
+	}
+
+	ctx, recordRuns := startRunLog(ctx, "generate_text", settings)
+	defer recordRuns()
+
+	messages := []Message{
+		SystemMessage(prompts.GenerateText),
+		UserMessage(TextPart(descriptionOpenTag + "\n" + escapeDelimiters(description) + "\n" + descriptionCloseTag)),
+	}
+	response, err := provider.RequestChatCompletion(ctx, messages, settings.ModelID, settings.Options)
+	if err != nil {
+		return UIGenerationResponse{}, fmt.Errorf("failed to generate response from provider: %w", err)
+	}
+
+	return parseGenerationResponse(ctx, response)
+}
+
+// RefineWithSketch updates the code of a component, typically one generated from text,
+// so that it matches a sketch drawn later. instructions may be empty.
+func RefineWithSketch(ctx context.Context, instructions string, code string, imageBase64URI string, provider LLMProvider, settings GenerationSettings) (CodeUpdateResponse, error) {
+	settings = settings.Resolved()
+	prompts, err := Prompts(settings.PromptVersion)
+	if err != nil {
+		return CodeUpdateResponse{}, err
+	}
+
+	ctx, recordRuns := startRunLog(ctx, "refine_sketch", settings)
+	defer recordRuns()
+
+	if instructions == "" {
+		instructions = "Match the sketch."
+	}
+	content, removed := updateCodeContent(instructions, code)
+	if len(removed) > 0 {
+		slog.WarnContext(ctx, "Removed instruction-like comments from component code", "count", len(removed))
+	}
+	content = append(content, ImagePart(imageBase64URI))
+
+	return requestCodeUpdate(ctx, "refine_sketch", prompts.RefineSketch, content, provider, settings)
+}
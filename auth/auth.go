@@ -3,6 +3,7 @@ package auth
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
@@ -11,14 +12,21 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
+
+	"sketch-to-ui-final-proj/storage"
 )
 
 // DB connection (you should initialize this in main.go)
 var DB *sql.DB
 var sessionStore *SessionStore // Session store instance
+var avatars storage.BlobStore  // Blob storage for generated avatars
+
+// AvatarURLExpiry is how long the signed link an avatar is redirected to stays valid.
+const AvatarURLExpiry = time.Hour
 
-func Init(router *gin.Engine, db *sql.DB, secretKey string) {
+func Init(router *gin.Engine, db *sql.DB, secretKey string, blobs storage.BlobStore) {
 	DB = db
+	avatars = blobs
 	isProduction := os.Getenv("IS_PRODUCTION") == "true"
 	sessionStore = NewSessionStore("session-name", 24*time.Hour, secretKey, isProduction)
 	router.Use(SessionMiddleware(sessionStore))
@@ -32,6 +40,20 @@ func setupRoutes(router *gin.Engine) {
 	router.POST("/login", loginHandler)
 	router.GET("/logout", logoutHandler)
 	router.GET("/profile", AuthRequiredMiddleware(), profileHandler)
+	router.GET("/avatars/:file", avatarHandler)
+}
+
+// avatarHandler redirects to a signed link to the avatar in blob storage. Avatars are
+// shared by every user with the same initial, so they are not private.
+func avatarHandler(c *gin.Context) {
+	signedURL, err := avatars.SignedURL(c.Request.Context(), "avatars/"+c.Param("file"), AvatarURLExpiry)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	// Cache the redirect for a little less than the link stays valid
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int((AvatarURLExpiry-time.Minute).Seconds())))
+	c.Redirect(http.StatusFound, signedURL)
 }
 
 func signupFormHandler(c *gin.Context) {
@@ -67,9 +89,10 @@ func signupHandler(c *gin.Context) {
 		LastName:  form.LastName,
 		Email:     form.Email,
 		Password:  form.Password,
+		Role:      Regular,
 	}
 
-	avatarURI, err := user.generateAvatar()
+	avatarURI, err := user.generateAvatar(c.Request.Context(), avatars)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Could not generate avatar")
 		return
@@ -133,7 +156,7 @@ func loginHandler(c *gin.Context) {
 	slog.Info("User attempting login", "user", user)
 
 	var storedUser User
-	err := DB.QueryRow("SELECT id, first_name, email, password, avatar_uri FROM users WHERE email = $1", user.Email).Scan(&storedUser.ID, &storedUser.FirstName, &storedUser.Email, &storedUser.Password, &storedUser.AvatarURI)
+	err := DB.QueryRow("SELECT id, first_name, email, password, avatar_uri, user_role FROM users WHERE email = $1", user.Email).Scan(&storedUser.ID, &storedUser.FirstName, &storedUser.Email, &storedUser.Password, &storedUser.AvatarURI, &storedUser.Role)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.String(http.StatusUnauthorized, "Invalid credentials")
@@ -204,9 +227,9 @@ func RequireRole(requiredRole Role) gin.HandlerFunc {
 			return
 		}
 
-		// Type assert the user object to your User type
-		user, ok := userRaw.(User) // Replace `User` with your actual user struct type
-		if !ok {
+		// SessionMiddleware stores a *User in the context
+		user, ok := userRaw.(*User)
+		if !ok || user == nil {
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal error: invalid user type"})
 			return
 		}
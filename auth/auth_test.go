@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireRole(t *testing.T) {
+	store := setupSessionStore()
+	router := gin.New()
+	router.Use(SessionMiddleware(store))
+
+	router.GET("/set/:role", func(c *gin.Context) {
+		store.SetSession(c, &User{ID: 5, Role: Role(c.Param("role"))})
+		c.String(200, "session set")
+	})
+	router.GET("/admin", RequireRole(Admin), func(c *gin.Context) {
+		c.String(200, "admin area")
+	})
+
+	for _, tc := range []struct {
+		role string
+		want int
+	}{
+		{"admin", http.StatusOK},
+		{"member", http.StatusForbidden},
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/set/"+tc.role, nil)
+		router.ServeHTTP(w, req)
+
+		w2 := httptest.NewRecorder()
+		req2, _ := http.NewRequest("GET", "/admin", nil)
+		for _, cookie := range w.Result().Cookies() {
+			req2.AddCookie(cookie)
+		}
+		router.ServeHTTP(w2, req2)
+		assert.Equal(t, tc.want, w2.Code, "role %s", tc.role)
+	}
+
+	// No session at all
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/admin", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
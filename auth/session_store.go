@@ -46,6 +46,7 @@ func (s *SessionStore) SetSession(c *gin.Context, user *User) {
 	session.Values["avatarURI"] = user.AvatarURI
 	session.Values["firstName"] = user.FirstName
 	session.Values["lastName"] = user.LastName
+	session.Values["role"] = string(user.Role)
 
 	err = session.Save(c.Request, c.Writer) // Save session using gorilla/sessions
 	if err != nil {
@@ -85,6 +86,12 @@ func (s *SessionStore) GetSession(c *gin.Context) (*User, bool) {
 		user.LastName = lastName
 	}
 
+	// Restore Role, defaulting to a regular member for sessions created before roles existed
+	user.Role = Regular
+	if role, ok := session.Values["role"].(string); ok && role != "" {
+		user.Role = Role(role)
+	}
+
 	return &user, true
 }
 
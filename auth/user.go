@@ -1,15 +1,16 @@
 package auth
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"image/png"
-
-	"os"
-	"path/filepath"
 	"strconv"
 	"unicode/utf8"
 
 	"github.com/disintegration/letteravatar"
+
+	"sketch-to-ui-final-proj/storage"
 )
 
 type ID int
@@ -41,10 +42,13 @@ type User struct {
 	Email     string `db:"email"`
 	Password  string `db:"password"`
 	AvatarURI string `db:"avatar_uri"`
-	Role      Role  `db:"user_role"`
+	Role      Role   `db:"user_role"`
 }
 
-func (u *User) generateAvatar() (string, error) {
+// generateAvatar draws the user's initial and stores it in blob storage. It returns the
+// avatar's key, which is also its path below the /avatars/ route. Users with the same
+// initial share one avatar.
+func (u *User) generateAvatar(ctx context.Context, blobs storage.BlobStore) (string, error) {
 	firstLetter, _ := utf8.DecodeRuneInString(u.FirstName)
 
 	img, err := letteravatar.Draw(75, firstLetter, nil)
@@ -52,24 +56,14 @@ func (u *User) generateAvatar() (string, error) {
 		return "", err
 	}
 
-	// Create the avatars directory if it doesn't exist
-	avatarsDir := "./static/images/avatars"
-	err = os.MkdirAll(avatarsDir, os.ModePerm)
-	if err != nil {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
 		return "", err
 	}
 
-	// Save the image to the avatars directory
-	filename := fmt.Sprintf("%s-%s.png", u.FirstName, u.ID.String())
-	filepath := filepath.Join(avatarsDir, filename)
-	file, err := os.Create(filepath)
-	if err != nil {
-		return "", err
+	key := storage.ContentKey("avatars", buf.Bytes(), "image/png")
+	if err := blobs.Put(ctx, key, buf.Bytes(), "image/png"); err != nil {
+		return "", fmt.Errorf("failed to store avatar: %w", err)
 	}
-	err = png.Encode(file, img)
-	if err != nil {
-		return "", err
-	}
-
-	return filepath, nil
+	return key, nil
 }
@@ -0,0 +1,145 @@
+// Command eval runs a directory of sketches through the UI generator and scores
+// the output, or compares two saved runs.
+//
+//	go run ./cmd/eval run -dir ai/test_data -model google/gemini-2.0-flash-exp:free -out runs/base.json
+//	go run ./cmd/eval compare -base runs/base.json -candidate runs/new.json -out report.md
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	"sketch-to-ui-final-proj/ai"
+	"sketch-to-ui-final-proj/eval"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "run":
+		runCmd(os.Args[2:])
+	case "compare":
+		compareCmd(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: eval run [flags] | eval compare [flags]")
+	os.Exit(2)
+}
+
+func runCmd(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	dir := fs.String("dir", "ai/test_data", "directory of sketch images and optional <name>.json expectations")
+	providerName := fs.String("provider", "openrouter", "provider to evaluate: openrouter, openai, anthropic, ollama or fake")
+	model := fs.String("model", "", "model identifier (defaults to a vision model of the provider)")
+	promptVersion := fs.String("prompt-version", ai.DefaultPromptVersion, "prompt version to evaluate")
+	pipeline := fs.String("pipeline", ai.PipelineDirect, "generation pipeline: direct or layout")
+	label := fs.String("label", "", "label stored in the run (defaults to the model and prompt version)")
+	out := fs.String("out", "eval-run.json", "where to write the run JSON")
+	timeout := fs.Duration("timeout", 2*time.Minute, "timeout per sketch")
+	fs.Parse(args)
+
+	_ = godotenv.Load()
+
+	if *model == "" {
+		*model = ai.DefaultModelFor(*providerName)
+	}
+
+	provider, err := newProvider(*providerName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cases, err := eval.LoadCases(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(cases) == 0 {
+		log.Fatalf("no sketches found in %s", *dir)
+	}
+
+	if *label == "" {
+		*label = *model + "@" + *promptVersion
+		if *pipeline != ai.PipelineDirect {
+			*label += "+" + *pipeline
+		}
+	}
+
+	run, err := eval.RunCases(context.Background(), cases, provider, eval.Options{
+		Label:         *label,
+		Provider:      *providerName,
+		ModelID:       *model,
+		PromptVersion: *promptVersion,
+		Pipeline:      *pipeline,
+		Timeout:       *timeout,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := eval.WriteRun(*out, run); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%d cases, mean score %.3f, valid JSON %.0f%%, mean latency %dms -> %s\n",
+		run.Summary.Cases, run.Summary.MeanScore, 100*run.Summary.ValidJSONRate, run.Summary.MeanLatencyMS, *out)
+}
+
+func compareCmd(args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	basePath := fs.String("base", "", "baseline run JSON")
+	candidatePath := fs.String("candidate", "", "candidate run JSON")
+	out := fs.String("out", "", "where to write the Markdown report (stdout when empty)")
+	fs.Parse(args)
+
+	if *basePath == "" || *candidatePath == "" {
+		log.Fatal("both -base and -candidate are required")
+	}
+
+	base, err := eval.ReadRun(*basePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	candidate, err := eval.ReadRun(*candidatePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := eval.Compare(base, candidate).WriteMarkdown(w); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func newProvider(name string) (ai.LLMProvider, error) {
+	switch name {
+	case "fake":
+		return &ai.FakeProvider{}, nil
+	case ai.ProviderOpenRouter:
+		if os.Getenv("OPENROUTER_API_KEY") == "" || os.Getenv("OPENROUTER_BASE_URL") == "" {
+			return nil, fmt.Errorf("OPENROUTER_API_KEY and OPENROUTER_BASE_URL must be set")
+		}
+	}
+	return ai.NewProvider(name, &http.Client{Timeout: 2 * time.Minute})
+}
@@ -0,0 +1,3 @@
+ALTER TABLE uicomponents
+DROP COLUMN IF EXISTS prompt_version,
+DROP COLUMN IF EXISTS model_id;
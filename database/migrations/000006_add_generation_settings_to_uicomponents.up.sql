@@ -0,0 +1,4 @@
+-- Model and prompt version that produced the component
+ALTER TABLE uicomponents
+ADD COLUMN model_id VARCHAR(255) NOT NULL DEFAULT '',
+ADD COLUMN prompt_version VARCHAR(50) NOT NULL DEFAULT '';
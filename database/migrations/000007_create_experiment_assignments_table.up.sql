@@ -0,0 +1,14 @@
+CREATE TABLE experiment_assignments (
+    id SERIAL PRIMARY KEY,
+    experiment VARCHAR(255) NOT NULL,
+    arm VARCHAR(255) NOT NULL,
+    operation VARCHAR(50) NOT NULL,
+    model_id VARCHAR(255) NOT NULL,
+    prompt_version VARCHAR(50) NOT NULL,
+    component_id INTEGER NOT NULL REFERENCES uicomponents(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Covers: per-arm aggregation in the experiments report
+CREATE INDEX idx_experiment_assignments_experiment_arm ON experiment_assignments(experiment, arm);
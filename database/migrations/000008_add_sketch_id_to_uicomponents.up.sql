@@ -0,0 +1,3 @@
+-- Sketch the component was generated from (empty for components created before this column)
+ALTER TABLE uicomponents
+ADD COLUMN sketch_id VARCHAR(36) NOT NULL DEFAULT '';
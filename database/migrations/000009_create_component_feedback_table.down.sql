@@ -0,0 +1 @@
+DROP TABLE IF EXISTS component_feedback;
@@ -0,0 +1,19 @@
+-- One rating per user and component. The generation provenance and the code are
+-- copied at rating time so the dataset stays meaningful after later edits.
+CREATE TABLE component_feedback (
+    id SERIAL PRIMARY KEY,
+    component_id INTEGER NOT NULL REFERENCES uicomponents(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rating SMALLINT NOT NULL CHECK (rating IN (-1, 1)),
+    reason TEXT NOT NULL DEFAULT '',
+    model_id VARCHAR(255) NOT NULL DEFAULT '',
+    prompt_version VARCHAR(50) NOT NULL DEFAULT '',
+    sketch_id VARCHAR(36) NOT NULL DEFAULT '',
+    code TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (component_id, user_id)
+);
+
+-- Covers: ordered dataset export
+CREATE INDEX idx_component_feedback_created ON component_feedback(created_at);
@@ -0,0 +1,2 @@
+ALTER TABLE uicomponents
+DROP COLUMN IF EXISTS layout;
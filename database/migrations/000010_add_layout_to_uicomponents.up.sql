@@ -0,0 +1,3 @@
+-- Layout tree the component code was rendered from (NULL when the model wrote the code directly)
+ALTER TABLE uicomponents
+ADD COLUMN layout JSONB;
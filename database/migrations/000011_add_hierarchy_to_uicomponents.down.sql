@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_uicomponents_parent_id;
+
+ALTER TABLE uicomponents
+DROP COLUMN IF EXISTS template,
+DROP COLUMN IF EXISTS position,
+DROP COLUMN IF EXISTS parent_id;
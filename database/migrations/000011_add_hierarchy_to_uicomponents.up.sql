@@ -0,0 +1,9 @@
+-- Pages and sections are components whose children are stored as components with
+-- parent_id set. position orders siblings; template is the parent's own markup with
+-- the <!-- children --> slot, from which its code is composed.
+ALTER TABLE uicomponents
+ADD COLUMN parent_id INTEGER REFERENCES uicomponents(id) ON DELETE CASCADE,
+ADD COLUMN position INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN template TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_uicomponents_parent_id ON uicomponents (parent_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_generation_runs_created;
+DROP TABLE IF EXISTS generation_runs;
+DROP TABLE IF EXISTS generation_images;
@@ -0,0 +1,31 @@
+-- Images sent to the model, stored once and referenced from generation_runs.messages
+-- by their SHA-256 hash.
+CREATE TABLE generation_images (
+    hash VARCHAR(64) PRIMARY KEY,
+    data_uri TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One row per model exchange: the exact request, the raw and cleaned reply and how
+-- parsing it went. replay_of points to the run a replay re-executed.
+CREATE TABLE generation_runs (
+    id SERIAL PRIMARY KEY,
+    operation VARCHAR(50) NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    model_id VARCHAR(255) NOT NULL,
+    params JSONB NOT NULL DEFAULT '{}',
+    messages JSONB NOT NULL,
+    raw_response TEXT NOT NULL DEFAULT '',
+    cleaned_response TEXT NOT NULL DEFAULT '',
+    parse_outcome VARCHAR(20) NOT NULL DEFAULT '',
+    parse_error TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    latency_ms INTEGER NOT NULL DEFAULT 0,
+    input_tokens INTEGER NOT NULL DEFAULT 0,
+    output_tokens INTEGER NOT NULL DEFAULT 0,
+    replay_of INTEGER REFERENCES generation_runs(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Covers: newest first browsing in the admin UI
+CREATE INDEX idx_generation_runs_created ON generation_runs(created_at DESC);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS free_generation_usage;
+DROP TABLE IF EXISTS user_api_keys;
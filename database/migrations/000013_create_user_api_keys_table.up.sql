@@ -0,0 +1,18 @@
+-- API keys users bring for the configured AI provider, encrypted with AES-GCM under a
+-- key derived from the server secret. key_hint is the only part shown back.
+CREATE TABLE user_api_keys (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    encrypted_key BYTEA NOT NULL,
+    key_hint VARCHAR(16) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Generations each user made with the shared key, per day, for the free quota.
+CREATE TABLE free_generation_usage (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    generations INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, day)
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_sketches_owner;
+DROP TABLE IF EXISTS sketches;
@@ -0,0 +1,11 @@
+-- Uploaded sketches, kept across restarts. The in-memory cache only speeds up reads.
+CREATE TABLE sketches (
+    id VARCHAR(36) PRIMARY KEY,
+    owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    media_type VARCHAR(50) NOT NULL,
+    image BYTEA NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Covers: a user's sketches, newest first
+CREATE INDEX idx_sketches_owner ON sketches(owner_id, created_at DESC);
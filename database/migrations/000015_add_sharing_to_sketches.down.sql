@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS sketch_shares;
+ALTER TABLE sketches DROP COLUMN IF EXISTS is_public;
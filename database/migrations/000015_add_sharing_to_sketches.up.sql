@@ -0,0 +1,11 @@
+-- A public sketch can be viewed and generated from by every user
+ALTER TABLE sketches
+ADD COLUMN is_public BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Users a sketch was explicitly shared with by its owner
+CREATE TABLE sketch_shares (
+    sketch_id VARCHAR(36) NOT NULL REFERENCES sketches(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (sketch_id, user_id)
+);
@@ -0,0 +1,8 @@
+-- Sketches whose image is only in blob storage cannot be kept without it
+DELETE FROM sketches WHERE image IS NULL;
+
+DROP INDEX IF EXISTS idx_sketches_blob_key;
+ALTER TABLE sketches DROP CONSTRAINT IF EXISTS sketches_image_or_blob;
+ALTER TABLE sketches
+DROP COLUMN IF EXISTS blob_key,
+ALTER COLUMN image SET NOT NULL;
@@ -0,0 +1,11 @@
+-- New sketch images are kept in blob storage, named by their content hash. Sketches
+-- uploaded before keep their image bytes in the row.
+ALTER TABLE sketches
+ADD COLUMN blob_key VARCHAR(255),
+ALTER COLUMN image DROP NOT NULL;
+
+ALTER TABLE sketches
+ADD CONSTRAINT sketches_image_or_blob CHECK (image IS NOT NULL OR blob_key IS NOT NULL);
+
+-- Covers: whether a blob is still used by another sketch before it is deleted
+CREATE INDEX idx_sketches_blob_key ON sketches(blob_key);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_sketches_batch;
+ALTER TABLE sketches DROP COLUMN IF EXISTS batch_id;
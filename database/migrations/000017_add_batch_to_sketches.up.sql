@@ -0,0 +1,6 @@
+-- Sketches uploaded together in one request share a batch ID
+ALTER TABLE sketches
+ADD COLUMN batch_id VARCHAR(36);
+
+-- Covers: the sketches of a batch
+CREATE INDEX idx_sketches_batch ON sketches(batch_id) WHERE batch_id IS NOT NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_uicomponents_sketch_id;
+ALTER TABLE sketches DROP COLUMN IF EXISTS name;
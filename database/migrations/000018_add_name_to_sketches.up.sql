@@ -0,0 +1,6 @@
+-- Shown in the sketch library; set from the uploaded file name and renamed by the owner
+ALTER TABLE sketches
+ADD COLUMN name VARCHAR(255) NOT NULL DEFAULT '';
+
+-- Covers: the components generated from a sketch, shown next to it in the library
+CREATE INDEX idx_uicomponents_sketch_id ON uicomponents(sketch_id) WHERE sketch_id <> '';
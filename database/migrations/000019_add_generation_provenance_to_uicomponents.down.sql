@@ -0,0 +1,2 @@
+ALTER TABLE uicomponents DROP COLUMN IF EXISTS generated_at;
+ALTER TABLE uicomponents DROP COLUMN IF EXISTS generation_prompt;
@@ -0,0 +1,12 @@
+-- The instructions the user gave with the sketch or description; empty when the default prompt was used
+ALTER TABLE uicomponents
+ADD COLUMN generation_prompt TEXT NOT NULL DEFAULT '';
+
+-- When the code was last generated, as opposed to edited by hand (updated_at)
+ALTER TABLE uicomponents
+ADD COLUMN generated_at TIMESTAMP;
+
+UPDATE uicomponents SET generated_at = created_at;
+
+ALTER TABLE uicomponents
+ALTER COLUMN generated_at SET DEFAULT CURRENT_TIMESTAMP;
@@ -0,0 +1 @@
+ALTER TABLE sketches DROP COLUMN IF EXISTS vector;
@@ -0,0 +1,4 @@
+-- The shapes of a sketch drawn on the sketchpad, its canonical form; the image is rasterised from it.
+-- NULL for uploaded images.
+ALTER TABLE sketches
+ADD COLUMN vector JSONB;
@@ -0,0 +1,15 @@
+-- The images each run sent, so purging the runs past their retention finds the
+-- images no run refers to with a join instead of searching the messages.
+CREATE TABLE generation_run_images (
+    run_id INTEGER NOT NULL REFERENCES generation_runs(id) ON DELETE CASCADE,
+    hash VARCHAR(64) NOT NULL REFERENCES generation_images(hash) ON DELETE CASCADE,
+    PRIMARY KEY (run_id, hash)
+);
+
+-- Covers: the purge check whether an image is still referenced
+CREATE INDEX idx_generation_run_images_hash ON generation_run_images(hash);
+
+INSERT INTO generation_run_images (run_id, hash)
+SELECT r.id, i.hash
+FROM generation_runs r
+JOIN generation_images i ON strpos(r.messages::text, 'image:' || i.hash) > 0;
@@ -0,0 +1,98 @@
+package eval
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultPrompt is the user prompt sent with every sketch unless a case overrides it.
+const DefaultPrompt = "Analyze the following sketch image from the image url I sent and generate the corresponding UI component code (using  HTML and CSS in a style tag above the HTML code) in JSON format."
+
+// Expectations are the structural assertions for a single sketch. They are read
+// from a JSON file next to the image with the same base name (e.g. login.png + login.json).
+type Expectations struct {
+	// Prompt overrides DefaultPrompt for this sketch.
+	Prompt string `json:"prompt,omitempty"`
+
+	// ComponentTypes lists component types that must appear in the response (case-insensitive).
+	ComponentTypes []string `json:"component_types,omitempty"`
+
+	// MinComponents is the minimum number of components the response must contain.
+	MinComponents int `json:"min_components,omitempty"`
+
+	// Elements maps an HTML tag name to the minimum number of times it must appear
+	// across all generated components.
+	Elements map[string]int `json:"elements,omitempty"`
+}
+
+// Case is a sketch image together with its expectations.
+type Case struct {
+	Name      string
+	ImagePath string
+	Expect    Expectations
+}
+
+var imageExtensions = map[string]bool{
+	".png":  true,
+	".jpg":  true,
+	".jpeg": true,
+	".webp": true,
+	".gif":  true,
+}
+
+// LoadCases returns one case per image in dir, sorted by name. Images without an
+// expectations file are still scored on the generic checks.
+func LoadCases(dir string) ([]Case, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read case directory: %w", err)
+	}
+
+	var cases []Case
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || !imageExtensions[ext] {
+			continue
+		}
+
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		c := Case{Name: name, ImagePath: filepath.Join(dir, entry.Name())}
+
+		expectPath := filepath.Join(dir, name+".json")
+		data, err := os.ReadFile(expectPath)
+		if err == nil {
+			if err := json.Unmarshal(data, &c.Expect); err != nil {
+				return nil, fmt.Errorf("invalid expectations in %s: %w", expectPath, err)
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read %s: %w", expectPath, err)
+		}
+
+		cases = append(cases, c)
+	}
+
+	sort.Slice(cases, func(i, j int) bool { return cases[i].Name < cases[j].Name })
+	return cases, nil
+}
+
+// imageDataURI reads the case image and returns it as a base64 data URI.
+func (c Case) imageDataURI() (string, error) {
+	data, err := os.ReadFile(c.ImagePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image %s: %w", c.ImagePath, err)
+	}
+	return "data:" + http.DetectContentType(data) + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+func (c Case) prompt() string {
+	if c.Expect.Prompt != "" {
+		return c.Expect.Prompt
+	}
+	return DefaultPrompt
+}
@@ -0,0 +1,119 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sketch-to-ui-final-proj/ai"
+)
+
+func TestLoadCasesReadsExpectations(t *testing.T) {
+	cases, err := LoadCases("../ai/test_data")
+	require.NoError(t, err)
+	require.Len(t, cases, 1)
+
+	assert.Equal(t, "test_image1", cases[0].Name)
+	assert.Equal(t, []string{"Input"}, cases[0].Expect.ComponentTypes)
+	assert.Equal(t, 1, cases[0].Expect.Elements["input"])
+}
+
+func TestScoreCaseWellFormedAndAccessible(t *testing.T) {
+	c := Case{Name: "email", Expect: Expectations{
+		ComponentTypes: []string{"input"},
+		Elements:       map[string]int{"input": 1, "label": 1},
+	}}
+	resp := ai.UIGenerationResponse{Components: []ai.UIComponentDTO{{
+		Title: "Email", Type: "Input",
+		Code: `<label for="email">Email</label><input id="email" type="email">`,
+	}}}
+
+	result := scoreCase(c, resp, nil, 150*time.Millisecond)
+
+	assert.True(t, result.ValidJSON)
+	assert.True(t, result.HTMLWellFormed)
+	assert.Empty(t, result.MissingTypes)
+	assert.Empty(t, result.ElementMisses)
+	assert.Empty(t, result.A11yFindings)
+	assert.Equal(t, int64(150), result.LatencyMS)
+	assert.Equal(t, 1.0, result.Score)
+}
+
+func TestScoreCaseFindsProblems(t *testing.T) {
+	c := Case{Name: "broken", Expect: Expectations{Elements: map[string]int{"button": 1}}}
+	resp := ai.UIGenerationResponse{Components: []ai.UIComponentDTO{{
+		Type: "Form",
+		Code: `<div><input type="text"><img src="x.png"></span>`,
+	}}}
+
+	result := scoreCase(c, resp, nil, time.Second)
+
+	assert.False(t, result.HTMLWellFormed)
+	assert.Contains(t, result.HTMLProblems, "unexpected </span>")
+	assert.Contains(t, result.HTMLProblems, "unclosed <div>")
+	assert.Len(t, result.ElementMisses, 1)
+	assert.Contains(t, result.A11yFindings, "img without alt attribute")
+	assert.Contains(t, result.A11yFindings, "<input> without an associated label")
+	assert.Less(t, result.Score, 0.5)
+}
+
+func TestRunCasesWithFakeProvider(t *testing.T) {
+	cases, err := LoadCases("../ai/test_data")
+	require.NoError(t, err)
+
+	calls := 0
+	provider := &ai.FakeProvider{Respond: func(messages []ai.Message, modelID string) (string, error) {
+		calls++
+		if calls > 1 {
+			return "", errors.New("unexpected call")
+		}
+		return ai.DefaultFakeResponse, nil
+	}}
+
+	run, err := RunCases(context.Background(), cases, provider, Options{Label: "fake", Provider: "fake", ModelID: "fake/model"})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, run.Summary.Cases)
+	assert.Equal(t, 1.0, run.Summary.ValidJSONRate)
+	assert.Equal(t, "fake/model", provider.Calls()[0].ModelID)
+	assert.Equal(t, 1.0, run.Results[0].Score)
+}
+
+func TestCompareWritesReport(t *testing.T) {
+	base := Run{Label: "base", Results: []CaseResult{{Name: "a", Score: 0.5}, {Name: "b", Score: 1}}}
+	base.Summary = summarize(base.Results)
+	candidate := Run{Label: "candidate", Results: []CaseResult{{Name: "a", Score: 0.75}}}
+	candidate.Summary = summarize(candidate.Results)
+
+	cmp := Compare(base, candidate)
+	require.Len(t, cmp.Cases, 2)
+	assert.Equal(t, "base", cmp.Cases[1].OnlyIn)
+
+	var buf bytes.Buffer
+	require.NoError(t, cmp.WriteMarkdown(&buf))
+	assert.Contains(t, buf.String(), "| a | 0.500 | 0.750 | +0.250 |")
+	assert.Contains(t, buf.String(), "| b | | | only in base | | |")
+}
+
+func TestScoreCaseComposesPageHierarchy(t *testing.T) {
+	c := Case{Name: "page", Expect: Expectations{ComponentTypes: []string{"Form"}, MinComponents: 2, Elements: map[string]int{"button": 1}}}
+	resp := ai.UIGenerationResponse{Components: []ai.UIComponentDTO{{
+		Title: "Landing", Type: "Page", Code: "<main>" + ai.ChildrenSlot + "</main>",
+		Children: []ai.UIComponentDTO{
+			{Title: "Intro", Type: "Text", Code: "<p>Hi</p>"},
+			{Title: "Signup", Type: "Form", Code: "<form><button>Join</button></form>"},
+		},
+	}}}
+
+	result := scoreCase(c, resp, nil, 0)
+
+	assert.Equal(t, 2, result.Components)
+	assert.Empty(t, result.MissingTypes)
+	assert.True(t, result.HTMLWellFormed, result.HTMLProblems)
+	assert.Equal(t, 1, result.ElementCounts["button"])
+}
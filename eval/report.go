@@ -0,0 +1,111 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// CaseDelta compares one case between a baseline and a candidate run.
+type CaseDelta struct {
+	Name           string
+	BaseScore      float64
+	CandidateScore float64
+	BaseLatencyMS  int64
+	CandLatencyMS  int64
+	// OnlyIn is set when the case exists in just one of the runs ("base" or "candidate").
+	OnlyIn string
+}
+
+// Comparison is the difference between two runs.
+type Comparison struct {
+	Base      Run
+	Candidate Run
+	Cases     []CaseDelta
+}
+
+// Compare matches the cases of two runs by name.
+func Compare(base, candidate Run) Comparison {
+	cmp := Comparison{Base: base, Candidate: candidate}
+
+	baseByName := map[string]CaseResult{}
+	for _, r := range base.Results {
+		baseByName[r.Name] = r
+	}
+	candByName := map[string]CaseResult{}
+	for _, r := range candidate.Results {
+		candByName[r.Name] = r
+	}
+
+	names := map[string]bool{}
+	for name := range baseByName {
+		names[name] = true
+	}
+	for name := range candByName {
+		names[name] = true
+	}
+
+	for name := range names {
+		b, inBase := baseByName[name]
+		c, inCand := candByName[name]
+		delta := CaseDelta{
+			Name:           name,
+			BaseScore:      b.Score,
+			CandidateScore: c.Score,
+			BaseLatencyMS:  b.LatencyMS,
+			CandLatencyMS:  c.LatencyMS,
+		}
+		switch {
+		case !inBase:
+			delta.OnlyIn = "candidate"
+		case !inCand:
+			delta.OnlyIn = "base"
+		}
+		cmp.Cases = append(cmp.Cases, delta)
+	}
+
+	sort.Slice(cmp.Cases, func(i, j int) bool { return cmp.Cases[i].Name < cmp.Cases[j].Name })
+	return cmp
+}
+
+// WriteMarkdown renders the comparison as a Markdown report.
+func (cmp Comparison) WriteMarkdown(w io.Writer) error {
+	b, c := cmp.Base, cmp.Candidate
+
+	lines := []string{
+		"# Sketch-to-UI evaluation comparison",
+		"",
+		fmt.Sprintf("- Base: `%s` (%s, %s, prompt %s)", b.Label, b.Provider, b.ModelID, b.PromptVersion),
+		fmt.Sprintf("- Candidate: `%s` (%s, %s, prompt %s)", c.Label, c.Provider, c.ModelID, c.PromptVersion),
+		"",
+		"## Summary",
+		"",
+		"| Metric | Base | Candidate | Delta |",
+		"|---|---|---|---|",
+		fmt.Sprintf("| Mean score | %.3f | %.3f | %+.3f |", b.Summary.MeanScore, c.Summary.MeanScore, c.Summary.MeanScore-b.Summary.MeanScore),
+		fmt.Sprintf("| Valid JSON | %.0f%% | %.0f%% | %+.0f pp |", 100*b.Summary.ValidJSONRate, 100*c.Summary.ValidJSONRate, 100*(c.Summary.ValidJSONRate-b.Summary.ValidJSONRate)),
+		fmt.Sprintf("| Well-formed HTML | %.0f%% | %.0f%% | %+.0f pp |", 100*b.Summary.WellFormedRate, 100*c.Summary.WellFormedRate, 100*(c.Summary.WellFormedRate-b.Summary.WellFormedRate)),
+		fmt.Sprintf("| A11y findings | %d | %d | %+d |", b.Summary.A11yFindings, c.Summary.A11yFindings, c.Summary.A11yFindings-b.Summary.A11yFindings),
+		fmt.Sprintf("| Mean latency (ms) | %d | %d | %+d |", b.Summary.MeanLatencyMS, c.Summary.MeanLatencyMS, c.Summary.MeanLatencyMS-b.Summary.MeanLatencyMS),
+		"",
+		"## Cases",
+		"",
+		"| Case | Base score | Candidate score | Delta | Base ms | Candidate ms |",
+		"|---|---|---|---|---|---|",
+	}
+	for _, d := range cmp.Cases {
+		if d.OnlyIn != "" {
+			lines = append(lines, fmt.Sprintf("| %s | | | only in %s | | |", d.Name, d.OnlyIn))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("| %s | %.3f | %.3f | %+.3f | %d | %d |",
+			d.Name, d.BaseScore, d.CandidateScore, d.CandidateScore-d.BaseScore, d.BaseLatencyMS, d.CandLatencyMS))
+	}
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
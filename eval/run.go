@@ -0,0 +1,137 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"sketch-to-ui-final-proj/ai"
+)
+
+// Run is the result of evaluating every case against one provider and model.
+type Run struct {
+	Label         string       `json:"label"`
+	Provider      string       `json:"provider"`
+	ModelID       string       `json:"model_id"`
+	PromptVersion string       `json:"prompt_version"`
+	Pipeline      string       `json:"pipeline,omitempty"`
+	StartedAt     time.Time    `json:"started_at"`
+	Results       []CaseResult `json:"results"`
+	Summary       Summary      `json:"summary"`
+}
+
+// Summary aggregates the case results of a run.
+type Summary struct {
+	Cases          int     `json:"cases"`
+	ValidJSONRate  float64 `json:"valid_json_rate"`
+	WellFormedRate float64 `json:"well_formed_rate"`
+	A11yFindings   int     `json:"a11y_findings"`
+	MeanScore      float64 `json:"mean_score"`
+	MeanLatencyMS  int64   `json:"mean_latency_ms"`
+}
+
+// Options configure an evaluation run.
+type Options struct {
+	Label         string
+	Provider      string
+	ModelID       string
+	PromptVersion string
+	Pipeline      string
+	// Timeout bounds each individual generation call.
+	Timeout time.Duration
+}
+
+// RunCases sends every case through ai.GenerateUICode and scores the output.
+func RunCases(ctx context.Context, cases []Case, provider ai.LLMProvider, opts Options) (Run, error) {
+	settings := ai.GenerationSettings{ModelID: opts.ModelID, PromptVersion: opts.PromptVersion, Pipeline: opts.Pipeline}.Resolved()
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = 2 * time.Minute
+	}
+
+	run := Run{
+		Label:         opts.Label,
+		Provider:      opts.Provider,
+		ModelID:       settings.ModelID,
+		PromptVersion: settings.PromptVersion,
+		Pipeline:      settings.Pipeline,
+		StartedAt:     time.Now().UTC(),
+	}
+
+	for _, c := range cases {
+		imageURI, err := c.imageDataURI()
+		if err != nil {
+			return Run{}, err
+		}
+
+		caseCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		resp, genErr := ai.GenerateUICode(caseCtx, c.prompt(), imageURI, provider, settings)
+		latency := time.Since(start)
+		cancel()
+
+		result := scoreCase(c, resp, genErr, latency)
+		slog.Info("Evaluated case", "case", c.Name, "score", result.Score, "latency_ms", result.LatencyMS, "error", result.Error)
+		run.Results = append(run.Results, result)
+	}
+
+	run.Summary = summarize(run.Results)
+	return run, nil
+}
+
+func summarize(results []CaseResult) Summary {
+	summary := Summary{Cases: len(results)}
+	if len(results) == 0 {
+		return summary
+	}
+
+	var validJSON, wellFormed int
+	var score float64
+	var latency int64
+	for _, r := range results {
+		if r.ValidJSON {
+			validJSON++
+		}
+		if r.HTMLWellFormed {
+			wellFormed++
+		}
+		summary.A11yFindings += len(r.A11yFindings)
+		score += r.Score
+		latency += r.LatencyMS
+	}
+
+	n := float64(len(results))
+	summary.ValidJSONRate = float64(validJSON) / n
+	summary.WellFormedRate = float64(wellFormed) / n
+	summary.MeanScore = score / n
+	summary.MeanLatencyMS = latency / int64(len(results))
+	return summary
+}
+
+// WriteRun saves a run as indented JSON.
+func WriteRun(path string, run Run) error {
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal run: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write run: %w", err)
+	}
+	return nil
+}
+
+// ReadRun loads a run previously saved with WriteRun.
+func ReadRun(path string) (Run, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Run{}, fmt.Errorf("failed to read run: %w", err)
+	}
+	var run Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return Run{}, fmt.Errorf("failed to parse run %s: %w", path, err)
+	}
+	return run, nil
+}
@@ -0,0 +1,252 @@
+package eval
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"sketch-to-ui-final-proj/ai"
+)
+
+// CaseResult holds the scores for one sketch in a run.
+type CaseResult struct {
+	Name           string         `json:"name"`
+	Error          string         `json:"error,omitempty"`
+	ValidJSON      bool           `json:"valid_json"`
+	HTMLWellFormed bool           `json:"html_well_formed"`
+	HTMLProblems   []string       `json:"html_problems,omitempty"`
+	Components     int            `json:"components"`
+	MissingTypes   []string       `json:"missing_types,omitempty"`
+	ElementCounts  map[string]int `json:"element_counts"`
+	ElementMisses  []string       `json:"element_misses,omitempty"`
+	A11yFindings   []string       `json:"a11y_findings,omitempty"`
+	LatencyMS      int64          `json:"latency_ms"`
+	Score          float64        `json:"score"`
+
+	// AgentSteps records the model calls of the agent pipeline
+	AgentSteps []ai.AgentStep `json:"agent_steps,omitempty"`
+}
+
+// scoreCase scores a generation response against the case expectations.
+// genErr is the error returned by ai.GenerateUICode, if any.
+func scoreCase(c Case, resp ai.UIGenerationResponse, genErr error, latency time.Duration) CaseResult {
+	result := CaseResult{
+		Name:          c.Name,
+		LatencyMS:     latency.Milliseconds(),
+		ElementCounts: map[string]int{},
+	}
+
+	if genErr != nil {
+		result.Error = genErr.Error()
+		// Either the provider call failed or the reply was not valid JSON; nothing else can be scored
+		return result
+	}
+
+	result.ValidJSON = true
+	result.AgentSteps = resp.Steps
+	components := flatten(resp.Components)
+	result.Components = countLeaves(resp.Components)
+
+	var combined strings.Builder
+	for _, component := range resp.Components {
+		combined.WriteString(component.ComposedCode())
+		combined.WriteString("\n")
+	}
+	code := combined.String()
+
+	result.HTMLProblems = ai.VerifyHTML(code)
+	result.HTMLWellFormed = len(result.HTMLProblems) == 0
+
+	doc, err := html.Parse(strings.NewReader(code))
+	if err == nil {
+		countElements(doc, result.ElementCounts)
+		result.A11yFindings = findA11yIssues(doc)
+	}
+
+	for _, want := range c.Expect.ComponentTypes {
+		if !hasComponentType(components, want) {
+			result.MissingTypes = append(result.MissingTypes, want)
+		}
+	}
+	for tag, min := range c.Expect.Elements {
+		if got := result.ElementCounts[strings.ToLower(tag)]; got < min {
+			result.ElementMisses = append(result.ElementMisses, fmt.Sprintf("%s: want at least %d, got %d", tag, min, got))
+		}
+	}
+
+	result.Score = computeScore(c, result)
+	return result
+}
+
+// computeScore averages the individual checks into a score between 0 and 1.
+func computeScore(c Case, r CaseResult) float64 {
+	parts := []float64{boolScore(r.ValidJSON), boolScore(r.HTMLWellFormed)}
+
+	if c.Expect.MinComponents > 0 {
+		parts = append(parts, boolScore(r.Components >= c.Expect.MinComponents))
+	}
+	if n := len(c.Expect.ComponentTypes); n > 0 {
+		parts = append(parts, float64(n-len(r.MissingTypes))/float64(n))
+	}
+	if n := len(c.Expect.Elements); n > 0 {
+		parts = append(parts, float64(n-len(r.ElementMisses))/float64(n))
+	}
+
+	a11y := 1 - 0.25*float64(len(r.A11yFindings))
+	if a11y < 0 {
+		a11y = 0
+	}
+	parts = append(parts, a11y)
+
+	var total float64
+	for _, p := range parts {
+		total += p
+	}
+	return total / float64(len(parts))
+}
+
+func boolScore(ok bool) float64 {
+	if ok {
+		return 1
+	}
+	return 0
+}
+
+// flatten returns every component of a hierarchy, parents before their children.
+func flatten(components []ai.UIComponentDTO) []ai.UIComponentDTO {
+	var out []ai.UIComponentDTO
+	for _, c := range components {
+		out = append(out, c)
+		out = append(out, flatten(c.Children)...)
+	}
+	return out
+}
+
+// countLeaves counts the components that hold code of their own.
+func countLeaves(components []ai.UIComponentDTO) int {
+	n := 0
+	for _, c := range components {
+		if len(c.Children) == 0 {
+			n++
+		}
+		n += countLeaves(c.Children)
+	}
+	return n
+}
+
+func hasComponentType(components []ai.UIComponentDTO, want string) bool {
+	for _, component := range components {
+		if strings.EqualFold(component.Type, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func countElements(n *html.Node, counts map[string]int) {
+	if n.Type == html.ElementNode {
+		counts[n.Data]++
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		countElements(child, counts)
+	}
+}
+
+// findA11yIssues reports common accessibility problems: images without alt text,
+// form controls without a label, and buttons or links without an accessible name.
+func findA11yIssues(doc *html.Node) []string {
+	labelled := map[string]bool{}
+	walk(doc, func(n *html.Node) {
+		if n.DataAtom == atom.Label {
+			if target := attr(n, "for"); target != "" {
+				labelled[target] = true
+			}
+		}
+	})
+
+	var findings []string
+	walk(doc, func(n *html.Node) {
+		switch n.DataAtom {
+		case atom.Img:
+			if !hasAttr(n, "alt") {
+				findings = append(findings, "img without alt attribute")
+			}
+		case atom.Input, atom.Select, atom.Textarea:
+			switch attr(n, "type") {
+			case "hidden", "submit", "button", "reset", "image":
+				return
+			}
+			if hasAriaName(n) || attr(n, "title") != "" || labelled[attr(n, "id")] || hasAncestor(n, atom.Label) {
+				return
+			}
+			findings = append(findings, fmt.Sprintf("<%s> without an associated label", n.Data))
+		case atom.Button, atom.A:
+			if hasAriaName(n) || strings.TrimSpace(textContent(n)) != "" {
+				return
+			}
+			findings = append(findings, fmt.Sprintf("<%s> without an accessible name", n.Data))
+		}
+	})
+	return findings
+}
+
+func walk(n *html.Node, fn func(*html.Node)) {
+	if n.Type == html.ElementNode {
+		fn(n)
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		walk(child, fn)
+	}
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAriaName(n *html.Node) bool {
+	return attr(n, "aria-label") != "" || attr(n, "aria-labelledby") != ""
+}
+
+func hasAncestor(n *html.Node, a atom.Atom) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.DataAtom == a {
+			return true
+		}
+	}
+	return false
+}
+
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		if n.Type == html.ElementNode && n.DataAtom == atom.Img {
+			b.WriteString(attr(n, "alt"))
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			collect(child)
+		}
+	}
+	collect(n)
+	return b.String()
+}
@@ -0,0 +1,147 @@
+package experiments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+
+	"sketch-to-ui-final-proj/ai"
+)
+
+// Operations that can be put under experiment.
+const (
+	OperationCreate = "create"
+	OperationUpdate = "update"
+)
+
+// ControlArm is the arm name recorded for users who stay on the default settings.
+const ControlArm = "control"
+
+// Arm is one variant of an experiment. Empty fields fall back to the defaults.
+type Arm struct {
+	Name          string `json:"name"`
+	ModelID       string `json:"model_id,omitempty"`
+	PromptVersion string `json:"prompt_version,omitempty"`
+	Pipeline      string `json:"pipeline,omitempty"`
+}
+
+// Experiment routes a fraction of users, for one operation, to a treatment arm.
+// Everyone else is assigned to the control arm.
+type Experiment struct {
+	Name      string  `json:"name"`
+	Operation string  `json:"operation"`
+	Fraction  float64 `json:"fraction"`
+	Treatment Arm     `json:"treatment"`
+}
+
+// Validate checks that the experiment can be run.
+func (e Experiment) Validate() error {
+	if e.Name == "" {
+		return fmt.Errorf("experiment name is required")
+	}
+	if e.Operation != OperationCreate && e.Operation != OperationUpdate {
+		return fmt.Errorf("experiment %s: unknown operation %q", e.Name, e.Operation)
+	}
+	if e.Fraction < 0 || e.Fraction > 1 {
+		return fmt.Errorf("experiment %s: fraction must be between 0 and 1", e.Name)
+	}
+	if e.Treatment.Name == "" || e.Treatment.Name == ControlArm {
+		return fmt.Errorf("experiment %s: treatment arm needs a name other than %q", e.Name, ControlArm)
+	}
+	if _, err := ai.Prompts(e.Treatment.PromptVersion); err != nil {
+		return fmt.Errorf("experiment %s: %w", e.Name, err)
+	}
+	switch e.Treatment.Pipeline {
+	case "", ai.PipelineDirect, ai.PipelineLayout, ai.PipelineAgent:
+	default:
+		return fmt.Errorf("experiment %s: unknown pipeline %q", e.Name, e.Treatment.Pipeline)
+	}
+	return nil
+}
+
+// Percent returns the treatment share as a percentage.
+func (e Experiment) Percent() float64 {
+	return 100 * e.Fraction
+}
+
+// LoadExperiments reads a JSON array of experiments from path.
+func LoadExperiments(path string) ([]Experiment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read experiments file: %w", err)
+	}
+
+	var experiments []Experiment
+	if err := json.Unmarshal(data, &experiments); err != nil {
+		return nil, fmt.Errorf("failed to parse experiments file: %w", err)
+	}
+	for _, e := range experiments {
+		if err := e.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return experiments, nil
+}
+
+// Assignment is the arm a user was placed in for an operation. Experiment is
+// empty when no experiment covers the operation.
+type Assignment struct {
+	Experiment string
+	Arm        string
+	Operation  string
+	Settings   ai.GenerationSettings
+}
+
+// Manager assigns users to experiment arms and records assignments.
+type Manager struct {
+	experiments []Experiment
+	store       *ExperimentStore
+}
+
+// NewManager creates a Manager for the given experiments.
+func NewManager(experiments []Experiment, store *ExperimentStore) *Manager {
+	return &Manager{experiments: experiments, store: store}
+}
+
+// Assign returns the arm for userID in the first experiment covering operation.
+// Assignment is deterministic per user and experiment, so a user keeps seeing the same arm.
+func (m *Manager) Assign(operation string, userID int) Assignment {
+	for _, e := range m.experiments {
+		if e.Operation != operation {
+			continue
+		}
+
+		assignment := Assignment{Experiment: e.Name, Arm: ControlArm, Operation: operation}
+		if bucket(e.Name, userID) < e.Fraction {
+			assignment.Arm = e.Treatment.Name
+			assignment.Settings = ai.GenerationSettings{
+				ModelID:       e.Treatment.ModelID,
+				PromptVersion: e.Treatment.PromptVersion,
+				Pipeline:      e.Treatment.Pipeline,
+			}
+		}
+		assignment.Settings = assignment.Settings.Resolved()
+		return assignment
+	}
+
+	return Assignment{Operation: operation, Settings: ai.GenerationSettings{}.Resolved()}
+}
+
+// Record stores the assignment against the component it produced. Assignments
+// outside of any experiment are not recorded.
+func (m *Manager) Record(ctx context.Context, assignment Assignment, componentID int, userID int) error {
+	if assignment.Experiment == "" {
+		return nil
+	}
+	return m.store.RecordAssignment(ctx, assignment, componentID, userID)
+}
+
+// bucket maps a user to a stable point in [0, 1) for an experiment.
+func bucket(experiment string, userID int) float64 {
+	h := fnv.New32a()
+	h.Write([]byte(experiment + ":" + strconv.Itoa(userID)))
+	return float64(h.Sum32()) / (1 << 32)
+}
@@ -0,0 +1,58 @@
+package experiments
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExperimentHandler serves the experiment admin report
+type ExperimentHandler struct {
+	store       *ExperimentStore
+	experiments []Experiment
+}
+
+// SetupExperiments loads the experiments listed in the file named by EXPERIMENTS_FILE,
+// registers the report route in the admin group and returns the Manager used to
+// assign arms. Without EXPERIMENTS_FILE every request uses the default model and
+// prompt version.
+func SetupExperiments(adminGroup *gin.RouterGroup, db *sql.DB) (*Manager, error) {
+	var experiments []Experiment
+	if path := os.Getenv("EXPERIMENTS_FILE"); path != "" {
+		loaded, err := LoadExperiments(path)
+		if err != nil {
+			return nil, err
+		}
+		experiments = loaded
+	}
+	slog.Info("Setting up experiments", "count", len(experiments))
+
+	store := NewExperimentStore(db)
+	handler := &ExperimentHandler{store: store, experiments: experiments}
+	handler.RegisterRoutes(adminGroup)
+
+	return NewManager(experiments, store), nil
+}
+
+// RenderReport renders the per-arm outcome report
+func (h *ExperimentHandler) RenderReport(c *gin.Context) {
+	reports, err := h.store.GetArmReports(c.Request.Context())
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load experiment reports", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load experiment reports"})
+		return
+	}
+
+	c.HTML(http.StatusOK, "experiments-report.html", gin.H{
+		"Experiments": h.experiments,
+		"Reports":     reports,
+	})
+}
+
+// RegisterRoutes registers the experiment routes in the admin-only group
+func (h *ExperimentHandler) RegisterRoutes(adminGroup *gin.RouterGroup) {
+	adminGroup.GET("/experiments", h.RenderReport)
+}
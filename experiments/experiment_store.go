@@ -0,0 +1,108 @@
+package experiments
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type ExperimentStore struct {
+	db *sql.DB
+}
+
+func NewExperimentStore(db *sql.DB) *ExperimentStore {
+	return &ExperimentStore{
+		db: db,
+	}
+}
+
+// ArmReport aggregates the outcomes of the components produced under one arm.
+//   - Kept: the component has not been archived
+//   - Edited: the component was saved again after the assignment
+//   - Archived: the component was deleted by its owner
+//   - ThumbsUp/ThumbsDown: the owner's rating of the component
+type ArmReport struct {
+	Experiment    string
+	Arm           string
+	Operation     string
+	ModelID       string
+	PromptVersion string
+	Assignments   int
+	Kept          int
+	Edited        int
+	Archived      int
+	ThumbsUp      int
+	ThumbsDown    int
+}
+
+// RecordAssignment stores which arm produced a component
+func (es *ExperimentStore) RecordAssignment(ctx context.Context, assignment Assignment, componentID int, userID int) error {
+	sqlQuery := `
+		INSERT INTO experiment_assignments (experiment, arm, operation, model_id, prompt_version, component_id, user_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err := es.db.ExecContext(ctx, sqlQuery,
+		assignment.Experiment, assignment.Arm, assignment.Operation,
+		assignment.Settings.ModelID, assignment.Settings.PromptVersion,
+		componentID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to record experiment assignment: %w", err)
+	}
+
+	return nil
+}
+
+// GetArmReports aggregates component outcomes per experiment arm
+func (es *ExperimentStore) GetArmReports(ctx context.Context) ([]ArmReport, error) {
+	sqlQuery := `
+		SELECT
+			a.experiment, a.arm, a.operation, a.model_id, a.prompt_version,
+			COUNT(*),
+			COUNT(*) FILTER (WHERE c.archived_at IS NULL),
+			COUNT(*) FILTER (WHERE c.updated_at > a.created_at),
+			COUNT(*) FILTER (WHERE c.archived_at IS NOT NULL),
+			COUNT(*) FILTER (WHERE f.rating = 1),
+			COUNT(*) FILTER (WHERE f.rating = -1)
+		FROM experiment_assignments a
+		JOIN uicomponents c ON c.id = a.component_id
+		LEFT JOIN component_feedback f ON f.component_id = a.component_id AND f.user_id = a.user_id
+		GROUP BY a.experiment, a.arm, a.operation, a.model_id, a.prompt_version
+		ORDER BY a.experiment, a.arm`
+
+	rows, err := es.db.QueryContext(ctx, sqlQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query experiment reports: %w", err)
+	}
+	defer rows.Close()
+
+	var reports []ArmReport
+	for rows.Next() {
+		var r ArmReport
+		err := rows.Scan(
+			&r.Experiment, &r.Arm, &r.Operation, &r.ModelID, &r.PromptVersion,
+			&r.Assignments, &r.Kept, &r.Edited, &r.Archived, &r.ThumbsUp, &r.ThumbsDown,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan experiment report row: %w", err)
+		}
+		reports = append(reports, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over experiment report rows: %w", err)
+	}
+
+	return reports, nil
+}
+
+// rate returns n as a percentage of the arm's assignments.
+func (r ArmReport) rate(n int) float64 {
+	if r.Assignments == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(r.Assignments)
+}
+
+func (r ArmReport) KeptRate() float64     { return r.rate(r.Kept) }
+func (r ArmReport) EditedRate() float64   { return r.rate(r.Edited) }
+func (r ArmReport) ArchivedRate() float64 { return r.rate(r.Archived) }
@@ -0,0 +1,83 @@
+package experiments
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sketch-to-ui-final-proj/ai"
+)
+
+func TestAssignWithoutExperimentUsesDefaults(t *testing.T) {
+	manager := NewManager(nil, nil)
+
+	assignment := manager.Assign(OperationCreate, 1)
+
+	assert.Empty(t, assignment.Experiment)
+	assert.Equal(t, ai.DefaultModelID, assignment.Settings.ModelID)
+	assert.Equal(t, ai.DefaultPromptVersion, assignment.Settings.PromptVersion)
+}
+
+func TestAssignRespectsFractionAndOperation(t *testing.T) {
+	experiment := Experiment{
+		Name:      "prompt-v2",
+		Operation: OperationCreate,
+		Fraction:  0.3,
+		Treatment: Arm{Name: "v2", PromptVersion: "v2", ModelID: "test/model"},
+	}
+	manager := NewManager([]Experiment{experiment}, nil)
+
+	treated := 0
+	for userID := 1; userID <= 2000; userID++ {
+		assignment := manager.Assign(OperationCreate, userID)
+		assert.Equal(t, "prompt-v2", assignment.Experiment)
+		if assignment.Arm == "v2" {
+			treated++
+			assert.Equal(t, "test/model", assignment.Settings.ModelID)
+			assert.Equal(t, "v2", assignment.Settings.PromptVersion)
+		} else {
+			assert.Equal(t, ControlArm, assignment.Arm)
+			assert.Equal(t, ai.DefaultPromptVersion, assignment.Settings.PromptVersion)
+		}
+
+		// The same user always lands in the same arm
+		assert.Equal(t, assignment, manager.Assign(OperationCreate, userID))
+	}
+	assert.InDelta(t, 600, treated, 100, "about 30%% of users should be treated")
+
+	// Other operations are not covered by the experiment
+	assert.Empty(t, manager.Assign(OperationUpdate, 1).Experiment)
+}
+
+func TestLoadExperimentsValidates(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "valid.json")
+	require.NoError(t, os.WriteFile(valid, []byte(`[{"name":"m","operation":"update","fraction":0.5,"treatment":{"name":"other-model","model_id":"x/y"}}]`), 0o644))
+	experiments, err := LoadExperiments(valid)
+	require.NoError(t, err)
+	assert.Len(t, experiments, 1)
+
+	for name, content := range map[string]string{
+		"operation.json": `[{"name":"m","operation":"delete","fraction":0.5,"treatment":{"name":"t"}}]`,
+		"fraction.json":  `[{"name":"m","operation":"create","fraction":1.5,"treatment":{"name":"t"}}]`,
+		"control.json":   `[{"name":"m","operation":"create","fraction":0.5,"treatment":{"name":"control"}}]`,
+		"prompt.json":    `[{"name":"m","operation":"create","fraction":0.5,"treatment":{"name":"t","prompt_version":"v99"}}]`,
+		"pipeline.json":  `[{"name":"m","operation":"create","fraction":0.5,"treatment":{"name":"t","pipeline":"magic"}}]`,
+	} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		_, err := LoadExperiments(path)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestArmReportRates(t *testing.T) {
+	r := ArmReport{Assignments: 4, Kept: 3, Edited: 1, Archived: 1}
+	assert.Equal(t, 75.0, r.KeptRate())
+	assert.Equal(t, 25.0, r.EditedRate())
+	assert.Equal(t, 0.0, ArmReport{}.ArchivedRate())
+}
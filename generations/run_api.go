@@ -0,0 +1,269 @@
+package generations
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"sketch-to-ui-final-proj/ai"
+	"sketch-to-ui-final-proj/auth"
+	"sketch-to-ui-final-proj/utils/htmx"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultRetention is how long runs and their images are kept when
+// GENERATION_RETENTION_DAYS is not set.
+const DefaultRetention = 30 * 24 * time.Hour
+
+// purgeInterval is how often runs past the retention are purged.
+const purgeInterval = time.Hour
+
+// RunHandler serves the admin pages of the generation log
+type RunHandler struct {
+	store        *RunStore
+	providerName string
+	aiProvider   ai.LLMProvider
+}
+
+// RunsQuery is the pagination of the run list
+type RunsQuery struct {
+	Limit  int `form:"limit" binding:"max=100"`
+	Offset int `form:"offset"`
+}
+
+// ReplayRequest chooses the model a run is replayed against
+type ReplayRequest struct {
+	ModelID string `form:"model_id" binding:"max=255"`
+}
+
+// SetupGenerations starts logging every model exchange to the database and
+// registers the admin routes to browse and replay them. Runs are replayed with
+// aiProvider, the shared provider named providerName. Runs and the images only they
+// use are purged after GENERATION_RETENTION_DAYS; 0 keeps them forever.
+func SetupGenerations(router *gin.Engine, db *sql.DB, providerName string, aiProvider ai.LLMProvider) (*RunStore, error) {
+	retention := DefaultRetention
+	if value := os.Getenv("GENERATION_RETENTION_DAYS"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 {
+			return nil, fmt.Errorf("GENERATION_RETENTION_DAYS must be a non-negative number, got %q", value)
+		}
+		retention = time.Duration(days) * 24 * time.Hour
+	}
+	if providerName == "" {
+		providerName = ai.ProviderOpenRouter
+	}
+	slog.Info("Setting up generation log", "retention", retention)
+
+	store := NewRunStore(db)
+	ai.SetRunRecorder(store)
+	if retention > 0 {
+		go purgeRuns(store, retention)
+	}
+
+	handler := &RunHandler{store: store, providerName: providerName, aiProvider: aiProvider}
+	handler.RegisterRoutes(router)
+
+	return store, nil
+}
+
+// purgeRuns purges the runs older than retention every purgeInterval.
+func purgeRuns(store *RunStore, retention time.Duration) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		ctx := context.Background()
+		runs, images, err := store.PurgeRuns(ctx, time.Now().Add(-retention))
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to purge generation runs", "error", err)
+			continue
+		}
+		if runs > 0 || images > 0 {
+			slog.InfoContext(ctx, "Purged generation runs", "runs", runs, "images", images)
+		}
+	}
+}
+
+// RenderRuns renders a page of logged runs, newest first
+func (h *RunHandler) RenderRuns(c *gin.Context) {
+	var query RunsQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters", "details": err.Error()})
+		return
+	}
+	if query.Limit <= 0 {
+		query.Limit = 50
+	}
+
+	runs, total, err := h.store.ListRuns(c.Request.Context(), query.Limit, query.Offset)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load generation runs", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load generation runs"})
+		return
+	}
+
+	nextOffset := query.Offset + len(runs)
+	c.HTML(http.StatusOK, "generation-runs.html", gin.H{
+		"Runs":       runs,
+		"Total":      total,
+		"Limit":      query.Limit,
+		"NextOffset": nextOffset,
+		"Remaining":  total - nextOffset,
+	})
+}
+
+// RenderRun renders one run with its request messages and replies
+func (h *RunHandler) RenderRun(c *gin.Context) {
+	runID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid run ID"})
+		return
+	}
+
+	run, err := h.store.GetRun(c.Request.Context(), runID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to get generation run", "run_id", runID, "error", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		return
+	}
+
+	c.HTML(http.StatusOK, "generation-run.html", gin.H{
+		"Run":          run,
+		"Messages":     messageViews(run.Messages),
+		"DefaultModel": ai.DefaultModel(),
+		"CanReplay":    run.Provider == h.providerName,
+		"Provider":     h.providerName,
+	})
+}
+
+// ReplayRun handles POST requests that send the exact request of a run again, to
+// the model chosen in the form or to the run's own model. Only runs made with the
+// server's provider can be replayed; another provider would not receive the same
+// request.
+func (h *RunHandler) ReplayRun(c *gin.Context) {
+	runID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid run ID"})
+		return
+	}
+
+	var req ReplayRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload", "details": err.Error()})
+		return
+	}
+
+	run, err := h.store.GetRun(c.Request.Context(), runID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to get generation run", "run_id", runID, "error", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		return
+	}
+
+	if run.Provider != h.providerName {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("This run was made with %s, but the server generates with %s", run.Provider, h.providerName)})
+		return
+	}
+
+	run.Messages, err = h.store.ResolveImages(c.Request.Context(), run.Messages)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load run images", "run_id", runID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load the images of this run"})
+		return
+	}
+
+	replay, err := ai.ReplayRun(c.Request.Context(), *run, req.ModelID, h.aiProvider)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to replay generation run", "run_id", runID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay run"})
+		return
+	}
+
+	location := map[string]interface{}{
+		"path":   fmt.Sprintf("/admin/generations/%d", replay.ID),
+		"target": "#content",
+	}
+	locationJSON, err := json.Marshal(location)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal HX-Location"})
+		return
+	}
+	htmx.TriggerToast(c, htmx.InfoLevel, "The Run Was Replayed")
+	c.Header("HX-Location", string(locationJSON))
+	c.Status(http.StatusOK)
+}
+
+// GetImage serves an image that was sent to the model
+func (h *RunHandler) GetImage(c *gin.Context) {
+	dataURI, err := h.store.GetImage(c.Request.Context(), c.Param("hash"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return
+	}
+
+	mediaType, data, err := ai.ParseDataURI(dataURI)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Stored image is not a valid data URI"})
+		return
+	}
+	image, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Stored image is not valid base64"})
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.Data(http.StatusOK, mediaType, image)
+}
+
+// RegisterRoutes registers the admin-only generation log routes
+func (h *RunHandler) RegisterRoutes(router *gin.Engine) {
+	adminGroup := router.Group("/admin/generations")
+	adminGroup.Use(auth.AuthRequiredMiddleware(), auth.RequireRole(auth.Admin))
+
+	adminGroup.GET("", h.RenderRuns)
+	adminGroup.GET("/:id", h.RenderRun)
+	adminGroup.POST("/:id/replay", h.ReplayRun)
+	adminGroup.GET("/images/:hash", h.GetImage)
+}
+
+// partView is one content part of a logged message as shown in the admin UI
+type partView struct {
+	Text     string
+	ImageRef string
+	ImageURL string
+}
+
+// messageView is a logged message as shown in the admin UI
+type messageView struct {
+	Role  string
+	Parts []partView
+}
+
+func messageViews(messages []ai.Message) []messageView {
+	views := make([]messageView, 0, len(messages))
+	for _, m := range messages {
+		view := messageView{Role: m.Role}
+		for _, part := range m.Parts {
+			switch part.Type {
+			case ai.PartText:
+				view.Parts = append(view.Parts, partView{Text: part.Text})
+			case ai.PartImage:
+				if hash, ok := ImageRef(part); ok {
+					view.Parts = append(view.Parts, partView{ImageRef: hash})
+				} else {
+					view.Parts = append(view.Parts, partView{ImageURL: part.ImageURL})
+				}
+			}
+		}
+		views = append(views, view)
+	}
+	return views
+}
@@ -0,0 +1,320 @@
+// Package generations keeps the log of every model exchange and serves the admin
+// pages to browse and replay them.
+package generations
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"sketch-to-ui-final-proj/ai"
+	"sketch-to-ui-final-proj/tracing"
+)
+
+// imageRefPrefix marks an image part whose data URI is stored in generation_images.
+const imageRefPrefix = "image:"
+
+// RunStore persists generation runs. It implements ai.RunRecorder.
+type RunStore struct {
+	db *sql.DB
+}
+
+func NewRunStore(db *sql.DB) *RunStore {
+	return &RunStore{
+		db: db,
+	}
+}
+
+// startSpan starts a client span for a single store operation.
+func (rs *RunStore) startSpan(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "RunStore."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation", operation),
+		),
+	)
+}
+
+// RecordRuns stores runs with their images in one transaction and sets their IDs
+func (rs *RunStore) RecordRuns(ctx context.Context, runs []*ai.GenerationRun) (err error) {
+	ctx, span := rs.startSpan(ctx, "RecordRuns")
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := rs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, run := range runs {
+		messages, images := referenceImages(run.Messages)
+		for hash, dataURI := range images {
+			// A stored image is touched, so a purge running alongside keeps it. The
+			// update also waits for a purge that is deleting it, then stores it again.
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO generation_images (hash, data_uri) VALUES ($1, $2)
+				ON CONFLICT (hash) DO UPDATE SET created_at = CURRENT_TIMESTAMP`,
+				hash, dataURI)
+			if err != nil {
+				return fmt.Errorf("failed to store generation image: %w", err)
+			}
+		}
+
+		messagesJSON, err := json.Marshal(messages)
+		if err != nil {
+			return fmt.Errorf("failed to marshal messages: %w", err)
+		}
+		paramsJSON, err := json.Marshal(run.Settings)
+		if err != nil {
+			return fmt.Errorf("failed to marshal params: %w", err)
+		}
+
+		sqlQuery := `
+			INSERT INTO generation_runs (operation, provider, model_id, params, messages, raw_response,
+				cleaned_response, parse_outcome, parse_error, error, latency_ms, input_tokens, output_tokens, replay_of)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NULLIF($14, 0))
+			RETURNING id, created_at`
+
+		err = tx.QueryRowContext(ctx, sqlQuery,
+			run.Operation, run.Provider, run.ModelID, paramsJSON, messagesJSON, run.RawResponse,
+			run.CleanedResponse, run.ParseOutcome, run.ParseError, run.Error, run.Latency.Milliseconds(),
+			run.Usage.InputTokens, run.Usage.OutputTokens, run.ReplayOf,
+		).Scan(&run.ID, &run.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to insert generation run: %w", err)
+		}
+
+		for hash := range images {
+			_, err = tx.ExecContext(ctx, `INSERT INTO generation_run_images (run_id, hash) VALUES ($1, $2)`, run.ID, hash)
+			if err != nil {
+				return fmt.Errorf("failed to link generation image: %w", err)
+			}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit generation runs: %w", err)
+	}
+	return nil
+}
+
+// ListRuns retrieves a page of runs, newest first, without their messages
+func (rs *RunStore) ListRuns(ctx context.Context, limit, offset int) (_ []ai.GenerationRun, total int, err error) {
+	ctx, span := rs.startSpan(ctx, "ListRuns")
+	defer func() { tracing.End(span, err) }()
+
+	if err = rs.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM generation_runs`).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count generation runs: %w", err)
+	}
+
+	sqlQuery := `
+		SELECT id, operation, provider, model_id, parse_outcome, error, latency_ms,
+			input_tokens, output_tokens, COALESCE(replay_of, 0), created_at
+		FROM generation_runs
+		ORDER BY created_at DESC, id DESC
+		LIMIT $1 OFFSET $2`
+
+	rows, err := rs.db.QueryContext(ctx, sqlQuery, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query generation runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []ai.GenerationRun
+	for rows.Next() {
+		var run ai.GenerationRun
+		var latencyMS int64
+		err := rows.Scan(
+			&run.ID, &run.Operation, &run.Provider, &run.ModelID, &run.ParseOutcome, &run.Error, &latencyMS,
+			&run.Usage.InputTokens, &run.Usage.OutputTokens, &run.ReplayOf, &run.CreatedAt,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan generation run row: %w", err)
+		}
+		run.Latency = time.Duration(latencyMS) * time.Millisecond
+		runs = append(runs, run)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating over generation run rows: %w", err)
+	}
+
+	return runs, total, nil
+}
+
+// GetRun retrieves a run with its messages. Image references are left in place; use
+// ResolveImages before sending the messages to a model.
+func (rs *RunStore) GetRun(ctx context.Context, id int) (_ *ai.GenerationRun, err error) {
+	ctx, span := rs.startSpan(ctx, "GetRun")
+	defer func() { tracing.End(span, err) }()
+
+	sqlQuery := `
+		SELECT id, operation, provider, model_id, params, messages, raw_response, cleaned_response,
+			parse_outcome, parse_error, error, latency_ms, input_tokens, output_tokens,
+			COALESCE(replay_of, 0), created_at
+		FROM generation_runs
+		WHERE id = $1`
+
+	var run ai.GenerationRun
+	var paramsJSON, messagesJSON []byte
+	var latencyMS int64
+	err = rs.db.QueryRowContext(ctx, sqlQuery, id).Scan(
+		&run.ID, &run.Operation, &run.Provider, &run.ModelID, &paramsJSON, &messagesJSON, &run.RawResponse,
+		&run.CleanedResponse, &run.ParseOutcome, &run.ParseError, &run.Error, &latencyMS,
+		&run.Usage.InputTokens, &run.Usage.OutputTokens, &run.ReplayOf, &run.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("generation run with id %d not found", id)
+		}
+		return nil, fmt.Errorf("failed to get generation run: %w", err)
+	}
+	run.Latency = time.Duration(latencyMS) * time.Millisecond
+
+	if err = json.Unmarshal(paramsJSON, &run.Settings); err != nil {
+		return nil, fmt.Errorf("failed to parse params: %w", err)
+	}
+	if err = json.Unmarshal(messagesJSON, &run.Messages); err != nil {
+		return nil, fmt.Errorf("failed to parse messages: %w", err)
+	}
+
+	return &run, nil
+}
+
+// GetImage retrieves the data URI of a stored image by its hash
+func (rs *RunStore) GetImage(ctx context.Context, hash string) (_ string, err error) {
+	ctx, span := rs.startSpan(ctx, "GetImage")
+	defer func() { tracing.End(span, err) }()
+
+	var dataURI string
+	err = rs.db.QueryRowContext(ctx, `SELECT data_uri FROM generation_images WHERE hash = $1`, hash).Scan(&dataURI)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("generation image %s not found", hash)
+		}
+		return "", fmt.Errorf("failed to get generation image: %w", err)
+	}
+	return dataURI, nil
+}
+
+// PurgeRuns deletes the runs created before cutoff, and the images last stored before
+// it that no remaining run refers to. It returns how many runs and images were deleted.
+func (rs *RunStore) PurgeRuns(ctx context.Context, cutoff time.Time) (runs int64, images int64, err error) {
+	ctx, span := rs.startSpan(ctx, "PurgeRuns")
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := rs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM generation_runs WHERE created_at < $1`, cutoff)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to purge generation runs: %w", err)
+	}
+	if runs, err = result.RowsAffected(); err != nil {
+		return 0, 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	// The links of the purged runs went with them
+	sqlQuery := `
+		DELETE FROM generation_images i
+		WHERE i.created_at < $1
+			AND NOT EXISTS (SELECT 1 FROM generation_run_images ri WHERE ri.hash = i.hash)`
+	result, err = tx.ExecContext(ctx, sqlQuery, cutoff)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to purge generation images: %w", err)
+	}
+	if images, err = result.RowsAffected(); err != nil {
+		return 0, 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit generation purge: %w", err)
+	}
+	return runs, images, nil
+}
+
+// DeleteImage deletes a stored image by its data URI, such as the image of a deleted
+// sketch. The runs that sent it are kept and show it as missing.
+func (rs *RunStore) DeleteImage(ctx context.Context, dataURI string) (err error) {
+	ctx, span := rs.startSpan(ctx, "DeleteImage")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err = rs.db.ExecContext(ctx, `DELETE FROM generation_images WHERE hash = $1`, imageHash(dataURI)); err != nil {
+		return fmt.Errorf("failed to delete generation image: %w", err)
+	}
+	return nil
+}
+
+// imageHash is the key an image is stored under: the hex SHA-256 of its data URI.
+func imageHash(dataURI string) string {
+	sum := sha256.Sum256([]byte(dataURI))
+	return hex.EncodeToString(sum[:])
+}
+
+// ResolveImages replaces the image references in messages with the stored images.
+func (rs *RunStore) ResolveImages(ctx context.Context, messages []ai.Message) ([]ai.Message, error) {
+	return resolveImages(messages, func(hash string) (string, error) {
+		return rs.GetImage(ctx, hash)
+	})
+}
+
+// referenceImages returns a copy of messages whose inline images are replaced by a
+// reference to their hash, and the images by hash.
+func referenceImages(messages []ai.Message) ([]ai.Message, map[string]string) {
+	images := map[string]string{}
+	out := make([]ai.Message, len(messages))
+	for i, m := range messages {
+		parts := make([]ai.ContentPart, len(m.Parts))
+		for j, part := range m.Parts {
+			if part.Type == ai.PartImage && strings.HasPrefix(part.ImageURL, "data:") {
+				hash := imageHash(part.ImageURL)
+				images[hash] = part.ImageURL
+				part.ImageURL = imageRefPrefix + hash
+			}
+			parts[j] = part
+		}
+		out[i] = ai.Message{Role: m.Role, Parts: parts}
+	}
+	return out, images
+}
+
+// resolveImages returns a copy of messages with every image reference replaced by
+// the image load returns for its hash.
+func resolveImages(messages []ai.Message, load func(hash string) (string, error)) ([]ai.Message, error) {
+	out := make([]ai.Message, len(messages))
+	for i, m := range messages {
+		parts := make([]ai.ContentPart, len(m.Parts))
+		for j, part := range m.Parts {
+			if hash, ok := ImageRef(part); ok {
+				dataURI, err := load(hash)
+				if err != nil {
+					return nil, err
+				}
+				part.ImageURL = dataURI
+			}
+			parts[j] = part
+		}
+		out[i] = ai.Message{Role: m.Role, Parts: parts}
+	}
+	return out, nil
+}
+
+// ImageRef returns the hash of the stored image a logged image part refers to.
+func ImageRef(part ai.ContentPart) (string, bool) {
+	if part.Type != ai.PartImage || !strings.HasPrefix(part.ImageURL, imageRefPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(part.ImageURL, imageRefPrefix), true
+}
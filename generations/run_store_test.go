@@ -0,0 +1,37 @@
+package generations
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sketch-to-ui-final-proj/ai"
+)
+
+func TestImagesAreStoredByReference(t *testing.T) {
+	image := "data:image/png;base64,aGVsbG8="
+	messages := []ai.Message{
+		ai.SystemMessage("system"),
+		ai.UserMessage(ai.TextPart("Build this"), ai.ImagePart(image), ai.ImagePart("https://example.com/a.png")),
+	}
+
+	referenced, images := referenceImages(messages)
+	require.Len(t, images, 1)
+	assert.Equal(t, image, messages[1].Parts[1].ImageURL, "the original messages are not modified")
+
+	hash, ok := ImageRef(referenced[1].Parts[1])
+	require.True(t, ok)
+	assert.Equal(t, image, images[hash])
+	assert.Equal(t, "https://example.com/a.png", referenced[1].Parts[2].ImageURL)
+
+	resolved, err := resolveImages(referenced, func(h string) (string, error) {
+		if dataURI, ok := images[h]; ok {
+			return dataURI, nil
+		}
+		return "", fmt.Errorf("image %s not found", h)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, messages, resolved)
+}
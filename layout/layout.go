@@ -0,0 +1,134 @@
+// Package layout defines the typed layout tree the model returns for a sketch and
+// the deterministic renderers that turn a tree into code.
+package layout
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Node types of a layout tree.
+const (
+	Container = "container"
+	Row       = "row"
+	Text      = "text"
+	Input     = "input"
+	Button    = "button"
+	Image     = "image"
+)
+
+// Limits that keep a tree to a size a sketch can plausibly contain.
+const (
+	MaxDepth = 12
+	MaxNodes = 500
+)
+
+// variants lists the allowed variants per node type; the first one is the default.
+var variants = map[string][]string{
+	Container: {"section", "card", "form", "nav", "header", "footer"},
+	Row:       {"start", "center", "end", "between"},
+	Text:      {"paragraph", "heading", "subheading", "caption"},
+	Input:     {"text", "email", "password", "number", "search", "tel", "url", "date", "checkbox", "textarea"},
+	Button:    {"primary", "secondary", "link"},
+	Image:     {"default", "avatar", "icon"},
+}
+
+// Box is the position of a node in the sketch as fractions (0 to 1) of the
+// sketch width and height.
+type Box struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// Node is one element of a layout tree. Containers and rows hold children; every
+// other type is a leaf.
+type Node struct {
+	Type    string `json:"type"`
+	Variant string `json:"variant,omitempty"`
+	Box     *Box   `json:"box,omitempty"`
+
+	// Text is the content of a text node, the label of a button or input, the
+	// alternative text of an image and the accessible name of a container
+	Text        string `json:"text,omitempty"`
+	Placeholder string `json:"placeholder,omitempty"`
+
+	Children []Node `json:"children,omitempty"`
+}
+
+// Parse decodes and validates a layout tree.
+func Parse(data []byte) (Node, error) {
+	var root Node
+	if err := json.Unmarshal(data, &root); err != nil {
+		return Node{}, fmt.Errorf("failed to parse layout: %w", err)
+	}
+	if err := root.Validate(); err != nil {
+		return Node{}, err
+	}
+	return root, nil
+}
+
+// Validate checks the tree against the node rules and size limits.
+func (n Node) Validate() error {
+	count := 0
+	return n.validate("root", 1, &count)
+}
+
+func (n Node) validate(path string, depth int, count *int) error {
+	*count++
+	if *count > MaxNodes {
+		return fmt.Errorf("layout has more than %d nodes", MaxNodes)
+	}
+	if depth > MaxDepth {
+		return fmt.Errorf("%s: layout is nested deeper than %d levels", path, MaxDepth)
+	}
+
+	allowed, ok := variants[n.Type]
+	if !ok {
+		return fmt.Errorf("%s: unknown node type %q", path, n.Type)
+	}
+	if n.Variant != "" && !contains(allowed, n.Variant) {
+		return fmt.Errorf("%s: unknown %s variant %q", path, n.Type, n.Variant)
+	}
+
+	if n.Box != nil {
+		b := *n.Box
+		if b.X < 0 || b.Y < 0 || b.Width < 0 || b.Height < 0 || b.X+b.Width > 1.001 || b.Y+b.Height > 1.001 {
+			return fmt.Errorf("%s: box must lie within the sketch (0 to 1)", path)
+		}
+	}
+
+	if n.Type != Container && n.Type != Row {
+		if len(n.Children) > 0 {
+			return fmt.Errorf("%s: %s cannot have children", path, n.Type)
+		}
+		if n.Text == "" {
+			return fmt.Errorf("%s: %s needs text", path, n.Type)
+		}
+	}
+
+	for i, child := range n.Children {
+		if err := child.validate(fmt.Sprintf("%s.children[%d]", path, i), depth+1, count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// variant returns the node variant, or the default variant of its type.
+func (n Node) variant() string {
+	if n.Variant != "" {
+		return n.Variant
+	}
+	return variants[n.Type][0]
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package layout
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const loginForm = `{
+	"type": "container", "variant": "form", "text": "Sign in",
+	"box": {"x": 0.2, "y": 0.1, "width": 0.6, "height": 0.7},
+	"children": [
+		{"type": "text", "variant": "heading", "text": "Sign in"},
+		{"type": "input", "variant": "email", "text": "Email", "placeholder": "you@example.com"},
+		{"type": "input", "variant": "checkbox", "text": "Remember me"},
+		{"type": "row", "variant": "end", "children": [
+			{"type": "button", "variant": "link", "text": "Forgot password?"},
+			{"type": "button", "text": "Log <in>"}
+		]},
+		{"type": "image", "variant": "avatar", "text": "User avatar"}
+	]
+}`
+
+func TestParseValidatesTree(t *testing.T) {
+	root, err := Parse([]byte(loginForm))
+	require.NoError(t, err)
+	assert.Len(t, root.Children, 5)
+
+	for name, tree := range map[string]string{
+		"unknown type":     `{"type": "carousel"}`,
+		"unknown variant":  `{"type": "button", "variant": "danger", "text": "x"}`,
+		"leaf children":    `{"type": "button", "text": "x", "children": [{"type": "text", "text": "y"}]}`,
+		"missing text":     `{"type": "container", "children": [{"type": "input"}]}`,
+		"box out of range": `{"type": "text", "text": "x", "box": {"x": 0.8, "y": 0, "width": 0.5, "height": 0.1}}`,
+		"not json":         `<div>`,
+	} {
+		_, err := Parse([]byte(tree))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestValidateLimitsDepth(t *testing.T) {
+	root := Node{Type: Text, Text: "deep"}
+	for i := 0; i < MaxDepth; i++ {
+		root = Node{Type: Container, Children: []Node{root}}
+	}
+	assert.ErrorContains(t, root.Validate(), "nested deeper")
+}
+
+func TestRenderHTML(t *testing.T) {
+	root, err := Parse([]byte(loginForm))
+	require.NoError(t, err)
+
+	code, err := Render("", root)
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(code, "<style>"))
+	assert.Contains(t, code, `<form class="ui-section ui-form" aria-label="Sign in">`)
+	assert.Contains(t, code, `<h2 class="ui-heading">Sign in</h2>`)
+	assert.Contains(t, code, `<label for="field-1" class="ui-label">Email</label>`)
+	assert.Contains(t, code, `<input type="email" id="field-1" placeholder="you@example.com" class="ui-input">`)
+	assert.Contains(t, code, `<input type="checkbox" id="field-2" class="ui-checkbox">`)
+	assert.Contains(t, code, `<a href="#" class="ui-link">Forgot password?</a>`)
+	assert.Contains(t, code, `<button type="button" class="ui-button ui-primary">Log &lt;in&gt;</button>`)
+	assert.Contains(t, code, `<div role="img" aria-label="User avatar" class="ui-image ui-avatar"></div>`)
+
+	// Rendering is deterministic
+	again, err := Render(DefaultTarget, root)
+	require.NoError(t, err)
+	assert.Equal(t, code, again)
+}
+
+func TestRenderTailwind(t *testing.T) {
+	root, err := Parse([]byte(loginForm))
+	require.NoError(t, err)
+
+	code, err := Render("tailwind", root)
+	require.NoError(t, err)
+
+	assert.Contains(t, code, "@tailwindcss/browser")
+	assert.Contains(t, code, `<div class="flex flex-wrap items-center justify-end gap-3">`)
+	assert.NotContains(t, code, "ui-")
+}
+
+func TestRenderRejectsUnknownTargetAndInvalidTree(t *testing.T) {
+	assert.Equal(t, []string{"html", "tailwind"}, Targets())
+
+	_, err := Render("jsx", Node{Type: Text, Text: "x"})
+	assert.Error(t, err)
+
+	_, err = Render("html", Node{Type: Button})
+	assert.Error(t, err)
+}
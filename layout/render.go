@@ -0,0 +1,238 @@
+package layout
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+)
+
+// DefaultTarget is the render target used for newly generated components.
+const DefaultTarget = "html"
+
+// Renderer turns a validated layout tree into code for one target.
+type Renderer interface {
+	Render(root Node) string
+}
+
+// renderers maps a target name to its renderer.
+var renderers = map[string]Renderer{
+	"html":     htmlRenderer{classes: cssClasses, head: "<style>\n" + baseCSS + "</style>\n"},
+	"tailwind": htmlRenderer{classes: tailwindClasses, head: `<script src="https://cdn.jsdelivr.net/npm/@tailwindcss/browser@4"></script>` + "\n"},
+}
+
+// Targets returns the known render targets in sorted order.
+func Targets() []string {
+	targets := make([]string, 0, len(renderers))
+	for t := range renderers {
+		targets = append(targets, t)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// Render validates root and renders it for target (DefaultTarget when empty).
+func Render(target string, root Node) (string, error) {
+	if target == "" {
+		target = DefaultTarget
+	}
+	renderer, ok := renderers[target]
+	if !ok {
+		return "", fmt.Errorf("unknown render target %q", target)
+	}
+	if err := root.Validate(); err != nil {
+		return "", err
+	}
+	return renderer.Render(root), nil
+}
+
+// htmlRenderer renders semantic HTML. The class set decides the styling: plain CSS
+// classes backed by a style block, or Tailwind utility classes.
+type htmlRenderer struct {
+	classes map[string]string
+	head    string
+}
+
+func (r htmlRenderer) Render(root Node) string {
+	w := &htmlWriter{classes: r.classes}
+	w.b.WriteString(r.head)
+	w.node(root, 0)
+	return w.b.String()
+}
+
+// htmlWriter accumulates the markup of one render.
+type htmlWriter struct {
+	b       strings.Builder
+	classes map[string]string
+	fields  int
+}
+
+// class returns the class attribute for a node type and variant.
+func (w *htmlWriter) class(key string) string {
+	return ` class="` + w.classes[key] + `"`
+}
+
+func (w *htmlWriter) line(depth int, s string) {
+	w.b.WriteString(strings.Repeat("  ", depth))
+	w.b.WriteString(s)
+	w.b.WriteString("\n")
+}
+
+func (w *htmlWriter) node(n Node, depth int) {
+	text := html.EscapeString(n.Text)
+	variant := n.variant()
+
+	switch n.Type {
+	case Container:
+		tag := map[string]string{"form": "form", "nav": "nav", "header": "header", "footer": "footer"}[variant]
+		if tag == "" {
+			tag = "section"
+		}
+		label := ""
+		if n.Text != "" {
+			label = ` aria-label="` + text + `"`
+		}
+		w.line(depth, "<"+tag+w.class("container."+variant)+label+">")
+		w.children(n, depth)
+		w.line(depth, "</"+tag+">")
+
+	case Row:
+		w.line(depth, "<div"+w.class("row."+variant)+">")
+		w.children(n, depth)
+		w.line(depth, "</div>")
+
+	case Text:
+		tag := map[string]string{"heading": "h2", "subheading": "h3"}[variant]
+		if tag == "" {
+			tag = "p"
+		}
+		w.line(depth, "<"+tag+w.class("text."+variant)+">"+text+"</"+tag+">")
+
+	case Button:
+		if variant == "link" {
+			w.line(depth, `<a href="#"`+w.class("button.link")+">"+text+"</a>")
+		} else {
+			w.line(depth, `<button type="button"`+w.class("button."+variant)+">"+text+"</button>")
+		}
+
+	case Input:
+		w.fields++
+		id := fmt.Sprintf("field-%d", w.fields)
+		placeholder := ""
+		if n.Placeholder != "" {
+			placeholder = ` placeholder="` + html.EscapeString(n.Placeholder) + `"`
+		}
+		label := `<label for="` + id + `"` + w.class("label") + ">" + text + "</label>"
+
+		switch variant {
+		case "checkbox":
+			w.line(depth, "<div"+w.class("checkbox-field")+">")
+			w.line(depth+1, `<input type="checkbox" id="`+id+`"`+w.class("checkbox")+">")
+			w.line(depth+1, label)
+		case "textarea":
+			w.line(depth, "<div"+w.class("field")+">")
+			w.line(depth+1, label)
+			w.line(depth+1, `<textarea id="`+id+`"`+placeholder+w.class("input")+"></textarea>")
+		default:
+			w.line(depth, "<div"+w.class("field")+">")
+			w.line(depth+1, label)
+			w.line(depth+1, `<input type="`+variant+`" id="`+id+`"`+placeholder+w.class("input")+">")
+		}
+		w.line(depth, "</div>")
+
+	case Image:
+		w.line(depth, `<div role="img" aria-label="`+text+`"`+w.class("image."+variant)+"></div>")
+	}
+}
+
+func (w *htmlWriter) children(n Node, depth int) {
+	for _, child := range n.Children {
+		w.node(child, depth+1)
+	}
+}
+
+// cssClasses are the class names styled by baseCSS.
+var cssClasses = map[string]string{
+	"container.section": "ui-section",
+	"container.card":    "ui-section ui-card",
+	"container.form":    "ui-section ui-form",
+	"container.nav":     "ui-row ui-nav",
+	"container.header":  "ui-section ui-header",
+	"container.footer":  "ui-section ui-footer",
+	"row.start":         "ui-row",
+	"row.center":        "ui-row ui-center",
+	"row.end":           "ui-row ui-end",
+	"row.between":       "ui-row ui-between",
+	"text.paragraph":    "ui-text",
+	"text.heading":      "ui-heading",
+	"text.subheading":   "ui-subheading",
+	"text.caption":      "ui-caption",
+	"button.primary":    "ui-button ui-primary",
+	"button.secondary":  "ui-button ui-secondary",
+	"button.link":       "ui-link",
+	"field":             "ui-field",
+	"checkbox-field":    "ui-row ui-checkbox-field",
+	"label":             "ui-label",
+	"input":             "ui-input",
+	"checkbox":          "ui-checkbox",
+	"image.default":     "ui-image",
+	"image.avatar":      "ui-image ui-avatar",
+	"image.icon":        "ui-image ui-icon",
+}
+
+const baseCSS = `  * { box-sizing: border-box; }
+  body { margin: 0; padding: 16px; font-family: system-ui, sans-serif; color: #1f2937; }
+  .ui-section { display: flex; flex-direction: column; gap: 12px; }
+  .ui-card { padding: 16px; border: 1px solid #e5e7eb; border-radius: 8px; box-shadow: 0 1px 3px rgba(0, 0, 0, 0.1); }
+  .ui-form { max-width: 480px; }
+  .ui-header, .ui-footer { padding: 12px 0; }
+  .ui-nav { padding: 8px 0; border-bottom: 1px solid #e5e7eb; }
+  .ui-row { display: flex; flex-wrap: wrap; align-items: center; gap: 12px; }
+  .ui-center { justify-content: center; }
+  .ui-end { justify-content: flex-end; }
+  .ui-between { justify-content: space-between; }
+  .ui-heading { margin: 0; font-size: 1.5rem; font-weight: 700; }
+  .ui-subheading { margin: 0; font-size: 1.125rem; font-weight: 600; }
+  .ui-text { margin: 0; }
+  .ui-caption { margin: 0; font-size: 0.875rem; color: #6b7280; }
+  .ui-button { padding: 8px 16px; border-radius: 6px; border: 1px solid transparent; font: inherit; cursor: pointer; }
+  .ui-primary { background: #2563eb; color: #fff; }
+  .ui-secondary { background: #fff; color: #1f2937; border-color: #d1d5db; }
+  .ui-link { color: #2563eb; text-decoration: underline; }
+  .ui-field { display: flex; flex-direction: column; gap: 4px; }
+  .ui-checkbox-field { gap: 8px; }
+  .ui-label { font-size: 0.875rem; font-weight: 500; }
+  .ui-input { padding: 8px 12px; border: 1px solid #d1d5db; border-radius: 6px; font: inherit; }
+  .ui-image { width: 100%; min-height: 120px; background: #e5e7eb; border-radius: 6px; }
+  .ui-avatar { width: 48px; min-height: 48px; height: 48px; border-radius: 9999px; }
+  .ui-icon { width: 24px; min-height: 24px; height: 24px; border-radius: 4px; }
+`
+
+// tailwindClasses style the same markup with Tailwind utility classes.
+var tailwindClasses = map[string]string{
+	"container.section": "flex flex-col gap-3",
+	"container.card":    "flex flex-col gap-3 p-4 border border-gray-200 rounded-lg shadow",
+	"container.form":    "flex flex-col gap-3 max-w-md",
+	"container.nav":     "flex flex-wrap items-center gap-3 py-2 border-b border-gray-200",
+	"container.header":  "flex flex-col gap-3 py-3",
+	"container.footer":  "flex flex-col gap-3 py-3",
+	"row.start":         "flex flex-wrap items-center gap-3",
+	"row.center":        "flex flex-wrap items-center justify-center gap-3",
+	"row.end":           "flex flex-wrap items-center justify-end gap-3",
+	"row.between":       "flex flex-wrap items-center justify-between gap-3",
+	"text.paragraph":    "text-gray-800",
+	"text.heading":      "text-2xl font-bold",
+	"text.subheading":   "text-lg font-semibold",
+	"text.caption":      "text-sm text-gray-500",
+	"button.primary":    "px-4 py-2 rounded-md bg-blue-600 text-white",
+	"button.secondary":  "px-4 py-2 rounded-md border border-gray-300 bg-white text-gray-800",
+	"button.link":       "text-blue-600 underline",
+	"field":             "flex flex-col gap-1",
+	"checkbox-field":    "flex items-center gap-2",
+	"label":             "text-sm font-medium",
+	"input":             "px-3 py-2 border border-gray-300 rounded-md",
+	"checkbox":          "h-4 w-4",
+	"image.default":     "w-full min-h-30 bg-gray-200 rounded-md",
+	"image.avatar":      "w-12 h-12 bg-gray-200 rounded-full",
+	"image.icon":        "w-6 h-6 bg-gray-200 rounded",
+}
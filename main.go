@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"log/slog"
@@ -12,9 +13,15 @@ import (
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 
+	"sketch-to-ui-final-proj/accounts"
 	"sketch-to-ui-final-proj/ai"
 	"sketch-to-ui-final-proj/auth"
+	"sketch-to-ui-final-proj/experiments"
+	"sketch-to-ui-final-proj/generations"
+	"sketch-to-ui-final-proj/metrics"
 	"sketch-to-ui-final-proj/sketch"
+	"sketch-to-ui-final-proj/storage"
+	"sketch-to-ui-final-proj/tracing"
 	uicomponents "sketch-to-ui-final-proj/ui-components"
 )
 
@@ -41,30 +48,82 @@ func main() {
 	}
 	defer db.Close()
 
-	router := gin.Default()
+	handler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
+	slog.SetDefault(slog.New(tracing.NewLogHandler(handler)))
+
+	shutdownTracing, err := tracing.Init(context.Background(), "sketch-to-ui")
+	if err != nil {
+		log.Fatal("Tracing setup error:", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	metrics.RegisterDBStats(db, "postgres")
+
+	// Tracing comes before the logger and panic recovery, so requests that panic are
+	// traced with the 500 they end in
+	router := gin.New()
+	router.Use(tracing.Middleware("sketch-to-ui"))
+	router.Use(gin.Logger(), gin.Recovery())
+	router.Use(metrics.Middleware())
 	router.LoadHTMLGlob("templates/**/*.html") // Load your templates
 	router.Static("/static", "./static")
 
-	handler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})
-	slog.SetDefault(slog.New(handler))
-
 	secretKey := os.Getenv("SESSION_SECRET_KEY") // Get secret key from env
 	if secretKey == "" {
 		log.Fatal("SESSION_SECRET_KEY is not set in .env") // Important: Secret key is needed!
 	}
 
-	auth.Init(router, db, secretKey) // Initialize auth with the database
-	sketchStore := sketch.SetupSketch(router)
+	// BLOB_STORAGE selects where sketch images and avatars are kept: filesystem (default) or s3
+	blobs, err := storage.SetupStorage(router)
+	if err != nil {
+		log.Fatal("Blob storage setup error:", err)
+	}
+
+	auth.Init(router, db, secretKey, blobs) // Initialize auth with the database
 
-	apiKey := os.Getenv("OPENROUTER_API_KEY")
-	baseURL := os.Getenv("OPENROUTER_BASE_URL")
 	client := &http.Client{
 		Timeout: 30 * time.Second, // Set a timeout of 30 seconds
 
 	}
 
-	aiProvider := ai.NewOpenRouterProvider(apiKey, baseURL, client)
-	uicomponents.SetupComponents(router, db, sketchStore, aiProvider)
+	// AI_PROVIDER selects openrouter (default), openai, anthropic or ollama
+	aiProvider, err := ai.NewProvider(os.Getenv("AI_PROVIDER"), client)
+	if err != nil {
+		log.Fatal("AI provider setup error:", err)
+	}
+	// AI_MODEL overrides the provider's default model, e.g. with another vision model served by Ollama
+	ai.SetDefaultModelFor(os.Getenv("AI_PROVIDER"), os.Getenv("AI_MODEL"))
+	// MODEL_DEFAULTS_FILE maps model IDs to default temperature, max tokens, etc.
+	if path := os.Getenv("MODEL_DEFAULTS_FILE"); path != "" {
+		defaults, err := ai.LoadModelDefaults(path)
+		if err != nil {
+			log.Fatal("Model defaults error:", err)
+		}
+		ai.SetModelDefaults(defaults)
+	}
+	// Logs every model exchange for the admin UI; GENERATION_RETENTION_DAYS bounds how long
+	runs, err := generations.SetupGenerations(router, db, os.Getenv("AI_PROVIDER"), aiProvider)
+	if err != nil {
+		log.Fatal("Generation log setup error:", err)
+	}
+	// UPLOAD_MAX_BYTES, UPLOAD_MAX_DIMENSION and UPLOAD_MAX_PIXELS bound sketch uploads
+	sketches, err := sketch.SetupSketch(router, db, blobs, runs)
+	if err != nil {
+		log.Fatal("Sketch setup error:", err)
+	}
+	metrics.RegisterSketchCacheSize(sketches.Count)
+	// Admin-only pages: the experiment report and the feedback dataset
+	adminGroup := router.Group("/admin", auth.AuthRequiredMiddleware(), auth.RequireRole(auth.Admin))
+	experimentManager, err := experiments.SetupExperiments(adminGroup, db)
+	if err != nil {
+		log.Fatal("Experiments setup error:", err)
+	}
+	// Users generate with their own API key, or with the shared one within a free quota
+	keyring, err := accounts.SetupAccounts(router, db, os.Getenv("AI_PROVIDER"), aiProvider, client)
+	if err != nil {
+		log.Fatal("Accounts setup error:", err)
+	}
+	uicomponents.SetupComponents(router, adminGroup, db, sketches, keyring, experimentManager)
 
 	router.GET("/", func(c *gin.Context) {
 		isLoggedIn, _ := c.Get("isLoggedIn")
@@ -107,6 +166,13 @@ func main() {
 		})
 	})
 
+	// Metrics are served on a separate, internal-only address (loopback by default)
+	metricsAddr := os.Getenv("METRICS_ADDR")
+	if metricsAddr == "" {
+		metricsAddr = "127.0.0.1:9091"
+	}
+	metrics.Serve(metricsAddr, os.Getenv("METRICS_TOKEN"))
+
 	log.Println("Listening on :3000")
 	router.Run(":3000")
 }
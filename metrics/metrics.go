@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "sketchtoui"
+
+// Registry holds every collector exposed on /metrics. A dedicated registry keeps
+// the output limited to what this app registers plus the Go and process collectors.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	httpRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, labelled by gin route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by gin route template.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	llmDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "llm_request_duration_seconds",
+		Help:      "Latency of chat completion calls by model.",
+		Buckets:   []float64{0.5, 1, 2.5, 5, 10, 20, 30, 60, 120},
+	}, []string{"model"})
+
+	llmErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_request_errors_total",
+		Help:      "Chat completion calls that failed, by model.",
+	}, []string{"model"})
+
+	llmTokens = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_tokens_total",
+		Help:      "Tokens reported by the provider, by model and kind (prompt or completion).",
+	}, []string{"model", "kind"})
+
+	generationResponses = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ai_generation_responses_total",
+		Help:      "Model responses by operation and JSON parse outcome (parsed or parse_error).",
+	}, []string{"operation", "outcome"})
+
+	htmlRepairs = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ai_html_repairs_total",
+		Help:      "Generated components by HTML verification outcome (valid, fixed, model_repaired or unrepaired).",
+	}, []string{"outcome"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Middleware records request counts and latency per gin route template.
+// Unmatched requests share a single "unmatched" route label to keep cardinality bounded.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		httpRequests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ObserveLLMRequest records the latency of a chat completion call and counts it as an error when err is non-nil.
+func ObserveLLMRequest(model string, duration time.Duration, err error) {
+	llmDuration.WithLabelValues(model).Observe(duration.Seconds())
+	if err != nil {
+		llmErrors.WithLabelValues(model).Inc()
+	}
+}
+
+// AddLLMTokens adds the prompt and completion token counts reported for a model.
+func AddLLMTokens(model string, promptTokens, completionTokens int) {
+	llmTokens.WithLabelValues(model, "prompt").Add(float64(promptTokens))
+	llmTokens.WithLabelValues(model, "completion").Add(float64(completionTokens))
+}
+
+// ObserveGenerationParse counts a model response for the given operation as parsed or failed.
+func ObserveGenerationParse(operation string, err error) {
+	outcome := "parsed"
+	if err != nil {
+		outcome = "parse_error"
+	}
+	generationResponses.WithLabelValues(operation, outcome).Inc()
+}
+
+// ObserveHTMLRepair counts a generated component by the outcome of its HTML verification.
+func ObserveHTMLRepair(outcome string) {
+	htmlRepairs.WithLabelValues(outcome).Inc()
+}
+
+// RegisterSketchCacheSize exposes the number of sketches currently held in the cache.
+func RegisterSketchCacheSize(count func() int) {
+	factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sketch_cache_size",
+		Help:      "Number of sketches currently held in the sketch cache.",
+	}, func() float64 { return float64(count()) })
+}
+
+// RegisterDBStats exposes the database/sql connection pool statistics of db.
+func RegisterDBStats(db *sql.DB, dbName string) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, dbName))
+}
+
+// Handler returns the /metrics handler. When token is not empty, requests must
+// carry it as a bearer token.
+func Handler(token string) http.Handler {
+	h := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+	if token == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expected := []byte("Bearer " + token)
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Serve starts a dedicated metrics server on addr in the background. It is kept
+// off the public router so /metrics is only reachable on the internal address.
+func Serve(addr string, token string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler(token))
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		slog.Info("Serving metrics", "addr", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Metrics server stopped", "error", err)
+		}
+	}()
+	return server
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareLabelsByRouteTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/components/:id/edit", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	before := testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/components/:id/edit", "200"))
+
+	for _, path := range []string{"/components/1/edit", "/components/2/edit"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	after := testutil.ToFloat64(httpRequests.WithLabelValues("GET", "/components/:id/edit", "200"))
+	assert.Equal(t, float64(2), after-before, "Both requests should share the route template label")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/does-not-exist", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, float64(1), testutil.ToFloat64(httpRequests.WithLabelValues("GET", "unmatched", "404")))
+}
+
+func TestObserveLLMRequestCountsErrors(t *testing.T) {
+	ObserveLLMRequest("test/model", time.Second, nil)
+	ObserveLLMRequest("test/model", time.Second, errors.New("boom"))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(llmErrors.WithLabelValues("test/model")))
+}
+
+func TestObserveGenerationParse(t *testing.T) {
+	ObserveGenerationParse("test-op", nil)
+	ObserveGenerationParse("test-op", errors.New("bad json"))
+	ObserveGenerationParse("test-op", errors.New("bad json"))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(generationResponses.WithLabelValues("test-op", "parsed")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(generationResponses.WithLabelValues("test-op", "parse_error")))
+}
+
+func TestObserveHTMLRepair(t *testing.T) {
+	ObserveHTMLRepair("fixed")
+	ObserveHTMLRepair("fixed")
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(htmlRepairs.WithLabelValues("fixed")))
+}
+
+func TestHandlerRequiresToken(t *testing.T) {
+	handler := Handler("secret")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "go_goroutines")
+}
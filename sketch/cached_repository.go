@@ -0,0 +1,119 @@
+package sketch
+
+import (
+	"context"
+	"time"
+)
+
+// CachedSketchRepository reads sketches through the in-memory cache: a miss loads the
+// sketch from the backing repository and keeps it for ttl. Writes go to the backing
+// repository first, so the cache never holds a sketch that was not stored.
+type CachedSketchRepository struct {
+	backing SketchRepository
+	cache   *SketchStore
+	ttl     time.Duration
+}
+
+func NewCachedSketchRepository(backing SketchRepository, cache *SketchStore, ttl time.Duration) *CachedSketchRepository {
+	return &CachedSketchRepository{
+		backing: backing,
+		cache:   cache,
+		ttl:     ttl,
+	}
+}
+
+// SaveSketch stores the sketch and caches it
+func (r *CachedSketchRepository) SaveSketch(ctx context.Context, sketch *Sketch) error {
+	if err := r.backing.SaveSketch(ctx, sketch); err != nil {
+		return err
+	}
+	return r.keep(sketch)
+}
+
+// SaveSketches stores the batch and caches its sketches
+func (r *CachedSketchRepository) SaveSketches(ctx context.Context, sketches []*Sketch) error {
+	if err := r.backing.SaveSketches(ctx, sketches); err != nil {
+		return err
+	}
+	for _, sketch := range sketches {
+		if err := r.keep(sketch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetSketch returns the cached sketch, or loads and caches it
+func (r *CachedSketchRepository) GetSketch(ctx context.Context, id string) (*Sketch, error) {
+	if sketch, found, err := r.cache.GetSketch(id); err == nil && found {
+		return sketch, nil
+	}
+
+	sketch, err := r.backing.GetSketch(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.keep(sketch); err != nil {
+		return nil, err
+	}
+	return sketch, nil
+}
+
+// keep caches the sketch unless its image is larger than MaxCachedImageBytes
+func (r *CachedSketchRepository) keep(sketch *Sketch) error {
+	if len(sketch.ImageURL) > MaxCachedImageBytes {
+		return nil
+	}
+	return r.cache.SetSketch(sketch.ID, sketch, r.ttl)
+}
+
+// DeleteSketch removes the sketch from the backing repository and the cache
+func (r *CachedSketchRepository) DeleteSketch(ctx context.Context, id string) error {
+	if err := r.backing.DeleteSketch(ctx, id); err != nil {
+		return err
+	}
+	return r.cache.DeleteSketch(id)
+}
+
+// ShareSketch shares the sketch and drops its cached copy
+func (r *CachedSketchRepository) ShareSketch(ctx context.Context, id string, email string) (string, error) {
+	userID, err := r.backing.ShareSketch(ctx, id, email)
+	if err != nil {
+		return "", err
+	}
+	return userID, r.cache.DeleteSketch(id)
+}
+
+// UnshareSketch stops sharing the sketch and drops its cached copy
+func (r *CachedSketchRepository) UnshareSketch(ctx context.Context, id string, userID string) error {
+	if err := r.backing.UnshareSketch(ctx, id, userID); err != nil {
+		return err
+	}
+	return r.cache.DeleteSketch(id)
+}
+
+// SetSketchPublic changes the visibility of the sketch and drops its cached copy
+func (r *CachedSketchRepository) SetSketchPublic(ctx context.Context, id string, public bool) error {
+	if err := r.backing.SetSketchPublic(ctx, id, public); err != nil {
+		return err
+	}
+	return r.cache.DeleteSketch(id)
+}
+
+// RenameSketch renames the sketch and drops its cached copy
+func (r *CachedSketchRepository) RenameSketch(ctx context.Context, id string, name string) error {
+	if err := r.backing.RenameSketch(ctx, id, name); err != nil {
+		return err
+	}
+	return r.cache.DeleteSketch(id)
+}
+
+// ListSketches lists the sketches from the backing repository; summaries are not cached
+func (r *CachedSketchRepository) ListSketches(ctx context.Context, ownerID string) ([]*SketchSummary, error) {
+	return r.backing.ListSketches(ctx, ownerID)
+}
+
+// Count returns the number of sketches currently cached
+func (r *CachedSketchRepository) Count() int {
+	return r.cache.Count()
+}
@@ -0,0 +1,216 @@
+package sketch
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryRepository is a SketchRepository backed by a map that counts its reads.
+type memoryRepository struct {
+	mu       sync.Mutex
+	sketches map[string]*Sketch
+	gets     int
+	saveErr  error
+	// users maps the emails of registered users to their IDs
+	users map[string]string
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{sketches: map[string]*Sketch{}, users: map[string]string{}}
+}
+
+func (r *memoryRepository) SaveSketch(ctx context.Context, sketch *Sketch) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.saveErr != nil {
+		return r.saveErr
+	}
+	r.sketches[sketch.ID] = sketch
+	return nil
+}
+
+func (r *memoryRepository) SaveSketches(ctx context.Context, sketches []*Sketch) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.saveErr != nil {
+		return r.saveErr
+	}
+	for _, sketch := range sketches {
+		r.sketches[sketch.ID] = sketch
+	}
+	return nil
+}
+
+func (r *memoryRepository) GetSketch(ctx context.Context, id string) (*Sketch, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gets++
+	sketch, ok := r.sketches[id]
+	if !ok {
+		return nil, ErrSketchNotFound
+	}
+	return sketch, nil
+}
+
+func (r *memoryRepository) DeleteSketch(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sketches, id)
+	return nil
+}
+
+func (r *memoryRepository) ShareSketch(ctx context.Context, id string, email string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	userID, ok := r.users[email]
+	if !ok {
+		return "", ErrUserNotFound
+	}
+	if sketch, ok := r.sketches[id]; ok && !slices.Contains(sketch.SharedWith, userID) {
+		sketch.SharedWith = append(sketch.SharedWith, userID)
+	}
+	return userID, nil
+}
+
+func (r *memoryRepository) UnshareSketch(ctx context.Context, id string, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if sketch, ok := r.sketches[id]; ok {
+		sketch.SharedWith = slices.DeleteFunc(sketch.SharedWith, func(id string) bool { return id == userID })
+	}
+	return nil
+}
+
+func (r *memoryRepository) SetSketchPublic(ctx context.Context, id string, public bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sketch, ok := r.sketches[id]
+	if !ok {
+		return ErrSketchNotFound
+	}
+	sketch.IsPublic = public
+	return nil
+}
+
+func (r *memoryRepository) RenameSketch(ctx context.Context, id string, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sketch, ok := r.sketches[id]
+	if !ok {
+		return ErrSketchNotFound
+	}
+	sketch.Name = name
+	return nil
+}
+
+func (r *memoryRepository) ListSketches(ctx context.Context, ownerID string) ([]*SketchSummary, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var summaries []*SketchSummary
+	for _, sketch := range r.sketches {
+		if sketch.OwnerID == ownerID {
+			summaries = append(summaries, &SketchSummary{ID: sketch.ID, Name: sketch.Name, CreatedAt: sketch.CreatedAt, IsDrawing: sketch.Vector != nil})
+		}
+	}
+	return summaries, nil
+}
+
+func newCachedRepository(t *testing.T, backing SketchRepository) *CachedSketchRepository {
+	t.Helper()
+	cache := NewSketchStore()
+	t.Cleanup(cache.StopCleanup)
+	return NewCachedSketchRepository(backing, cache, time.Hour)
+}
+
+func TestCachedRepositoryReadsThrough(t *testing.T) {
+	backing := newMemoryRepository()
+	backing.sketches["s1"] = createDummySketch("s1")
+	repo := newCachedRepository(t, backing)
+
+	// A sketch stored before a restart is loaded from the backing repository once
+	for i := 0; i < 2; i++ {
+		sketch, err := repo.GetSketch(context.Background(), "s1")
+		require.NoError(t, err)
+		assert.Equal(t, "s1", sketch.ID)
+	}
+	assert.Equal(t, 1, backing.gets)
+	assert.Equal(t, 1, repo.Count())
+}
+
+func TestCachedRepositoryWritesThrough(t *testing.T) {
+	backing := newMemoryRepository()
+	repo := newCachedRepository(t, backing)
+
+	require.NoError(t, repo.SaveSketch(context.Background(), createDummySketch("s2")))
+	assert.Contains(t, backing.sketches, "s2")
+
+	_, err := repo.GetSketch(context.Background(), "s2")
+	require.NoError(t, err)
+	assert.Equal(t, 0, backing.gets, "a saved sketch is served from the cache")
+
+	require.NoError(t, repo.DeleteSketch(context.Background(), "s2"))
+	_, err = repo.GetSketch(context.Background(), "s2")
+	assert.ErrorIs(t, err, ErrSketchNotFound)
+}
+
+func TestCachedRepositoryDoesNotCacheFailedSaves(t *testing.T) {
+	backing := newMemoryRepository()
+	backing.saveErr = errors.New("database is down")
+	repo := newCachedRepository(t, backing)
+
+	err := repo.SaveSketch(context.Background(), createDummySketch("s3"))
+	assert.Error(t, err)
+	assert.Equal(t, 0, repo.Count())
+}
+
+func TestCachedRepositoryDropsSketchOnShareChanges(t *testing.T) {
+	backing := newMemoryRepository()
+	backing.sketches["s1"] = createDummySketch("s1")
+	backing.users["friend@example.com"] = "8"
+	repo := newCachedRepository(t, backing)
+
+	_, err := repo.GetSketch(context.Background(), "s1")
+	require.NoError(t, err)
+
+	// Sharing must not leave a stale copy that still denies or grants access
+	_, err = repo.ShareSketch(context.Background(), "s1", "friend@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, 0, repo.Count())
+
+	_, err = repo.GetSketch(context.Background(), "s1")
+	require.NoError(t, err)
+	require.NoError(t, repo.SetSketchPublic(context.Background(), "s1", true))
+	assert.Equal(t, 0, repo.Count())
+	assert.Equal(t, 2, backing.gets)
+}
+
+func TestSketchDataURI(t *testing.T) {
+	sketch := &Sketch{ImageURL: "aGVsbG8=", MediaType: "image/jpeg"}
+	assert.Equal(t, "data:image/jpeg;base64,aGVsbG8=", sketch.DataURI())
+
+	sketch.MediaType = ""
+	assert.Equal(t, "data:image/png;base64,aGVsbG8=", sketch.DataURI(), "sketches without a type were always sent as PNG")
+}
+
+func TestCachedRepositorySkipsLargeImages(t *testing.T) {
+	backing := newMemoryRepository()
+	large := createDummySketch("large")
+	large.ImageURL = strings.Repeat("A", MaxCachedImageBytes+1)
+	backing.sketches["large"] = large
+	repo := newCachedRepository(t, backing)
+
+	for i := 0; i < 2; i++ {
+		_, err := repo.GetSketch(context.Background(), "large")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, backing.gets)
+	assert.Zero(t, repo.Count())
+}
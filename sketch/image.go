@@ -0,0 +1,89 @@
+package sketch
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/webp"
+)
+
+// StoredMediaType is the format every sketch is stored in, whatever it was uploaded
+// as. PNG keeps the thin lines of a drawing intact and every vision model accepts it.
+const StoredMediaType = "image/png"
+
+// supportedImageTypes are the formats sketches can be uploaded in. Their decoders are
+// registered with the image package by the imports above.
+var supportedImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/bmp":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// UnsupportedImageError is returned for uploads whose content is not in one of the
+// supported image formats.
+type UnsupportedImageError struct {
+	DetectedType string
+}
+
+func (e *UnsupportedImageError) Error() string {
+	return fmt.Sprintf("%s files are not supported; upload a PNG, JPEG, WebP, GIF or BMP image", e.DetectedType)
+}
+
+// ImageDecodeError is returned for uploads in a supported format that cannot be decoded.
+type ImageDecodeError struct {
+	DetectedType string
+	Err          error
+}
+
+func (e *ImageDecodeError) Error() string {
+	return fmt.Sprintf("the %s image could not be read; it may be damaged or incomplete", e.DetectedType)
+}
+
+func (e *ImageDecodeError) Unwrap() error {
+	return e.Err
+}
+
+// detectImageType returns the media type of data from its content, ignoring the file
+// name and the type the browser reported.
+func detectImageType(data []byte) string {
+	mediaType, _, _ := strings.Cut(mimetype.Detect(data).String(), ";")
+	return mediaType
+}
+
+// normalizeImage decodes an uploaded image and encodes it again as StoredMediaType.
+// Only the first frame of an animated GIF or WebP is kept. The dimensions are checked
+// against limits from the image header before the pixels are decoded.
+func normalizeImage(data []byte, limits UploadLimits) ([]byte, error) {
+	detected := detectImageType(data)
+	if !supportedImageTypes[detected] {
+		return nil, &UnsupportedImageError{DetectedType: detected}
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, &ImageDecodeError{DetectedType: detected, Err: err}
+	}
+	if err := limits.checkDimensions(config.Width, config.Height); err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, &ImageDecodeError{DetectedType: detected, Err: err}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode sketch as PNG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,89 @@
+package sketch
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+// encodeTestImage returns a small drawing encoded as mediaType. WebP is read from
+// testdata because there is no WebP encoder in Go.
+func encodeTestImage(t *testing.T, mediaType string) []byte {
+	t.Helper()
+	img := image.NewPaletted(image.Rect(0, 0, 16, 8), color.Palette{color.White, color.Black})
+	for x := 2; x < 14; x++ {
+		img.Set(x, 4, color.Black)
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch mediaType {
+	case "image/png":
+		err = png.Encode(&buf, img)
+	case "image/jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "image/gif":
+		err = gif.Encode(&buf, img, nil)
+	case "image/bmp":
+		err = bmp.Encode(&buf, img)
+	case "image/tiff":
+		err = tiff.Encode(&buf, img, nil)
+	case "image/webp":
+		data, err := os.ReadFile("testdata/sketch.webp")
+		require.NoError(t, err)
+		return data
+	default:
+		t.Fatalf("no encoder for %s", mediaType)
+	}
+	require.NoError(t, err)
+	return buf.Bytes()
+}
+
+func TestNormalizeImage_SupportedFormats(t *testing.T) {
+	for _, mediaType := range []string{"image/png", "image/jpeg", "image/gif", "image/bmp", "image/webp"} {
+		t.Run(mediaType, func(t *testing.T) {
+			data := encodeTestImage(t, mediaType)
+			assert.Equal(t, mediaType, detectImageType(data))
+
+			normalized, err := normalizeImage(data, DefaultUploadLimits)
+			require.NoError(t, err)
+			assert.Equal(t, StoredMediaType, detectImageType(normalized))
+
+			img, err := png.Decode(bytes.NewReader(normalized))
+			require.NoError(t, err)
+			assert.False(t, img.Bounds().Empty())
+		})
+	}
+}
+
+func TestNormalizeImage_UnsupportedFormat(t *testing.T) {
+	for mediaType, data := range map[string][]byte{
+		"image/tiff": encodeTestImage(t, "image/tiff"),
+		"text/plain": []byte("not an image at all"),
+	} {
+		_, err := normalizeImage(data, DefaultUploadLimits)
+		var unsupported *UnsupportedImageError
+		require.ErrorAs(t, err, &unsupported, mediaType)
+		assert.Equal(t, mediaType, unsupported.DetectedType)
+		assert.Contains(t, err.Error(), mediaType)
+	}
+}
+
+func TestNormalizeImage_TruncatedImage(t *testing.T) {
+	data := encodeTestImage(t, "image/png")
+
+	_, err := normalizeImage(data[:len(data)/2], DefaultUploadLimits)
+	var undecodable *ImageDecodeError
+	require.ErrorAs(t, err, &undecodable)
+	assert.Equal(t, "image/png", undecodable.DetectedType)
+}
@@ -0,0 +1,100 @@
+package sketch
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// UploadLimits bounds the sketch uploads the server accepts. Image dimensions are read
+// from the image header before it is decoded, so a small file that would expand to
+// gigabytes of pixels is rejected without being decoded.
+type UploadLimits struct {
+	// MaxBodyBytes caps the size of the whole upload request, all files included
+	MaxBodyBytes int64
+	// MaxFiles caps the number of sketches uploaded in one request
+	MaxFiles int
+	// MaxDimension caps the width and the height of an image, in pixels
+	MaxDimension int
+	// MaxPixels caps the width times the height of an image
+	MaxPixels int
+}
+
+// DefaultUploadLimits fit a photo of a drawing taken with a phone camera.
+var DefaultUploadLimits = UploadLimits{
+	MaxBodyBytes: 10 << 20,
+	MaxFiles:     20,
+	MaxDimension: 8000,
+	MaxPixels:    40_000_000,
+}
+
+// LoadUploadLimits returns DefaultUploadLimits overridden by the UPLOAD_MAX_BYTES,
+// UPLOAD_MAX_FILES, UPLOAD_MAX_DIMENSION and UPLOAD_MAX_PIXELS env variables.
+func LoadUploadLimits() (UploadLimits, error) {
+	limits := DefaultUploadLimits
+	if err := loadLimit("UPLOAD_MAX_BYTES", &limits.MaxBodyBytes); err != nil {
+		return limits, err
+	}
+	if err := loadLimit("UPLOAD_MAX_FILES", &limits.MaxFiles); err != nil {
+		return limits, err
+	}
+	if err := loadLimit("UPLOAD_MAX_DIMENSION", &limits.MaxDimension); err != nil {
+		return limits, err
+	}
+	if err := loadLimit("UPLOAD_MAX_PIXELS", &limits.MaxPixels); err != nil {
+		return limits, err
+	}
+	return limits, nil
+}
+
+// loadLimit overrides limit with the env variable name, if it is set.
+func loadLimit[T int | int64](name string, limit *T) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return fmt.Errorf("%s must be a positive number, got %q", name, value)
+	}
+	*limit = T(n)
+	return nil
+}
+
+// UploadTooLargeError is returned for uploads over one of the UploadLimits. Its
+// message tells the user how to make the sketch fit.
+type UploadTooLargeError struct {
+	message string
+}
+
+func (e *UploadTooLargeError) Error() string {
+	return e.message
+}
+
+func bodyTooLarge(limits UploadLimits) *UploadTooLargeError {
+	return &UploadTooLargeError{message: fmt.Sprintf(
+		"The upload is larger than %s. Export the sketch at a lower resolution or as a JPEG and try again.",
+		formatBytes(limits.MaxBodyBytes))}
+}
+
+// checkDimensions rejects images too wide, too tall or with too many pixels.
+func (limits UploadLimits) checkDimensions(width, height int) error {
+	if width > limits.MaxDimension || height > limits.MaxDimension {
+		return &UploadTooLargeError{message: fmt.Sprintf(
+			"The image is %d×%d pixels; sketches can be at most %d pixels wide and tall. Resize it and try again.",
+			width, height, limits.MaxDimension)}
+	}
+	if width*height > limits.MaxPixels {
+		return &UploadTooLargeError{message: fmt.Sprintf(
+			"The image is %d×%d pixels, more than the %.0f megapixels a sketch can have. Resize it and try again.",
+			width, height, float64(limits.MaxPixels)/1e6)}
+	}
+	return nil
+}
+
+func formatBytes(n int64) string {
+	if n >= 1<<20 {
+		return fmt.Sprintf("%.0f MB", float64(n)/(1<<20))
+	}
+	return fmt.Sprintf("%.0f KB", float64(n)/(1<<10))
+}
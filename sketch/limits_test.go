@@ -0,0 +1,61 @@
+package sketch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pngHeader returns the signature and header chunk of a PNG claiming to be width by
+// height pixels. It is all a decoder reads before allocating the pixels.
+func pngHeader(width, height uint32) []byte {
+	var chunk bytes.Buffer
+	chunk.WriteString("IHDR")
+	binary.Write(&chunk, binary.BigEndian, width)
+	binary.Write(&chunk, binary.BigEndian, height)
+	chunk.Write([]byte{8, 6, 0, 0, 0}) // 8-bit RGBA, no interlacing
+
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&buf, binary.BigEndian, uint32(chunk.Len()-4))
+	buf.Write(chunk.Bytes())
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk.Bytes()))
+	return buf.Bytes()
+}
+
+func TestNormalizeImage_RejectsPixelBomb(t *testing.T) {
+	// 40 bytes that would decode to 40 GB of pixels
+	_, err := normalizeImage(pngHeader(100_000, 100_000), DefaultUploadLimits)
+
+	var tooLarge *UploadTooLargeError
+	require.ErrorAs(t, err, &tooLarge)
+	assert.Contains(t, err.Error(), "100000×100000")
+}
+
+func TestUploadLimitsCheckDimensions(t *testing.T) {
+	limits := UploadLimits{MaxDimension: 100, MaxPixels: 5000}
+
+	assert.NoError(t, limits.checkDimensions(100, 50))
+	assert.Error(t, limits.checkDimensions(101, 10), "too wide")
+	assert.Error(t, limits.checkDimensions(10, 101), "too tall")
+	assert.Error(t, limits.checkDimensions(100, 51), "too many pixels")
+}
+
+func TestLoadUploadLimits(t *testing.T) {
+	t.Setenv("UPLOAD_MAX_BYTES", "2048")
+	t.Setenv("UPLOAD_MAX_PIXELS", "1000000")
+
+	limits, err := LoadUploadLimits()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2048), limits.MaxBodyBytes)
+	assert.Equal(t, DefaultUploadLimits.MaxDimension, limits.MaxDimension)
+	assert.Equal(t, 1_000_000, limits.MaxPixels)
+
+	t.Setenv("UPLOAD_MAX_DIMENSION", "-1")
+	_, err = LoadUploadLimits()
+	assert.Error(t, err)
+}
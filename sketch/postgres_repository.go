@@ -0,0 +1,375 @@
+package sketch
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"sketch-to-ui-final-proj/storage"
+	"sketch-to-ui-final-proj/tracing"
+)
+
+// PostgresSketchRepository keeps sketches in the sketches table: one row per sketch
+// with its metadata and the key of its image in blob storage. Sketches uploaded
+// before blob storage still hold their image bytes in the row.
+type PostgresSketchRepository struct {
+	db    *sql.DB
+	blobs storage.BlobStore
+}
+
+func NewPostgresSketchRepository(db *sql.DB, blobs storage.BlobStore) *PostgresSketchRepository {
+	return &PostgresSketchRepository{
+		db:    db,
+		blobs: blobs,
+	}
+}
+
+// startSpan starts a client span for a single repository operation.
+func (r *PostgresSketchRepository) startSpan(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "PostgresSketchRepository."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation", operation),
+		),
+	)
+}
+
+// SaveSketch stores the image in blob storage, inserts the sketch and sets its key and
+// creation time
+func (r *PostgresSketchRepository) SaveSketch(ctx context.Context, sketch *Sketch) error {
+	return r.SaveSketches(ctx, []*Sketch{sketch})
+}
+
+// lockBlob takes a lock on a blob key that is held until tx ends. Sketches sharing a
+// blob are inserted and deleted under it, so a blob is never deleted while another
+// transaction is about to reference it.
+func lockBlob(ctx context.Context, tx *sql.Tx, blobKey string) error {
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, blobKey); err != nil {
+		return fmt.Errorf("failed to lock sketch image: %w", err)
+	}
+	return nil
+}
+
+// SaveSketches stores the images in blob storage and inserts the sketches in one
+// transaction, so a batch is stored completely or not at all
+func (r *PostgresSketchRepository) SaveSketches(ctx context.Context, sketches []*Sketch) (err error) {
+	ctx, span := r.startSpan(ctx, "SaveSketches")
+	defer func() { tracing.End(span, err) }()
+
+	ownerIDs := make([]int, len(sketches))
+	images := make(map[string][]byte, len(sketches))
+	for i, sketch := range sketches {
+		ownerIDs[i], err = strconv.Atoi(sketch.OwnerID)
+		if err != nil {
+			return fmt.Errorf("invalid sketch owner %q: %w", sketch.OwnerID, err)
+		}
+		image, err := base64.StdEncoding.DecodeString(sketch.ImageURL)
+		if err != nil {
+			return fmt.Errorf("failed to decode sketch image: %w", err)
+		}
+		// Identical uploads share one blob
+		sketch.BlobKey = storage.ContentKey("sketches", image, sketch.MediaType)
+		images[sketch.BlobKey] = image
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The blobs are stored under their locks, in key order so that concurrent batches
+	// cannot deadlock. A blob left behind by a failed batch is overwritten by the same
+	// content when it is uploaded again.
+	for _, key := range slices.Sorted(maps.Keys(images)) {
+		if err = lockBlob(ctx, tx, key); err != nil {
+			return err
+		}
+	}
+	for _, sketch := range sketches {
+		if err = r.blobs.Put(ctx, sketch.BlobKey, images[sketch.BlobKey], sketch.MediaType); err != nil {
+			return fmt.Errorf("failed to store sketch image: %w", err)
+		}
+	}
+
+	sqlQuery := `
+		INSERT INTO sketches (id, owner_id, name, media_type, blob_key, is_public, batch_id, vector)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8)
+		RETURNING created_at`
+
+	for i, sketch := range sketches {
+		vectorJSON, err := marshalVector(sketch.Vector)
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRowContext(ctx, sqlQuery,
+			sketch.ID, ownerIDs[i], sketch.Name, sketch.MediaType, sketch.BlobKey, sketch.IsPublic, sketch.BatchID, vectorJSON,
+		).Scan(&sketch.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to insert sketch: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit sketches: %w", err)
+	}
+	return nil
+}
+
+// GetSketch retrieves a sketch with its image
+func (r *PostgresSketchRepository) GetSketch(ctx context.Context, id string) (_ *Sketch, err error) {
+	ctx, span := r.startSpan(ctx, "GetSketch")
+	defer func() { tracing.End(span, err) }()
+
+	sketch := Sketch{ID: id}
+	var ownerID int
+	var image, vectorJSON []byte
+	var blobKey, batchID sql.NullString
+	err = r.db.QueryRowContext(ctx,
+		`SELECT owner_id, name, media_type, image, blob_key, batch_id, is_public, created_at, vector FROM sketches WHERE id = $1`, id,
+	).Scan(&ownerID, &sketch.Name, &sketch.MediaType, &image, &blobKey, &batchID, &sketch.IsPublic, &sketch.CreatedAt, &vectorJSON)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrSketchNotFound
+		}
+		return nil, fmt.Errorf("failed to get sketch: %w", err)
+	}
+
+	sketch.OwnerID = strconv.Itoa(ownerID)
+	sketch.BatchID = batchID.String
+	if sketch.Vector, err = unmarshalVector(vectorJSON); err != nil {
+		return nil, err
+	}
+	if blobKey.Valid {
+		sketch.BlobKey = blobKey.String
+		if image, err = r.blobs.Get(ctx, sketch.BlobKey); err != nil {
+			return nil, fmt.Errorf("failed to load sketch image: %w", err)
+		}
+	}
+	sketch.ImageURL = base64.StdEncoding.EncodeToString(image)
+
+	rows, err := r.db.QueryContext(ctx, `SELECT user_id FROM sketch_shares WHERE sketch_id = $1 ORDER BY created_at`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sketch shares: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to scan sketch share row: %w", err)
+		}
+		sketch.SharedWith = append(sketch.SharedWith, strconv.Itoa(userID))
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over sketch share rows: %w", err)
+	}
+
+	return &sketch, nil
+}
+
+// DeleteSketch removes a sketch, if it exists, and its image once no other sketch
+// uses it. The image is deleted under the lock of its blob key before the transaction
+// commits; if the image cannot be deleted the sketch is kept.
+func (r *PostgresSketchRepository) DeleteSketch(ctx context.Context, id string) (err error) {
+	ctx, span := r.startSpan(ctx, "DeleteSketch")
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var blobKey sql.NullString
+	err = tx.QueryRowContext(ctx, `DELETE FROM sketches WHERE id = $1 RETURNING blob_key`, id).Scan(&blobKey)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete sketch: %w", err)
+	}
+
+	// The blob is shared by every upload of the same image. Under the lock, sketches
+	// of other transactions that use it are committed and visible here.
+	if blobKey.Valid {
+		if err = lockBlob(ctx, tx, blobKey.String); err != nil {
+			return err
+		}
+		var inUse bool
+		if err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM sketches WHERE blob_key = $1)`, blobKey.String).Scan(&inUse); err != nil {
+			return fmt.Errorf("failed to check sketch image references: %w", err)
+		}
+		if !inUse {
+			if err = r.blobs.Delete(ctx, blobKey.String); err != nil {
+				return fmt.Errorf("failed to delete sketch image: %w", err)
+			}
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit sketch deletion: %w", err)
+	}
+	return nil
+}
+
+// ShareSketch shares a sketch with the user registered with email
+func (r *PostgresSketchRepository) ShareSketch(ctx context.Context, id string, email string) (_ string, err error) {
+	ctx, span := r.startSpan(ctx, "ShareSketch")
+	defer func() { tracing.End(span, err) }()
+
+	sqlQuery := `
+		INSERT INTO sketch_shares (sketch_id, user_id)
+		SELECT $1, id FROM users WHERE email = $2
+		ON CONFLICT (sketch_id, user_id) DO UPDATE SET sketch_id = EXCLUDED.sketch_id
+		RETURNING user_id`
+
+	var userID int
+	if err = r.db.QueryRowContext(ctx, sqlQuery, id, email).Scan(&userID); err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrUserNotFound
+		}
+		return "", fmt.Errorf("failed to share sketch: %w", err)
+	}
+	return strconv.Itoa(userID), nil
+}
+
+// UnshareSketch stops sharing a sketch with a user
+func (r *PostgresSketchRepository) UnshareSketch(ctx context.Context, id string, userID string) (err error) {
+	ctx, span := r.startSpan(ctx, "UnshareSketch")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err = r.db.ExecContext(ctx, `DELETE FROM sketch_shares WHERE sketch_id = $1 AND user_id = $2`, id, userID); err != nil {
+		return fmt.Errorf("failed to unshare sketch: %w", err)
+	}
+	return nil
+}
+
+// SetSketchPublic makes a sketch public or private again
+func (r *PostgresSketchRepository) SetSketchPublic(ctx context.Context, id string, public bool) (err error) {
+	ctx, span := r.startSpan(ctx, "SetSketchPublic")
+	defer func() { tracing.End(span, err) }()
+
+	result, err := r.db.ExecContext(ctx, `UPDATE sketches SET is_public = $1 WHERE id = $2`, public, id)
+	if err != nil {
+		return fmt.Errorf("failed to update sketch visibility: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrSketchNotFound
+	}
+	return nil
+}
+
+// RenameSketch changes the name of a sketch
+func (r *PostgresSketchRepository) RenameSketch(ctx context.Context, id string, name string) (err error) {
+	ctx, span := r.startSpan(ctx, "RenameSketch")
+	defer func() { tracing.End(span, err) }()
+
+	result, err := r.db.ExecContext(ctx, `UPDATE sketches SET name = $1 WHERE id = $2`, name, id)
+	if err != nil {
+		return fmt.Errorf("failed to rename sketch: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrSketchNotFound
+	}
+	return nil
+}
+
+// ListSketches retrieves the newest MaxListedSketches sketches of a user with the
+// components generated from them, without their images
+func (r *PostgresSketchRepository) ListSketches(ctx context.Context, ownerID string) (_ []*SketchSummary, err error) {
+	ctx, span := r.startSpan(ctx, "ListSketches")
+	defer func() { tracing.End(span, err) }()
+
+	sqlQuery := `
+		SELECT s.id, s.name, s.created_at, s.is_public, s.vector IS NOT NULL,
+			(SELECT COUNT(*) FROM sketch_shares sh WHERE sh.sketch_id = s.id)
+		FROM sketches s
+		WHERE s.owner_id = $1
+		ORDER BY s.created_at DESC
+		LIMIT $2`
+
+	rows, err := r.db.QueryContext(ctx, sqlQuery, ownerID, MaxListedSketches)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sketches: %w", err)
+	}
+	defer rows.Close()
+
+	var summaries []*SketchSummary
+	byID := map[string]*SketchSummary{}
+	for rows.Next() {
+		var summary SketchSummary
+		if err := rows.Scan(&summary.ID, &summary.Name, &summary.CreatedAt, &summary.IsPublic, &summary.IsDrawing, &summary.SharedWithCount); err != nil {
+			return nil, fmt.Errorf("failed to scan sketch row: %w", err)
+		}
+		summaries = append(summaries, &summary)
+		byID[summary.ID] = &summary
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over sketch rows: %w", err)
+	}
+	if len(summaries) == 0 {
+		return summaries, nil
+	}
+
+	ids := make([]string, len(summaries))
+	for i, summary := range summaries {
+		ids[i] = summary.ID
+	}
+	componentRows, err := r.db.QueryContext(ctx, `
+		SELECT id, title, sketch_id FROM uicomponents
+		WHERE user_id = $1 AND archived_at IS NULL AND sketch_id = ANY($2)
+		ORDER BY created_at`, ownerID, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query linked components: %w", err)
+	}
+	defer componentRows.Close()
+
+	for componentRows.Next() {
+		var component LinkedComponent
+		var sketchID string
+		if err := componentRows.Scan(&component.ID, &component.Title, &sketchID); err != nil {
+			return nil, fmt.Errorf("failed to scan linked component row: %w", err)
+		}
+		byID[sketchID].Components = append(byID[sketchID].Components, component)
+	}
+	if err = componentRows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over linked component rows: %w", err)
+	}
+
+	return summaries, nil
+}
+
+// marshalVector encodes a vector sketch for the vector column, NULL for uploaded images
+func marshalVector(v *VectorSketch) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode vector sketch: %w", err)
+	}
+	return data, nil
+}
+
+// unmarshalVector decodes the vector column
+func unmarshalVector(data []byte) (*VectorSketch, error) {
+	if data == nil {
+		return nil, nil
+	}
+	var v VectorSketch
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("failed to decode vector sketch: %w", err)
+	}
+	return &v, nil
+}
@@ -0,0 +1,227 @@
+package sketch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+
+	"sketch-to-ui-final-proj/tracing"
+)
+
+// labelFont is the font text labels are drawn in.
+var labelFont = sync.OnceValues(func() (*opentype.Font, error) {
+	return opentype.Parse(goregular.TTF)
+})
+
+// Rasterize draws a validated vector sketch in the colors of its shapes on white, and
+// encodes it as StoredMediaType.
+func Rasterize(ctx context.Context, v *VectorSketch) (_ []byte, err error) {
+	_, span := tracing.Tracer().Start(ctx, "sketch.Rasterize", trace.WithAttributes(
+		attribute.Int("sketch.shapes", len(v.Shapes)),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	img := image.NewRGBA(image.Rect(0, 0, int(math.Ceil(v.Width)), int(math.Ceil(v.Height))))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	for _, shape := range v.Shapes {
+		if shape.Type == ShapeText {
+			if err := drawText(img, shape); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		lines, polygons := outline(shape)
+		drawOutline(img, shape, lines, polygons)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode sketch as PNG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// outline returns the lines a stroke, rectangle or arrow is drawn with, and the
+// polygons that are filled. Each side of a rectangle is a line of its own, so that
+// only the pixels along the sides are rasterised.
+func outline(shape Shape) (lines [][]Point, polygons [][]Point) {
+	switch shape.Type {
+	case ShapeRect:
+		x0, y0, x1, y1 := shape.X, shape.Y, shape.X+shape.Width, shape.Y+shape.Height
+		return [][]Point{{{x0, y0}, {x1, y0}}, {{x1, y0}, {x1, y1}}, {{x1, y1}, {x0, y1}}, {{x0, y1}, {x0, y0}}}, nil
+	case ShapeArrow:
+		head, shaftEnd := arrowHead(shape)
+		return [][]Point{{shape.Points[0], shaftEnd}}, [][]Point{head}
+	}
+	return [][]Point{shape.Points}, nil
+}
+
+// outlineBounds returns the pixels covered by the lines, at the given stroke width,
+// and by the polygons.
+func outlineBounds(lines, polygons [][]Point, strokeWidth float64) image.Rectangle {
+	half := strokeWidth / 2
+	bounds := image.Rectangle{}
+	for _, p := range slices.Concat(slices.Concat(lines...), slices.Concat(polygons...)) {
+		bounds = bounds.Union(image.Rect(
+			int(math.Floor(p.X-half))-1, int(math.Floor(p.Y-half))-1,
+			int(math.Ceil(p.X+half))+1, int(math.Ceil(p.Y+half))+1,
+		))
+	}
+	return bounds
+}
+
+// rasterArea returns how many pixels Rasterize works through to draw a validated
+// shape. A text label is counted as a square of its font size per character.
+func rasterArea(shape Shape) int {
+	if shape.Type == ShapeText {
+		return len([]rune(shape.Text)) * int(math.Ceil(shape.FontSize*shape.FontSize))
+	}
+	area := 0
+	lines, polygons := outline(shape)
+	if shape.Type == ShapeRect {
+		// The sides of a rectangle are drawn one by one
+		for _, side := range lines {
+			bounds := outlineBounds([][]Point{side}, nil, shape.StrokeWidth)
+			area += bounds.Dx() * bounds.Dy()
+		}
+		return area
+	}
+	bounds := outlineBounds(lines, polygons, shape.StrokeWidth)
+	return bounds.Dx() * bounds.Dy()
+}
+
+// drawOutline draws the lines through each list of points with the shape's stroke
+// width and round joins and caps, and fills the polygons. Everything is rasterised
+// within the bounds of the shape only; the sides of a rectangle are drawn one by one.
+func drawOutline(img *image.RGBA, shape Shape, lines [][]Point, polygons [][]Point) {
+	if shape.Type == ShapeRect {
+		for _, side := range lines {
+			drawOutline(img, Shape{Type: ShapeStroke, Color: shape.Color, StrokeWidth: shape.StrokeWidth}, [][]Point{side}, nil)
+		}
+		return
+	}
+
+	half := shape.StrokeWidth / 2
+	bounds := outlineBounds(lines, polygons, shape.StrokeWidth).Intersect(img.Bounds())
+	if bounds.Empty() {
+		return
+	}
+
+	// Every contour is added counter-clockwise, so overlapping contours add up to a
+	// union rather than cancelling out
+	r := vector.NewRasterizer(bounds.Dx(), bounds.Dy())
+	origin := Point{float64(bounds.Min.X), float64(bounds.Min.Y)}
+	for _, points := range lines {
+		for i, p := range points {
+			addPolygon(r, origin, circle(p, half))
+			if i > 0 {
+				addPolygon(r, origin, segment(points[i-1], p, half))
+			}
+		}
+	}
+	for _, polygon := range polygons {
+		addPolygon(r, origin, polygon)
+	}
+	r.Draw(img, bounds, image.NewUniform(shape.rgba()), image.Point{})
+}
+
+// addPolygon adds a closed contour to r, relative to origin, counter-clockwise.
+func addPolygon(r *vector.Rasterizer, origin Point, polygon []Point) {
+	if len(polygon) < 3 {
+		return
+	}
+	area := 0.0
+	for i, p := range polygon {
+		q := polygon[(i+1)%len(polygon)]
+		area += p.X*q.Y - q.X*p.Y
+	}
+
+	at := func(i int) (float32, float32) {
+		if area < 0 {
+			i = len(polygon) - 1 - i
+		}
+		return float32(polygon[i].X - origin.X), float32(polygon[i].Y - origin.Y)
+	}
+	r.MoveTo(at(0))
+	for i := 1; i < len(polygon); i++ {
+		r.LineTo(at(i))
+	}
+	r.ClosePath()
+}
+
+// segment returns the rectangle covering the line from p to q at width 2*half.
+func segment(p, q Point, half float64) []Point {
+	dx, dy := q.X-p.X, q.Y-p.Y
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return nil
+	}
+	nx, ny := -dy/length*half, dx/length*half
+	return []Point{{p.X + nx, p.Y + ny}, {q.X + nx, q.Y + ny}, {q.X - nx, q.Y - ny}, {p.X - nx, p.Y - ny}}
+}
+
+// circle returns a polygon close enough to a circle at the sizes strokes are drawn.
+func circle(center Point, radius float64) []Point {
+	const sides = 16
+	points := make([]Point, sides)
+	for i := range points {
+		angle := 2 * math.Pi * float64(i) / sides
+		points[i] = Point{center.X + radius*math.Cos(angle), center.Y + radius*math.Sin(angle)}
+	}
+	return points
+}
+
+// arrowHead returns the triangle at the tip of an arrow, sized to its stroke width,
+// and where the shaft meets it, so the round end of the shaft does not blunt the tip.
+func arrowHead(shape Shape) ([]Point, Point) {
+	from, to := shape.Points[0], shape.Points[1]
+	dx, dy := to.X-from.X, to.Y-from.Y
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return nil, to
+	}
+	size := min(max(10, 4*shape.StrokeWidth), length)
+	ux, uy := dx/length, dy/length
+	base := Point{to.X - ux*size, to.Y - uy*size}
+	return []Point{to, {base.X - uy*size/2, base.Y + ux*size/2}, {base.X + uy*size/2, base.Y - ux*size/2}}, base
+}
+
+// drawText draws a label with its top-left corner at the shape's position, one line
+// per line of its text.
+func drawText(img *image.RGBA, shape Shape) error {
+	f, err := labelFont()
+	if err != nil {
+		return fmt.Errorf("failed to load label font: %w", err)
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: shape.FontSize, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return fmt.Errorf("failed to load label font: %w", err)
+	}
+	defer face.Close()
+
+	metrics := face.Metrics()
+	drawer := font.Drawer{Dst: img, Src: image.NewUniform(shape.rgba()), Face: face}
+	baseline := fixed.Int26_6(shape.Y*64) + metrics.Ascent
+	for _, line := range strings.Split(shape.Text, "\n") {
+		drawer.Dot = fixed.Point26_6{X: fixed.Int26_6(shape.X * 64), Y: baseline}
+		drawer.DrawString(line)
+		baseline += metrics.Height
+	}
+	return nil
+}
@@ -1,23 +1,165 @@
 package sketch
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"log/slog"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"sketch-to-ui-final-proj/storage"
 )
 
+// Sketch is an uploaded sketch image. ImageURL holds the image base64-encoded.
 type Sketch struct {
 	ID string `json:"id"`
-	ImageURL string `json:"image_url"`
-	OwnerID  string `json:"owner_id"`
+	// Name defaults to the name of the uploaded file
+	Name      string    `json:"name"`
+	ImageURL  string    `json:"image_url"`
+	MediaType string    `json:"media_type"`
+	OwnerID   string    `json:"owner_id"`
+	CreatedAt time.Time `json:"created_at"`
+	// BlobKey is the key of the image in blob storage, empty for sketches stored before it
+	BlobKey string `json:"-"`
+	// BatchID is shared by the sketches uploaded together in one request
+	BatchID string `json:"batch_id,omitempty"`
+	// Vector holds the shapes of a sketch drawn on the sketchpad, which the image was
+	// rasterised from; it is nil for uploaded images
+	Vector *VectorSketch `json:"-"`
+
+	// IsPublic lets every user view the sketch and generate from it
+	IsPublic bool `json:"is_public"`
+	// SharedWith lists the IDs of the users the owner shared the sketch with
+	SharedWith []string `json:"shared_with,omitempty"`
+}
+
+// SketchSummary is a sketch as listed in the sketch library, without its image.
+type SketchSummary struct {
+	ID              string
+	Name            string
+	CreatedAt       time.Time
+	IsPublic        bool
+	SharedWithCount int
+	// IsDrawing is set for sketches drawn on the sketchpad, which can be opened there again
+	IsDrawing bool
+	// Components lists the owner's components generated from the sketch
+	Components []LinkedComponent
 }
 
-func SetupSketch(r *gin.Engine) *SketchStore {
-	slog.Info("Setting up sketch")
+// LinkedComponent is a component generated from a sketch.
+type LinkedComponent struct {
+	ID    int
+	Title string
+}
+
+// AccessibleBy reports whether userID may view the sketch and generate from it: its
+// owner, the users it was shared with, and everyone once it is public.
+func (s *Sketch) AccessibleBy(userID int) bool {
+	id := strconv.Itoa(userID)
+	if s.OwnerID == id || s.IsPublic {
+		return true
+	}
+	return slices.Contains(s.SharedWith, id)
+}
+
+// DataURI returns the image as a data URI, as sent to the model.
+func (s *Sketch) DataURI() string {
+	mediaType := s.MediaType
+	if mediaType == "" {
+		mediaType = "image/png"
+	}
+	return "data:" + mediaType + ";base64," + s.ImageURL
+}
+
+// LayoutHints describes the shapes of a sketch drawn on the sketchpad, to be added to
+// the prompt next to its image. It is empty for uploaded images.
+func (s *Sketch) LayoutHints() string {
+	if s.Vector == nil {
+		return ""
+	}
+	return s.Vector.LayoutHints()
+}
+
+// ErrSketchNotFound is returned when no sketch has the requested ID, or when the
+// caller may not access it.
+var ErrSketchNotFound = errors.New("sketch not found")
+
+// ErrUserNotFound is returned when a sketch is shared with an unknown email address.
+var ErrUserNotFound = errors.New("user not found")
+
+// SketchRepository stores uploaded sketches and who they are shared with.
+type SketchRepository interface {
+	SaveSketch(ctx context.Context, sketch *Sketch) error
+	// SaveSketches stores a batch of sketches, all of them or none
+	SaveSketches(ctx context.Context, sketches []*Sketch) error
+	// GetSketch returns ErrSketchNotFound when there is no sketch with id
+	GetSketch(ctx context.Context, id string) (*Sketch, error)
+	DeleteSketch(ctx context.Context, id string) error
+	RenameSketch(ctx context.Context, id string, name string) error
+	// ListSketches returns the sketches of a user, newest first
+	ListSketches(ctx context.Context, ownerID string) ([]*SketchSummary, error)
+
+	// ShareSketch shares a sketch with the user registered with email, or returns
+	// ErrUserNotFound. It returns the ID of that user.
+	ShareSketch(ctx context.Context, id string, email string) (string, error)
+	UnshareSketch(ctx context.Context, id string, userID string) error
+	SetSketchPublic(ctx context.Context, id string, public bool) error
+}
+
+// ImageLog keeps copies of the images sent to the model, such as the generation log
+// admins review. A deleted sketch's image is removed from it.
+type ImageLog interface {
+	DeleteImage(ctx context.Context, dataURI string) error
+}
+
+// GetAccessibleSketch returns the sketch with id if userID may access it. Sketches
+// the user may not access are reported as ErrSketchNotFound, so their IDs cannot be
+// probed. Every consumer of a sketch loads it through here.
+func GetAccessibleSketch(ctx context.Context, sketches SketchRepository, id string, userID int) (*Sketch, error) {
+	sketch, err := sketches.GetSketch(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !sketch.AccessibleBy(userID) {
+		return nil, ErrSketchNotFound
+	}
+	return sketch, nil
+}
+
+// SketchCacheTTL is how long a sketch stays in the cache after it was loaded.
+const SketchCacheTTL = time.Hour
+
+// SketchCacheCapacity is how many sketches the cache keeps at most.
+const SketchCacheCapacity = 200
+
+// MaxCachedImageBytes is the size of the largest base64 image that is cached, so the
+// cache holds at most SketchCacheCapacity times as much. Larger sketches are always
+// loaded from the backing repository.
+const MaxCachedImageBytes = 1 << 20
+
+// MaxListedSketches is how many of their newest sketches the library shows a user.
+const MaxListedSketches = 200
+
+// SketchURLExpiry is how long the signed link a sketch image is redirected to stays valid.
+const SketchURLExpiry = 15 * time.Minute
 
-	sketchStore := NewSketchStore()
+// SetupSketch registers the sketch routes and returns the repository sketches are
+// kept in: Postgres with the images in blobs, and the in-memory cache as a read-through
+// layer. Uploads are bounded by LoadUploadLimits. Deleting a sketch removes its image
+// from images too.
+func SetupSketch(r *gin.Engine, db *sql.DB, blobs storage.BlobStore, images ImageLog) (*CachedSketchRepository, error) {
+	limits, err := LoadUploadLimits()
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Setting up sketch", "max_upload_bytes", limits.MaxBodyBytes, "max_image_dimension", limits.MaxDimension)
 
-	RegisterRoutes(r, sketchStore)
-	return sketchStore
+	sketches := NewCachedSketchRepository(NewPostgresSketchRepository(db, blobs), NewBoundedSketchStore(SketchCacheCapacity), SketchCacheTTL)
 
+	RegisterRoutes(r, sketches, blobs, images, limits)
+	return sketches, nil
 }
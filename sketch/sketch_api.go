@@ -2,142 +2,651 @@ package sketch
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"mime/multipart"
 	"net/http"
+	"path/filepath"
 	"sketch-to-ui-final-proj/auth"
+	"sketch-to-ui-final-proj/storage"
+	"sketch-to-ui-final-proj/tracing"
+	"sketch-to-ui-final-proj/utils/htmx"
 	"strconv"
-	"time"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// isImageFile checks if the given file is an image by attempting to decode its header.
-func isImageFile(file *multipart.FileHeader) (bool, error) {
-	if file == nil {
-		return false, nil
-	}
+// processSketchFile reads an uploaded sketch and returns it converted to StoredMediaType.
+func processSketchFile(ctx context.Context, fileHeader *multipart.FileHeader, limits UploadLimits) (_ []byte, err error) {
+	_, span := tracing.Tracer().Start(ctx, "sketch.processSketchFile", trace.WithAttributes(
+		attribute.String("file.name", fileHeader.Filename),
+		attribute.Int64("file.size", fileHeader.Size),
+	))
+	defer func() { tracing.End(span, err) }()
 
-	// Open the file
-	f, err := file.Open()
+	f, err := fileHeader.Open()
 	if err != nil {
-		slog.Error("Error opening file", slog.Any("error", err)) // {{ edit_2 }} Use slog.Error
-		return false, fmt.Errorf("error opening file: %w", err)  // Wrap error
+		return nil, fmt.Errorf("error opening file: %w", err)
 	}
 	defer f.Close()
 
-	// Read the file header to determine the image type
-	buf := make([]byte, 265) // Read enough bytes to determine the image type
-	_, err = io.ReadFull(f, buf)
-	if err != nil && err != io.EOF {
-		slog.Error("Error reading file header", slog.Any("error", err)) // {{ edit_3 }} Use slog.Error
-		return false, fmt.Errorf("error reading file header: %w", err)  // Wrap error
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
 	}
+	span.SetAttributes(attribute.String("file.detected_type", detectImageType(data)))
 
-	// Check for known image headers
-	switch {
-	case bytes.HasPrefix(buf, []byte("\x89\x50\x4E\x47\x0D\x0A\x1A\x0A")): // PNG
-		return true, nil
-	case bytes.HasPrefix(buf, []byte("\xFF\xD8")): // JPEG
-		return true, nil
-	case bytes.HasPrefix(buf, []byte("\x42\x4D")): // BMP
-		return true, nil
+	return normalizeImage(data, limits)
+}
+
+// UploadResult reports what became of one file of an upload: the ID of the sketch it
+// was stored as, or why it was rejected.
+type UploadResult struct {
+	File         string `json:"file"`
+	SketchID     string `json:"sketch_id,omitempty"`
+	Error        string `json:"error,omitempty"`
+	DetectedType string `json:"detected_type,omitempty"`
+
+	status int
+}
 
+// reject records why a file was not stored and the status it would be answered with.
+func (r *UploadResult) reject(ctx context.Context, err error) {
+	var unsupported *UnsupportedImageError
+	var undecodable *ImageDecodeError
+	var oversized *UploadTooLargeError
+	switch {
+	case errors.As(err, &oversized):
+		r.status, r.Error = http.StatusRequestEntityTooLarge, oversized.Error()
+	case errors.As(err, &unsupported):
+		r.status, r.Error, r.DetectedType = http.StatusUnsupportedMediaType, unsupported.Error(), unsupported.DetectedType
+	case errors.As(err, &undecodable):
+		r.status, r.Error, r.DetectedType = http.StatusBadRequest, undecodable.Error(), undecodable.DetectedType
+	default:
+		slog.ErrorContext(ctx, "Error reading file", "file", r.File, slog.Any("error", err))
+		r.status, r.Error = http.StatusInternalServerError, "Failed to read file"
 	}
+}
 
-	return false, nil
+// MaxSketchNameLength caps the names of sketches, in characters.
+const MaxSketchNameLength = 100
+
+// validSketchName reports whether name, trimmed, is 1 to MaxSketchNameLength
+// characters long.
+func validSketchName(name string) bool {
+	length := utf8.RuneCountInString(strings.TrimSpace(name))
+	return length > 0 && length <= MaxSketchNameLength
 }
 
-// uploadSketchHandler handles the upload of sketch files.
-func uploadSketchHandler(sketchStore *SketchStore) gin.HandlerFunc {
+// sketchName returns the default name of a sketch: its file name without extension.
+func sketchName(filename string) string {
+	name := strings.TrimSpace(strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)))
+	if runes := []rune(name); len(runes) > MaxSketchNameLength {
+		name = string(runes[:MaxSketchNameLength])
+	}
+	return name
+}
+
+// uploadSketchHandler handles the upload of one or more sketch files. Every file is
+// checked, and the valid ones are stored together as one batch. The response lists
+// the sketch ID or the error of each file in the order they were sent; sketch_id is
+// the first stored sketch, which is all a single-file upload needs. When no file is
+// valid, the status is the one of the first file's error.
+func uploadSketchHandler(sketches SketchRepository, limits UploadLimits) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		userID, ok := auth.GetUserIDFromContext(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		// Reading stops at the limit, so an oversized upload is never held in memory
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limits.MaxBodyBytes)
+
 		// Get the multipart form
 		form, err := c.MultipartForm()
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": bodyTooLarge(limits).Error()})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse multipart form"})
 			return
 		}
 
-		// Extract the uploaded file
+		// Extract the uploaded files
 		sketchFiles := form.File["sketch"]
 		if len(sketchFiles) == 0 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "No sketch file uploaded"})
 			return
 		}
+		if len(sketchFiles) > limits.MaxFiles {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d sketches can be uploaded at once", limits.MaxFiles)})
+			return
+		}
 
-		// Process each uploaded file
-		for _, fileHeader := range sketchFiles {
+		batchID := uuid.New().String()
+		results := make([]UploadResult, len(sketchFiles))
+		var batch []*Sketch
+		for i, fileHeader := range sketchFiles {
+			results[i].File = fileHeader.Filename
 
-			isImage, err := isImageFile(fileHeader) // Get boolean and error
+			// Whatever the upload's name or declared type, its content decides how it is read
+			image, err := processSketchFile(c.Request.Context(), fileHeader, limits)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking file type"}) // Handle error
-				slog.Error("File type check error", slog.Any("error", err))                       
-				return
+				results[i].reject(c.Request.Context(), err)
+				continue
 			}
-			if !isImage {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Uploaded file is not an image"})
-				return
+
+			sketch := &Sketch{
+				ID:        uuid.New().String(),
+				Name:      sketchName(fileHeader.Filename),
+				ImageURL:  base64.StdEncoding.EncodeToString(image),
+				MediaType: StoredMediaType,
+				OwnerID:   strconv.Itoa(userID),
+				BatchID:   batchID,
 			}
+			batch = append(batch, sketch)
+			results[i].SketchID = sketch.ID
+		}
 
-			// Open the file
-			f, err := fileHeader.Open()
+		if len(batch) == 0 {
+			c.JSON(results[0].status, gin.H{
+				"error":         results[0].Error,
+				"detected_type": results[0].DetectedType,
+				"results":       results,
+			})
+			return
+		}
+
+		if err := sketches.SaveSketches(c.Request.Context(), batch); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save sketch"})
+			slog.ErrorContext(c.Request.Context(), "Error saving sketches", "batch_id", batchID, slog.Any("error", err))
+			return
+		}
+
+		message := "File uploaded successfully"
+		if len(sketchFiles) > 1 {
+			message = fmt.Sprintf("%d of %d sketches uploaded", len(batch), len(sketchFiles))
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message":   message,
+			"sketch_id": batch[0].ID,
+			"batch_id":  batchID,
+			"results":   results,
+		})
+	}
+}
+
+// serveSketchHandler serves the image of a sketch the caller may access. Images in blob
+// storage are redirected to a signed link that expires, so they are downloaded from the
+// storage backend. Older sketches are served from the database; they never change
+// after upload, so the image is cached for long and revalidated by its hash, and
+// http.ServeContent answers Range and conditional requests.
+func serveSketchHandler(sketches SketchRepository, blobs storage.BlobStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := auth.GetUserIDFromContext(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		// SECURITY: Sketches the caller may not access are reported as missing, so IDs cannot be probed
+		sketch, err := GetAccessibleSketch(c.Request.Context(), sketches, c.Param("id"), userID)
+		if errors.Is(err, ErrSketchNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sketch not found"})
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Error loading sketch", "sketch_id", c.Param("id"), slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load sketch"})
+			return
+		}
+
+		if sketch.BlobKey != "" {
+			signedURL, err := blobs.SignedURL(c.Request.Context(), sketch.BlobKey, SketchURLExpiry)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open file"})
-				slog.Error("Error opening file", slog.Any("error", err)) 
+				slog.ErrorContext(c.Request.Context(), "Error signing sketch URL", "sketch_id", sketch.ID, slog.Any("error", err))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load sketch"})
 				return
 			}
-			defer f.Close()
+			// The link expires, so the redirect itself must not be cached for longer
+			c.Header("Cache-Control", "private, no-store")
+			c.Redirect(http.StatusFound, signedURL)
+			return
+		}
 
-			// Read the entire file contents
-			buf := bytes.NewBuffer(nil)
-			_, err = io.Copy(buf, f)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
-				slog.Error("Error reading file", slog.Any("error", err)) 
-				return
+		image, err := base64.StdEncoding.DecodeString(sketch.ImageURL)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Stored sketch is not valid base64", "sketch_id", sketch.ID, slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load sketch"})
+			return
+		}
+
+		sum := sha256.Sum256(image)
+		mediaType := sketch.MediaType
+		if mediaType == "" {
+			mediaType = "image/png"
+		}
+		c.Header("Content-Type", mediaType)
+		c.Header("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+		c.Header("Cache-Control", "private, max-age=31536000, immutable")
+		c.Header("X-Content-Type-Options", "nosniff")
+		http.ServeContent(c.Writer, c.Request, "", sketch.CreatedAt, bytes.NewReader(image))
+	}
+}
+
+// ownedSketch loads the sketch named by the :id parameter if the caller owns it, and
+// otherwise writes the error response. Only owners change who a sketch is shared with.
+func ownedSketch(c *gin.Context, sketches SketchRepository) (*Sketch, bool) {
+	userID, ok := auth.GetUserIDFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+
+	sketch, err := sketches.GetSketch(c.Request.Context(), c.Param("id"))
+	if err != nil && !errors.Is(err, ErrSketchNotFound) {
+		slog.ErrorContext(c.Request.Context(), "Error loading sketch", "sketch_id", c.Param("id"), slog.Any("error", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load sketch"})
+		return nil, false
+	}
+	// SECURITY: Users the sketch is shared with may use it but not reshare it
+	if sketch == nil || sketch.OwnerID != strconv.Itoa(userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sketch not found"})
+		return nil, false
+	}
+	return sketch, true
+}
+
+// ShareSketchRequest names the user to share a sketch with
+type ShareSketchRequest struct {
+	Email string `form:"email" binding:"required,email"`
+}
+
+// shareSketchHandler shares a sketch with another registered user.
+func shareSketchHandler(sketches SketchRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sketch, ok := ownedSketch(c, sketches)
+		if !ok {
+			return
+		}
+
+		var req ShareSketchRequest
+		if err := c.ShouldBind(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A valid email is required"})
+			return
+		}
+
+		userID, err := sketches.ShareSketch(c.Request.Context(), sketch.ID, req.Email)
+		if errors.Is(err, ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No user is registered with that email"})
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Error sharing sketch", "sketch_id", sketch.ID, slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share sketch"})
+			return
+		}
+
+		htmx.TriggerToast(c, htmx.InfoLevel, "Sketch shared with "+req.Email)
+		c.JSON(http.StatusOK, gin.H{"message": "Sketch shared", "user_id": userID})
+	}
+}
+
+// unshareSketchHandler stops sharing a sketch with a user.
+func unshareSketchHandler(sketches SketchRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sketch, ok := ownedSketch(c, sketches)
+		if !ok {
+			return
+		}
+
+		if err := sketches.UnshareSketch(c.Request.Context(), sketch.ID, c.Param("userID")); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Error unsharing sketch", "sketch_id", sketch.ID, slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unshare sketch"})
+			return
+		}
+
+		htmx.TriggerToast(c, htmx.InfoLevel, "Sketch is no longer shared with this user")
+		c.JSON(http.StatusOK, gin.H{"message": "Sketch unshared"})
+	}
+}
+
+// SketchVisibilityRequest makes a sketch public or private
+type SketchVisibilityRequest struct {
+	Public *bool `form:"public" binding:"required"`
+}
+
+// setSketchVisibilityHandler makes a sketch public or private again.
+func setSketchVisibilityHandler(sketches SketchRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sketch, ok := ownedSketch(c, sketches)
+		if !ok {
+			return
+		}
+
+		var req SketchVisibilityRequest
+		if err := c.ShouldBind(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "public must be true or false"})
+			return
+		}
+
+		if err := sketches.SetSketchPublic(c.Request.Context(), sketch.ID, *req.Public); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Error changing sketch visibility", "sketch_id", sketch.ID, slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change sketch visibility"})
+			return
+		}
+
+		message := "Sketch is now private"
+		if *req.Public {
+			message = "Sketch is now public"
+		}
+		htmx.TriggerToast(c, htmx.InfoLevel, message)
+		c.JSON(http.StatusOK, gin.H{"message": message, "is_public": *req.Public})
+	}
+}
+
+// sketchLibraryHandler renders the library of the caller's sketches.
+func sketchLibraryHandler(sketches SketchRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := auth.GetUserIDFromContext(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		summaries, err := sketches.ListSketches(c.Request.Context(), strconv.Itoa(userID))
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Error listing sketches", "user_id", userID, slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load sketches"})
+			return
+		}
+
+		c.HTML(http.StatusOK, "sketch-library.html", gin.H{
+			"Sketches":   summaries,
+			"MaxListed":  MaxListedSketches,
+			"NameLength": MaxSketchNameLength,
+		})
+	}
+}
+
+// thumbnailHandler serves a small PNG of a sketch the caller may access. Thumbnails
+// are made on first request and kept in blob storage.
+func thumbnailHandler(sketches SketchRepository, blobs storage.BlobStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := auth.GetUserIDFromContext(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		// SECURITY: Sketches the caller may not access are reported as missing, so IDs cannot be probed
+		sketch, err := GetAccessibleSketch(c.Request.Context(), sketches, c.Param("id"), userID)
+		if errors.Is(err, ErrSketchNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sketch not found"})
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Error loading sketch", "sketch_id", c.Param("id"), slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load sketch"})
+			return
+		}
+
+		image, err := base64.StdEncoding.DecodeString(sketch.ImageURL)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Stored sketch is not valid base64", "sketch_id", sketch.ID, slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load sketch"})
+			return
+		}
+
+		key := thumbnailKey(image)
+		thumbnail, err := blobs.Get(c.Request.Context(), key)
+		if errors.Is(err, storage.ErrBlobNotFound) {
+			thumbnail, err = makeThumbnail(image, ThumbnailSize)
+			if err == nil {
+				err = blobs.Put(c.Request.Context(), key, thumbnail, "image/png")
+			}
+		}
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Error making sketch thumbnail", "sketch_id", sketch.ID, slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load thumbnail"})
+			return
+		}
+
+		c.Header("Cache-Control", "private, max-age=86400")
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Data(http.StatusOK, "image/png", thumbnail)
+	}
+}
+
+// RenameSketchRequest carries the new name of a sketch
+type RenameSketchRequest struct {
+	Name string `form:"name" binding:"required"`
+}
+
+// renameSketchHandler renames a sketch and reloads the library.
+func renameSketchHandler(sketches SketchRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sketch, ok := ownedSketch(c, sketches)
+		if !ok {
+			return
+		}
+
+		var req RenameSketchRequest
+		if err := c.ShouldBind(&req); err != nil || !validSketchName(req.Name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("The name must be 1 to %d characters long", MaxSketchNameLength)})
+			return
+		}
+
+		if err := sketches.RenameSketch(c.Request.Context(), sketch.ID, strings.TrimSpace(req.Name)); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Error renaming sketch", "sketch_id", sketch.ID, slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename sketch"})
+			return
+		}
+
+		htmx.TriggerToast(c, htmx.InfoLevel, "Sketch renamed")
+		reloadLibrary(c)
+	}
+}
+
+// deleteSketchHandler deletes a sketch, its thumbnail and its copy in the image log.
+// Components generated from it are kept.
+func deleteSketchHandler(sketches SketchRepository, blobs storage.BlobStore, images ImageLog) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sketch, ok := ownedSketch(c, sketches)
+		if !ok {
+			return
+		}
+
+		if err := sketches.DeleteSketch(c.Request.Context(), sketch.ID); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Error deleting sketch", "sketch_id", sketch.ID, slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete sketch"})
+			return
+		}
+
+		// The sketch is gone; copies that are left behind are only logged. A thumbnail
+		// still needed by another upload of the same image is made again on request.
+		if image, err := base64.StdEncoding.DecodeString(sketch.ImageURL); err == nil {
+			if err := blobs.Delete(c.Request.Context(), thumbnailKey(image)); err != nil {
+				slog.ErrorContext(c.Request.Context(), "Error deleting sketch thumbnail", "sketch_id", sketch.ID, slog.Any("error", err))
 			}
+		}
+		if err := images.DeleteImage(c.Request.Context(), sketch.DataURI()); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Error deleting logged sketch image", "sketch_id", sketch.ID, slog.Any("error", err))
+		}
 
-			// Convert the file contents to base64
-			base64Image := base64.StdEncoding.EncodeToString(buf.Bytes())
+		htmx.TriggerToast(c, htmx.InfoLevel, "Sketch deleted")
+		reloadLibrary(c)
+	}
+}
+
+// reloadLibrary tells htmx to load the sketch library again.
+func reloadLibrary(c *gin.Context) {
+	location := map[string]interface{}{
+		"path":   "/sketches",
+		"target": "#content",
+	}
+	locationJSON, err := json.Marshal(location)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal HX-Location"})
+		return
+	}
+	c.Header("HX-Location", string(locationJSON))
+	c.Status(http.StatusOK)
+}
 
-			// Store or process the base64 image as needed
-			// For example, you can save it to a database or send it to another service
-			// Example:
-			// SaveToDatabase(base64Image)
+// sketchpadHandler serves the sketchpad HTML page. With ?sketch_id= of a drawing the
+// caller may access, the sketchpad opens a copy of it.
+func sketchpadHandler(sketches SketchRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data := gin.H{"NameLength": MaxSketchNameLength}
+		if sketchID := c.Query("sketch_id"); sketchID != "" {
+			userID, _ := auth.GetUserIDFromContext(c)
+			// SECURITY: Only drawings the user may access are opened
+			sketch, err := GetAccessibleSketch(c.Request.Context(), sketches, sketchID, userID)
+			if err == nil && sketch.Vector != nil {
+				data["SketchID"] = sketch.ID
+			}
+		}
+		c.HTML(http.StatusOK, "sketch", data)
+	}
+}
+
+// VectorSketchRequest is a sketch drawn on the sketchpad and its name.
+type VectorSketchRequest struct {
+	Name string `json:"name"`
+	VectorSketch
+}
+
+// DefaultDrawingName names drawings saved without a name.
+const DefaultDrawingName = "Sketchpad drawing"
+
+// saveDrawingHandler stores a sketch drawn on the sketchpad. The shapes are kept as
+// the canonical sketch and rasterised to the PNG image that is served and sent to the
+// model, like an uploaded image.
+func saveDrawingHandler(sketches SketchRepository, limits UploadLimits) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := auth.GetUserIDFromContext(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		// Reading stops at the limit, so an oversized drawing is never held in memory
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limits.MaxBodyBytes)
+
+		var req VectorSketchRequest
+		err := c.ShouldBindJSON(&req)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": bodyTooLarge(limits).Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid drawing", "details": err.Error()})
+			return
+		}
+		if utf8.RuneCountInString(strings.TrimSpace(req.Name)) > MaxSketchNameLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("The name must be at most %d characters long", MaxSketchNameLength)})
+			return
+		}
 
-			sketchID := uuid.New().String()
-			userID, ok := auth.GetUserIDFromContext(c)
-			if !ok {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		if err := req.Validate(limits); err != nil {
+			var oversized *UploadTooLargeError
+			if errors.As(err, &oversized) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": oversized.Error()})
 				return
 			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid drawing", "details": err.Error()})
+			return
+		}
 
-			sketchStore.SetSketch(sketchID, &Sketch{
-				ID:       sketchID,
-				ImageURL: base64Image,
-				OwnerID:  strconv.Itoa(userID),
-			}, 24*time.Hour)
+		image, err := Rasterize(c.Request.Context(), &req.VectorSketch)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Error rasterising drawing", slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to draw the sketch"})
+			return
+		}
 
-			c.JSON(http.StatusOK, gin.H{
-				"message":   "File uploaded successfully",
-				"sketch_id": sketchID,
-			})
+		name := strings.TrimSpace(req.Name)
+		if name == "" {
+			name = DefaultDrawingName
+		}
+		sketch := &Sketch{
+			ID:        uuid.New().String(),
+			Name:      name,
+			ImageURL:  base64.StdEncoding.EncodeToString(image),
+			MediaType: StoredMediaType,
+			OwnerID:   strconv.Itoa(userID),
+			Vector:    &req.VectorSketch,
 		}
+		if err := sketches.SaveSketch(c.Request.Context(), sketch); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Error saving drawing", "sketch_id", sketch.ID, slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save sketch"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Sketch saved", "sketch_id": sketch.ID})
 	}
 }
 
-// sketchpadHandler serves the sketchpad HTML page.
-func sketchpadHandler(c *gin.Context) {
-	c.HTML(http.StatusOK, "sketch", nil)
+// vectorHandler returns the shapes of a drawing the caller may access, in the format
+// the sketchpad saves. Uploaded images have none and are reported as missing.
+func vectorHandler(sketches SketchRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := auth.GetUserIDFromContext(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			return
+		}
+
+		// SECURITY: Sketches the caller may not access are reported as missing, so IDs cannot be probed
+		sketch, err := GetAccessibleSketch(c.Request.Context(), sketches, c.Param("id"), userID)
+		if errors.Is(err, ErrSketchNotFound) || (err == nil && sketch.Vector == nil) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Drawing not found"})
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Error loading sketch", "sketch_id", c.Param("id"), slog.Any("error", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load sketch"})
+			return
+		}
+
+		c.JSON(http.StatusOK, VectorSketchRequest{Name: sketch.Name, VectorSketch: *sketch.Vector})
+	}
 }
 
-func RegisterRoutes(r *gin.Engine, sketchStore *SketchStore) {
+func RegisterRoutes(r *gin.Engine, sketches SketchRepository, blobs storage.BlobStore, images ImageLog, limits UploadLimits) {
 	slog.Info("Registering Sketch Routes")
 
-	r.GET("/sketchpad", auth.AuthRequiredMiddleware(), sketchpadHandler)
-	r.POST("/upload", auth.AuthRequiredMiddleware(), uploadSketchHandler(sketchStore))
+	r.GET("/sketchpad", auth.AuthRequiredMiddleware(), sketchpadHandler(sketches))
+	r.POST("/sketchpad", auth.AuthRequiredMiddleware(), saveDrawingHandler(sketches, limits))
+	r.POST("/upload", auth.AuthRequiredMiddleware(), uploadSketchHandler(sketches, limits))
+	r.GET("/uploads/:id", auth.AuthRequiredMiddleware(), serveSketchHandler(sketches, blobs))
+
+	library := r.Group("/sketches", auth.AuthRequiredMiddleware())
+	{
+		library.GET("", sketchLibraryHandler(sketches))
+		library.PATCH("/:id", renameSketchHandler(sketches))
+		library.DELETE("/:id", deleteSketchHandler(sketches, blobs, images))
+		library.GET("/:id/thumbnail", thumbnailHandler(sketches, blobs))
+		library.GET("/:id/vector", vectorHandler(sketches))
+		library.POST("/:id/shares", shareSketchHandler(sketches))
+		library.DELETE("/:id/shares/:userID", unshareSketchHandler(sketches))
+		library.PUT("/:id/visibility", setSketchVisibilityHandler(sketches))
+	}
 }
@@ -2,29 +2,31 @@ package sketch
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
+
+	"sketch-to-ui-final-proj/auth"
+	"sketch-to-ui-final-proj/storage"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestUploadSketchHandler_ValidImage tests the image upload handler with a valid image.
 func TestUploadSketchHandler_ValidImage(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
-	// Create a dummy valid PNG header (first 8 bytes)
-	validImage := []byte("\x89\x50\x4E\x47\x0D\x0A\x1A\x0A")
-	// Append some extra content to simulate a file.
-	validImage = append(validImage, []byte("dummydata")...)
-
-	// Ensure the dummy image is at least 265 bytes, append zero bytes if necessary.
-	if len(validImage) < 265 {
-		padding := make([]byte, 265-len(validImage))
-		validImage = append(validImage, padding...)
-	}
+	// Uploads are decoded, so the file must be a complete image
+	validImage := encodeTestImage(t, "image/png")
 
 	// Create a multipart form file.
 	body := &bytes.Buffer{}
@@ -46,17 +48,22 @@ func TestUploadSketchHandler_ValidImage(t *testing.T) {
 	c.Request = req
 
 	// Simulate user ID in context using a test-specific key.
-	c.Set("userID", 123)
+	c.Set("userID", auth.ID(123))
 
-	// Initialize the SketchStore and handler.
-	sketchStore := NewSketchStore()
-	handler := uploadSketchHandler(sketchStore)
+	// Initialize the repository and handler.
+	sketches := newMemoryRepository()
+	handler := uploadSketchHandler(sketches, DefaultUploadLimits)
 
 	// Call the handler.
 	handler(c)
 
-	// Assert success (200 OK).
+	// Assert success (200 OK) and that the sketch was stored with its type.
 	assert.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, sketches.sketches, 1)
+	for _, sketch := range sketches.sketches {
+		assert.Equal(t, "image/png", sketch.MediaType)
+		assert.Equal(t, "123", sketch.OwnerID)
+	}
 }
 
 // TestUploadSketchHandler_NoFile tests the image upload handler with no file provided.
@@ -77,10 +84,9 @@ func TestUploadSketchHandler_NoFile(t *testing.T) {
 	c.Request = req
 
 	// Simulate user ID in context using a test-specific key.
-	c.Set("userID", 123)
+	c.Set("userID", auth.ID(123))
 
-	sketchStore := NewSketchStore()
-	handler := uploadSketchHandler(sketchStore)
+	handler := uploadSketchHandler(newMemoryRepository(), DefaultUploadLimits)
 
 	handler(c)
 
@@ -89,3 +95,513 @@ func TestUploadSketchHandler_NoFile(t *testing.T) {
 }
 
 
+
+// TestUploadSketchHandler_UnsupportedType tests that the detected type is named when
+// an upload is not in a supported format, even if its name says otherwise.
+func TestUploadSketchHandler_UnsupportedType(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("sketch", "drawing.png")
+	require.NoError(t, err)
+	_, err = part.Write(encodeTestImage(t, "image/tiff"))
+	require.NoError(t, err)
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+	c.Set("userID", auth.ID(123))
+
+	sketches := newMemoryRepository()
+	uploadSketchHandler(sketches, DefaultUploadLimits)(c)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	assert.Contains(t, w.Body.String(), "image/tiff")
+	assert.Empty(t, sketches.sketches)
+}
+
+// TestUploadSketchHandler_TooLarge tests that uploads over the size limit are cut off
+// with 413 and a message the upload modal can show.
+func TestUploadSketchHandler_TooLarge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("sketch", "huge.png")
+	require.NoError(t, err)
+	_, err = part.Write(bytes.Repeat([]byte{0}, 4096))
+	require.NoError(t, err)
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+	c.Set("userID", auth.ID(123))
+
+	limits := DefaultUploadLimits
+	limits.MaxBodyBytes = 1024
+	uploadSketchHandler(newMemoryRepository(), limits)(c)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), "larger than 1 KB")
+}
+
+// uploadFiles posts the files with the given names to the upload handler as user 123.
+func uploadFiles(t *testing.T, sketches SketchRepository, limits UploadLimits, names []string, files [][]byte) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for i, name := range names {
+		part, err := writer.CreateFormFile("sketch", name)
+		require.NoError(t, err)
+		_, err = part.Write(files[i])
+		require.NoError(t, err)
+	}
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+	c.Set("userID", auth.ID(123))
+
+	uploadSketchHandler(sketches, limits)(c)
+	return w
+}
+
+// TestUploadSketchHandler_Batch tests that the valid files of a batch are stored
+// together and every file is reported in order.
+func TestUploadSketchHandler_Batch(t *testing.T) {
+	sketches := newMemoryRepository()
+	w := uploadFiles(t, sketches, DefaultUploadLimits,
+		[]string{"home.png", "scan.tiff", "menu.gif"},
+		[][]byte{encodeTestImage(t, "image/png"), encodeTestImage(t, "image/tiff"), encodeTestImage(t, "image/gif")})
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		SketchID string         `json:"sketch_id"`
+		BatchID  string         `json:"batch_id"`
+		Results  []UploadResult `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Results, 3)
+
+	assert.Equal(t, "home.png", response.Results[0].File)
+	assert.Equal(t, response.SketchID, response.Results[0].SketchID)
+	assert.Empty(t, response.Results[1].SketchID)
+	assert.Equal(t, "image/tiff", response.Results[1].DetectedType)
+	assert.NotEmpty(t, response.Results[1].Error)
+	assert.NotEmpty(t, response.Results[2].SketchID)
+
+	require.Len(t, sketches.sketches, 2)
+	for _, sketch := range sketches.sketches {
+		assert.Equal(t, response.BatchID, sketch.BatchID)
+	}
+}
+
+func TestUploadSketchHandler_TooManyFiles(t *testing.T) {
+	limits := DefaultUploadLimits
+	limits.MaxFiles = 1
+	image := encodeTestImage(t, "image/png")
+
+	sketches := newMemoryRepository()
+	w := uploadFiles(t, sketches, limits, []string{"a.png", "b.png"}, [][]byte{image, image})
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, sketches.sketches)
+}
+
+// newServeRouter serves and shares sketches from repo for a caller logged in as userID.
+func newServeRouter(repo SketchRepository, userID auth.ID) *gin.Engine {
+	return newServeRouterWithBlobs(repo, nil, userID)
+}
+
+func newServeRouterWithBlobs(repo SketchRepository, blobs storage.BlobStore, userID auth.ID) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", userID)
+		c.Next()
+	})
+	router.GET("/uploads/:id", serveSketchHandler(repo, blobs))
+	router.POST("/sketches/:id/shares", shareSketchHandler(repo))
+	router.DELETE("/sketches/:id/shares/:userID", unshareSketchHandler(repo))
+	router.PUT("/sketches/:id/visibility", setSketchVisibilityHandler(repo))
+	router.PATCH("/sketches/:id", renameSketchHandler(repo))
+	router.GET("/sketches/:id/thumbnail", thumbnailHandler(repo, blobs))
+	router.GET("/sketches/:id/vector", vectorHandler(repo))
+	router.POST("/sketchpad", saveDrawingHandler(repo, DefaultUploadLimits))
+	return router
+}
+
+func newServedSketch() *memoryRepository {
+	repo := newMemoryRepository()
+	repo.sketches["s1"] = &Sketch{
+		ID:        "s1",
+		ImageURL:  base64.StdEncoding.EncodeToString([]byte("0123456789")),
+		MediaType: "image/jpeg",
+		OwnerID:   "7",
+		CreatedAt: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	return repo
+}
+
+func TestServeSketchHandler_Owner(t *testing.T) {
+	router := newServeRouter(newServedSketch(), 7)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/uploads/s1", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0123456789", w.Body.String())
+	assert.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+	assert.NotEmpty(t, w.Header().Get("ETag"))
+	assert.Contains(t, w.Header().Get("Cache-Control"), "private")
+}
+
+func TestServeSketchHandler_NotOwnerOrMissing(t *testing.T) {
+	router := newServeRouter(newServedSketch(), 8)
+
+	for _, path := range []string{"/uploads/s1", "/uploads/missing"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+	}
+}
+
+func TestServeSketchHandler_RangeAndConditional(t *testing.T) {
+	router := newServeRouter(newServedSketch(), 7)
+
+	req := httptest.NewRequest("GET", "/uploads/s1", nil)
+	req.Header.Set("Range", "bytes=2-4")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "234", w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/uploads/s1", nil))
+	etag := w.Header().Get("ETag")
+
+	req = httptest.NewRequest("GET", "/uploads/s1", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+}
+
+func TestSketchAccessibleBy(t *testing.T) {
+	tests := []struct {
+		name   string
+		sketch Sketch
+		userID int
+		want   bool
+	}{
+		{"owner", Sketch{OwnerID: "7"}, 7, true},
+		{"stranger", Sketch{OwnerID: "7"}, 8, false},
+		{"shared", Sketch{OwnerID: "7", SharedWith: []string{"9", "8"}}, 8, true},
+		{"shared with someone else", Sketch{OwnerID: "7", SharedWith: []string{"9"}}, 8, false},
+		{"public", Sketch{OwnerID: "7", IsPublic: true}, 8, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.sketch.AccessibleBy(tt.userID))
+		})
+	}
+}
+
+func TestServeSketchHandler_SharedAndPublic(t *testing.T) {
+	repo := newServedSketch()
+	repo.sketches["s1"].SharedWith = []string{"8"}
+
+	w := httptest.NewRecorder()
+	newServeRouter(repo, 8).ServeHTTP(w, httptest.NewRequest("GET", "/uploads/s1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	newServeRouter(repo, 9).ServeHTTP(w, httptest.NewRequest("GET", "/uploads/s1", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	repo.sketches["s1"].IsPublic = true
+	w = httptest.NewRecorder()
+	newServeRouter(repo, 9).ServeHTTP(w, httptest.NewRequest("GET", "/uploads/s1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestGetAccessibleSketch(t *testing.T) {
+	repo := newServedSketch()
+
+	sketch, err := GetAccessibleSketch(context.Background(), repo, "s1", 7)
+	require.NoError(t, err)
+	assert.Equal(t, "s1", sketch.ID)
+
+	// Another user's sketch is indistinguishable from a missing one
+	_, err = GetAccessibleSketch(context.Background(), repo, "s1", 8)
+	assert.ErrorIs(t, err, ErrSketchNotFound)
+	_, err = GetAccessibleSketch(context.Background(), repo, "missing", 7)
+	assert.ErrorIs(t, err, ErrSketchNotFound)
+}
+
+func shareRequest(method, path string, form url.Values) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func TestShareSketchHandler(t *testing.T) {
+	repo := newServedSketch()
+	repo.users["friend@example.com"] = "8"
+	owner := newServeRouter(repo, 7)
+
+	w := httptest.NewRecorder()
+	owner.ServeHTTP(w, shareRequest("POST", "/sketches/s1/shares", url.Values{"email": {"friend@example.com"}}))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, repo.sketches["s1"].AccessibleBy(8))
+
+	w = httptest.NewRecorder()
+	owner.ServeHTTP(w, shareRequest("POST", "/sketches/s1/shares", url.Values{"email": {"nobody@example.com"}}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	owner.ServeHTTP(w, shareRequest("POST", "/sketches/s1/shares", url.Values{"email": {"not-an-email"}}))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Users a sketch is shared with can use it but not share it further
+	repo.users["other@example.com"] = "9"
+	w = httptest.NewRecorder()
+	newServeRouter(repo, 8).ServeHTTP(w, shareRequest("POST", "/sketches/s1/shares", url.Values{"email": {"other@example.com"}}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.False(t, repo.sketches["s1"].AccessibleBy(9))
+
+	w = httptest.NewRecorder()
+	owner.ServeHTTP(w, httptest.NewRequest("DELETE", "/sketches/s1/shares/8", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, repo.sketches["s1"].AccessibleBy(8))
+}
+
+func TestSetSketchVisibilityHandler(t *testing.T) {
+	repo := newServedSketch()
+
+	w := httptest.NewRecorder()
+	newServeRouter(repo, 8).ServeHTTP(w, shareRequest("PUT", "/sketches/s1/visibility", url.Values{"public": {"true"}}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.False(t, repo.sketches["s1"].IsPublic)
+
+	w = httptest.NewRecorder()
+	newServeRouter(repo, 7).ServeHTTP(w, shareRequest("PUT", "/sketches/s1/visibility", url.Values{}))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	newServeRouter(repo, 7).ServeHTTP(w, shareRequest("PUT", "/sketches/s1/visibility", url.Values{"public": {"true"}}))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, repo.sketches["s1"].AccessibleBy(8))
+}
+
+func TestServeSketchHandler_RedirectsToSignedBlobURL(t *testing.T) {
+	blobs, err := storage.NewFileSystemStore(t.TempDir(), []byte("0123456789abcdef"))
+	require.NoError(t, err)
+	repo := newServedSketch()
+	repo.sketches["s1"].BlobKey = storage.ContentKey("sketches", []byte("0123456789"), "image/jpeg")
+
+	w := httptest.NewRecorder()
+	newServeRouterWithBlobs(repo, blobs, 7).ServeHTTP(w, httptest.NewRequest("GET", "/uploads/s1", nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Location"), "/blobs/"+repo.sketches["s1"].BlobKey+"?"))
+	assert.Contains(t, w.Header().Get("Location"), "signature=")
+
+	// Access is checked before a link is signed
+	w = httptest.NewRecorder()
+	newServeRouterWithBlobs(repo, blobs, 8).ServeHTTP(w, httptest.NewRequest("GET", "/uploads/s1", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSketchName(t *testing.T) {
+	assert.Equal(t, "landing page", sketchName("landing page.png"))
+	assert.Equal(t, "scan", sketchName("photos/scan.jpeg"))
+	assert.Equal(t, 100, len([]rune(sketchName(strings.Repeat("é", 150)+".png"))))
+}
+
+func TestRenameSketchHandler(t *testing.T) {
+	repo := newServedSketch()
+
+	w := httptest.NewRecorder()
+	newServeRouter(repo, 7).ServeHTTP(w, shareRequest("PATCH", "/sketches/s1", url.Values{"name": {"  Pricing page "}}))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("HX-Location"), "/sketches")
+	assert.Equal(t, "Pricing page", repo.sketches["s1"].Name)
+
+	w = httptest.NewRecorder()
+	newServeRouter(repo, 7).ServeHTTP(w, shareRequest("PATCH", "/sketches/s1", url.Values{"name": {"   "}}))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	newServeRouter(repo, 8).ServeHTTP(w, shareRequest("PATCH", "/sketches/s1", url.Values{"name": {"Mine now"}}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "Pricing page", repo.sketches["s1"].Name)
+
+	// Names are limited to MaxSketchNameLength characters, not bytes
+	w = httptest.NewRecorder()
+	newServeRouter(repo, 7).ServeHTTP(w, shareRequest("PATCH", "/sketches/s1", url.Values{"name": {strings.Repeat("é", MaxSketchNameLength+1)}}))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = httptest.NewRecorder()
+	newServeRouter(repo, 7).ServeHTTP(w, shareRequest("PATCH", "/sketches/s1", url.Values{"name": {strings.Repeat("é", MaxSketchNameLength)}}))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, strings.Repeat("é", MaxSketchNameLength), repo.sketches["s1"].Name)
+}
+
+// memoryImageLog is an ImageLog kept in memory.
+type memoryImageLog map[string]bool
+
+func (l memoryImageLog) DeleteImage(_ context.Context, dataURI string) error {
+	delete(l, dataURI)
+	return nil
+}
+
+// newDeleteRouter deletes sketches from repo, and their copies in blobs and images,
+// for a caller logged in as userID.
+func newDeleteRouter(repo SketchRepository, blobs storage.BlobStore, images ImageLog, userID auth.ID) *gin.Engine {
+	router := newServeRouterWithBlobs(repo, blobs, userID)
+	router.DELETE("/sketches/:id", deleteSketchHandler(repo, blobs, images))
+	return router
+}
+
+func TestDeleteSketchHandler(t *testing.T) {
+	blobs, err := storage.NewFileSystemStore(t.TempDir(), []byte("0123456789abcdef"))
+	require.NoError(t, err)
+	repo := newServedSketch()
+	repo.sketches["s1"].SharedWith = []string{"8"}
+	image := []byte("0123456789")
+	require.NoError(t, blobs.Put(context.Background(), thumbnailKey(image), []byte("thumbnail"), "image/png"))
+	images := memoryImageLog{repo.sketches["s1"].DataURI(): true}
+
+	// Users a sketch is shared with cannot delete it
+	w := httptest.NewRecorder()
+	newDeleteRouter(repo, blobs, images, 8).ServeHTTP(w, httptest.NewRequest("DELETE", "/sketches/s1", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, repo.sketches, "s1")
+	assert.Len(t, images, 1)
+
+	// The thumbnail and the logged image go with the sketch
+	w = httptest.NewRecorder()
+	newDeleteRouter(repo, blobs, images, 7).ServeHTTP(w, httptest.NewRequest("DELETE", "/sketches/s1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, repo.sketches, "s1")
+	assert.Empty(t, images)
+	_, err = blobs.Get(context.Background(), thumbnailKey(image))
+	assert.ErrorIs(t, err, storage.ErrBlobNotFound)
+}
+
+func TestThumbnailHandler(t *testing.T) {
+	blobs, err := storage.NewFileSystemStore(t.TempDir(), []byte("0123456789abcdef"))
+	require.NoError(t, err)
+	image := encodeTestImage(t, "image/png")
+	repo := newServedSketch()
+	repo.sketches["s1"].ImageURL = base64.StdEncoding.EncodeToString(image)
+	router := newServeRouterWithBlobs(repo, blobs, 7)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/sketches/s1/thumbnail", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+
+	// The thumbnail is kept for the next request
+	stored, err := blobs.Get(context.Background(), thumbnailKey(image))
+	require.NoError(t, err)
+	assert.Equal(t, w.Body.Bytes(), stored)
+
+	w = httptest.NewRecorder()
+	newServeRouterWithBlobs(repo, blobs, 8).ServeHTTP(w, httptest.NewRequest("GET", "/sketches/s1/thumbnail", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func postDrawing(t *testing.T, router *gin.Engine, drawing any) *httptest.ResponseRecorder {
+	body, err := json.Marshal(drawing)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/sketchpad", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSaveDrawingHandler(t *testing.T) {
+	repo := newMemoryRepository()
+	router := newServeRouter(repo, 7)
+
+	w := postDrawing(t, router, VectorSketchRequest{Name: " Login ", VectorSketch: *loginDrawing()})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		SketchID string `json:"sketch_id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	// The shapes are stored with the PNG rasterised from them
+	saved := repo.sketches[resp.SketchID]
+	require.NotNil(t, saved)
+	assert.Equal(t, "Login", saved.Name)
+	assert.Equal(t, "7", saved.OwnerID)
+	assert.Equal(t, StoredMediaType, saved.MediaType)
+	require.NotNil(t, saved.Vector)
+	assert.Len(t, saved.Vector.Shapes, 5)
+	image, err := base64.StdEncoding.DecodeString(saved.ImageURL)
+	require.NoError(t, err)
+	assert.Equal(t, StoredMediaType, detectImageType(image))
+	assert.Contains(t, saved.LayoutHints(), `"Email"`)
+
+	// The sketchpad opens the drawing again in the format it saves
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/sketches/"+saved.ID+"/vector", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var reopened VectorSketchRequest
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &reopened))
+	assert.Equal(t, "Login", reopened.Name)
+	assert.Equal(t, *saved.Vector, reopened.VectorSketch)
+
+	w = httptest.NewRecorder()
+	newServeRouter(repo, 8).ServeHTTP(w, httptest.NewRequest("GET", "/sketches/"+saved.ID+"/vector", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSaveDrawingHandler_DefaultName(t *testing.T) {
+	repo := newMemoryRepository()
+	w := postDrawing(t, newServeRouter(repo, 7), loginDrawing())
+	require.Equal(t, http.StatusOK, w.Code)
+
+	for _, saved := range repo.sketches {
+		assert.Equal(t, DefaultDrawingName, saved.Name)
+	}
+}
+
+func TestSaveDrawingHandler_Rejected(t *testing.T) {
+	router := newServeRouter(newMemoryRepository(), 7)
+
+	invalid := loginDrawing()
+	invalid.Shapes[0].Type = "circle"
+	w := postDrawing(t, router, invalid)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "unknown shape type")
+
+	huge := loginDrawing()
+	huge.Width, huge.Height = 100_000, 100_000
+	w = postDrawing(t, router, huge)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	w = postDrawing(t, router, "not a drawing")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestVectorHandler_UploadedImage(t *testing.T) {
+	w := httptest.NewRecorder()
+	newServeRouter(newServedSketch(), 7).ServeHTTP(w, httptest.NewRequest("GET", "/sketches/s1/vector", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -18,6 +18,17 @@ func NewSketchStore() *SketchStore {
 	return &SketchStore{cache: cache}
 }
 
+// NewBoundedSketchStore creates a SketchStore that keeps at most capacity sketches,
+// evicting the least recently used. Reading a sketch does not extend its TTL.
+func NewBoundedSketchStore(capacity uint64) *SketchStore {
+	cache := ttlcache.New[string, *Sketch](
+		ttlcache.WithDisableTouchOnHit[string, *Sketch](),
+		ttlcache.WithCapacity[string, *Sketch](capacity),
+	)
+	go cache.Start()
+	return &SketchStore{cache: cache}
+}
+
 // NewSketchStoreWithTTL creates a new SketchStore with TTL configuration.
 func NewSketchStoreWithTTL(ttl time.Duration, cleanupInterval time.Duration) *SketchStore {
 	cache := ttlcache.New[string, *Sketch](
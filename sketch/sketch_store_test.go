@@ -88,3 +88,23 @@ func TestTTLExpiration(t *testing.T) {
 	t.Log("After sleep: found =", found)
 	assert.False(t, found, "Sketch should expire after TTL")
 }
+
+func TestBoundedSketchStore_EvictsAndDoesNotTouch(t *testing.T) {
+	store := NewBoundedSketchStore(2)
+	defer store.StopCleanup()
+
+	assert.NoError(t, store.SetSketch("s1", createDummySketch("s1"), time.Hour))
+	assert.NoError(t, store.SetSketch("s2", createDummySketch("s2"), time.Hour))
+	assert.NoError(t, store.SetSketch("s3", createDummySketch("s3"), time.Hour))
+	assert.Equal(t, 2, store.Count())
+	_, found, _ := store.GetSketch("s1")
+	assert.False(t, found, "the oldest sketch is evicted")
+
+	assert.NoError(t, store.SetSketch("s4", createDummySketch("s4"), 50*time.Millisecond))
+	for i := 0; i < 3; i++ {
+		time.Sleep(25 * time.Millisecond)
+		store.GetSketch("s4")
+	}
+	_, found, _ = store.GetSketch("s4")
+	assert.False(t, found, "reads do not extend the TTL")
+}
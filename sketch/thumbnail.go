@@ -0,0 +1,48 @@
+package sketch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"image/png"
+
+	"golang.org/x/image/draw"
+)
+
+// ThumbnailSize is the longest side of a sketch thumbnail, in pixels.
+const ThumbnailSize = 320
+
+// thumbnailKey names the thumbnail of an image in blob storage. It depends on the
+// image content and the size, so a thumbnail is never stale.
+func thumbnailKey(image []byte) string {
+	return fmt.Sprintf("thumbnails/%x-%d.png", sha256.Sum256(image), ThumbnailSize)
+}
+
+// makeThumbnail scales an image down to fit in a square of size pixels and encodes
+// it as PNG. Images that already fit are only re-encoded.
+func makeThumbnail(data []byte, size int) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode sketch: %w", err)
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(1, height*size/width)
+		} else {
+			width, height = max(1, width*size/height), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return buf.Bytes(), nil
+}
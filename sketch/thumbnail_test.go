@@ -0,0 +1,43 @@
+package sketch
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))))
+	return buf.Bytes()
+}
+
+func TestMakeThumbnail(t *testing.T) {
+	tests := []struct {
+		name                  string
+		width, height         int
+		wantWidth, wantHeight int
+	}{
+		{"landscape", 1600, 900, 320, 180},
+		{"portrait", 600, 1200, 160, 320},
+		{"already small", 200, 100, 200, 100},
+		{"thin line", 4000, 2, 320, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			thumbnail, err := makeThumbnail(encodePNG(t, tt.width, tt.height), ThumbnailSize)
+			require.NoError(t, err)
+
+			config, err := png.DecodeConfig(bytes.NewReader(thumbnail))
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantWidth, config.Width)
+			assert.Equal(t, tt.wantHeight, config.Height)
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package sketch
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// VectorFormatVersion is the version of the vector sketch format the server reads.
+const VectorFormatVersion = 1
+
+// Caps on a vector sketch, on top of the UploadLimits of its canvas. The canvas is
+// capped to the sizes the sketchpad draws on, and the pixels rasterised for all the
+// shapes together to MaxRasterizedPixels, so a small JSON body cannot make the
+// server rasterise gigapixels.
+const (
+	MaxVectorCanvasSize = 2048
+	MaxRasterizedPixels = 50_000_000
+	MaxVectorShapes     = 1000
+	MaxVectorPoints     = 50_000
+	MaxTextLength       = 200
+	MaxStrokeWidth      = 50
+	MaxFontSize         = 200
+	DefaultStrokeWidth  = 2
+	DefaultFontSize     = 16
+	DefaultShapeColor   = "#000000"
+)
+
+// maxLayoutHintLines caps the layout hints added to the prompt
+const maxLayoutHintLines = 200
+
+// ShapeType is the kind of a shape drawn on the sketchpad.
+type ShapeType string
+
+const (
+	// ShapeStroke is a freehand line through Points
+	ShapeStroke ShapeType = "stroke"
+	// ShapeRect is the outline of the rectangle at X, Y of Width and Height
+	ShapeRect ShapeType = "rect"
+	// ShapeText is a label whose top-left corner is at X, Y
+	ShapeText ShapeType = "text"
+	// ShapeArrow points from the first to the second of its two Points
+	ShapeArrow ShapeType = "arrow"
+)
+
+// Point is a position on the canvas, in pixels from its top-left corner.
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Shape is one shape of a vector sketch. Which fields are used depends on Type.
+type Shape struct {
+	Type   ShapeType `json:"type"`
+	Points []Point   `json:"points,omitempty"`
+	X      float64   `json:"x,omitempty"`
+	Y      float64   `json:"y,omitempty"`
+	Width  float64   `json:"width,omitempty"`
+	Height float64   `json:"height,omitempty"`
+	Text   string    `json:"text,omitempty"`
+	// Color is a #rrggbb color, DefaultShapeColor when empty
+	Color string `json:"color,omitempty"`
+	// StrokeWidth is in pixels, DefaultStrokeWidth when zero
+	StrokeWidth float64 `json:"stroke_width,omitempty"`
+	// FontSize is in pixels, DefaultFontSize when zero
+	FontSize float64 `json:"font_size,omitempty"`
+}
+
+// VectorSketch is a sketch drawn on the sketchpad, as the list of shapes on a canvas
+// of Width by Height pixels. It is the canonical form of the sketch; its PNG
+// rasterisation is what the model sees.
+type VectorSketch struct {
+	Version int     `json:"version"`
+	Width   float64 `json:"width"`
+	Height  float64 `json:"height"`
+	Shapes  []Shape `json:"shapes"`
+}
+
+// InvalidVectorError is returned for vector sketches that do not follow the format.
+type InvalidVectorError struct {
+	message string
+}
+
+func (e *InvalidVectorError) Error() string {
+	return e.message
+}
+
+func invalidShape(i int, format string, args ...any) *InvalidVectorError {
+	return &InvalidVectorError{message: fmt.Sprintf("shape %d: ", i) + fmt.Sprintf(format, args...)}
+}
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Validate checks the sketch against the format and limits, and fills in the default
+// color, stroke width and font size of its shapes. Canvases over limits and drawings
+// too costly to rasterise return an UploadTooLargeError, anything else an
+// InvalidVectorError.
+func (v *VectorSketch) Validate(limits UploadLimits) error {
+	if v.Version != VectorFormatVersion {
+		return &InvalidVectorError{message: fmt.Sprintf("unsupported vector sketch version %d; the server reads version %d", v.Version, VectorFormatVersion)}
+	}
+	if v.Width < 1 || v.Height < 1 {
+		return &InvalidVectorError{message: "the canvas must be at least 1 pixel wide and tall"}
+	}
+	canvasLimits := limits
+	canvasLimits.MaxDimension = min(limits.MaxDimension, MaxVectorCanvasSize)
+	if err := canvasLimits.checkDimensions(int(math.Ceil(v.Width)), int(math.Ceil(v.Height))); err != nil {
+		return err
+	}
+	if len(v.Shapes) == 0 {
+		return &InvalidVectorError{message: "the sketch is empty"}
+	}
+	if len(v.Shapes) > MaxVectorShapes {
+		return &InvalidVectorError{message: fmt.Sprintf("a sketch can have at most %d shapes", MaxVectorShapes)}
+	}
+
+	points, pixels := 0, 0
+	for i := range v.Shapes {
+		shape := &v.Shapes[i]
+		points += len(shape.Points)
+		if points > MaxVectorPoints {
+			return &InvalidVectorError{message: fmt.Sprintf("a sketch can have at most %d points", MaxVectorPoints)}
+		}
+
+		switch shape.Type {
+		case ShapeStroke:
+			if len(shape.Points) == 0 {
+				return invalidShape(i, "a stroke needs at least one point")
+			}
+		case ShapeArrow:
+			if len(shape.Points) != 2 {
+				return invalidShape(i, "an arrow needs exactly two points")
+			}
+		case ShapeRect:
+			if shape.Width <= 0 || shape.Height <= 0 {
+				return invalidShape(i, "a rectangle needs a positive width and height")
+			}
+			if !v.contains(Point{shape.X, shape.Y}) || !v.contains(Point{shape.X + shape.Width, shape.Y + shape.Height}) {
+				return invalidShape(i, "the rectangle is outside the canvas")
+			}
+		case ShapeText:
+			if strings.TrimSpace(shape.Text) == "" {
+				return invalidShape(i, "a text label cannot be empty")
+			}
+			if len([]rune(shape.Text)) > MaxTextLength {
+				return invalidShape(i, "a text label can have at most %d characters", MaxTextLength)
+			}
+			if !v.contains(Point{shape.X, shape.Y}) {
+				return invalidShape(i, "the text label is outside the canvas")
+			}
+		default:
+			return invalidShape(i, "unknown shape type %q", shape.Type)
+		}
+		for _, p := range shape.Points {
+			if !v.contains(p) {
+				return invalidShape(i, "the point (%.0f, %.0f) is outside the canvas", p.X, p.Y)
+			}
+		}
+
+		if shape.Color == "" {
+			shape.Color = DefaultShapeColor
+		} else if !colorPattern.MatchString(shape.Color) {
+			return invalidShape(i, "colors are written #rrggbb, got %q", shape.Color)
+		}
+		if shape.StrokeWidth == 0 {
+			shape.StrokeWidth = DefaultStrokeWidth
+		} else if shape.StrokeWidth < 0 || shape.StrokeWidth > MaxStrokeWidth {
+			return invalidShape(i, "the stroke width must be between 0 and %d pixels", MaxStrokeWidth)
+		}
+		if shape.Type == ShapeText {
+			if shape.FontSize == 0 {
+				shape.FontSize = DefaultFontSize
+			} else if shape.FontSize < 0 || shape.FontSize > MaxFontSize {
+				return invalidShape(i, "the font size must be between 0 and %d pixels", MaxFontSize)
+			}
+		}
+
+		pixels += rasterArea(*shape)
+		if pixels > MaxRasterizedPixels {
+			return &UploadTooLargeError{message: "The drawing has too many large shapes to be drawn. Remove some shapes, or draw them smaller, and try again."}
+		}
+	}
+	return nil
+}
+
+func (v *VectorSketch) contains(p Point) bool {
+	return p.X >= 0 && p.Y >= 0 && p.X <= v.Width && p.Y <= v.Height
+}
+
+// rgba returns the color of a validated shape.
+func (s *Shape) rgba() color.RGBA {
+	var r, g, b uint8
+	fmt.Sscanf(s.Color, "#%02x%02x%02x", &r, &g, &b)
+	return color.RGBA{R: r, G: g, B: b, A: 0xff}
+}
+
+// LayoutHints describes the rectangles, text labels and arrows of the sketch for the
+// model, with positions as fractions of the canvas size like layout boxes. Labels and
+// arrow ends are placed in the smallest rectangle around them. Freehand strokes are
+// left to the image. It returns an empty string when there is nothing to describe.
+func (v *VectorSketch) LayoutHints() string {
+	var rects, texts, arrows []Shape
+	for _, shape := range v.Shapes {
+		switch shape.Type {
+		case ShapeRect:
+			rects = append(rects, shape)
+		case ShapeText:
+			texts = append(texts, shape)
+		case ShapeArrow:
+			arrows = append(arrows, shape)
+		}
+	}
+	if len(rects)+len(texts)+len(arrows) == 0 {
+		return ""
+	}
+
+	// Rectangles and labels are listed in reading order
+	readingOrder := func(shapes []Shape) {
+		sort.SliceStable(shapes, func(i, j int) bool {
+			if shapes[i].Y != shapes[j].Y {
+				return shapes[i].Y < shapes[j].Y
+			}
+			return shapes[i].X < shapes[j].X
+		})
+	}
+	readingOrder(rects)
+	readingOrder(texts)
+
+	// within names the smallest rectangle around p other than rects[except], or
+	// returns an empty string
+	within := func(p Point, except int) string {
+		best, bestArea := -1, math.Inf(1)
+		for i, r := range rects {
+			if i != except && p.X >= r.X && p.X <= r.X+r.Width && p.Y >= r.Y && p.Y <= r.Y+r.Height && r.Width*r.Height < bestArea {
+				best, bestArea = i, r.Width*r.Height
+			}
+		}
+		if best < 0 {
+			return ""
+		}
+		return fmt.Sprintf("R%d", best+1)
+	}
+
+	var lines []string
+	if len(rects) > 0 {
+		lines = append(lines, "Rectangles:")
+		for i, r := range rects {
+			line := fmt.Sprintf("- R%d at x=%.2f, y=%.2f with width %.2f and height %.2f", i+1,
+				r.X/v.Width, r.Y/v.Height, r.Width/v.Width, r.Height/v.Height)
+			if parent := within(Point{r.X + r.Width/2, r.Y + r.Height/2}, i); parent != "" {
+				line += ", inside " + parent
+			}
+			lines = append(lines, line)
+		}
+	}
+	if len(texts) > 0 {
+		lines = append(lines, "Text labels:")
+		for _, t := range texts {
+			line := fmt.Sprintf("- %q at x=%.2f, y=%.2f", strings.TrimSpace(t.Text), t.X/v.Width, t.Y/v.Height)
+			if parent := within(Point{t.X, t.Y}, -1); parent != "" {
+				line += ", inside " + parent
+			}
+			lines = append(lines, line)
+		}
+	}
+	if len(arrows) > 0 {
+		lines = append(lines, "Arrows:")
+		for _, a := range arrows {
+			from, to := a.Points[0], a.Points[1]
+			line := fmt.Sprintf("- from x=%.2f, y=%.2f to x=%.2f, y=%.2f", from.X/v.Width, from.Y/v.Height, to.X/v.Width, to.Y/v.Height)
+			if fromRect, toRect := within(from, -1), within(to, -1); fromRect != "" && toRect != "" && fromRect != toRect {
+				line += fmt.Sprintf(", from %s to %s", fromRect, toRect)
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	if len(lines) > maxLayoutHintLines {
+		lines = append(lines[:maxLayoutHintLines], fmt.Sprintf("(%d more lines left out)", len(lines)-maxLayoutHintLines))
+	}
+	return "The sketch was drawn on a sketchpad. Use these shapes from it as layout hints; " +
+		"positions and sizes are fractions of the sketch width and height.\n" + strings.Join(lines, "\n")
+}
@@ -0,0 +1,165 @@
+package sketch
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loginDrawing is a login form drawn on the sketchpad: a card with a label, a button
+// and an arrow from the card to the button.
+func loginDrawing() *VectorSketch {
+	return &VectorSketch{
+		Version: VectorFormatVersion,
+		Width:   400,
+		Height:  200,
+		Shapes: []Shape{
+			{Type: ShapeRect, X: 20, Y: 20, Width: 360, Height: 160},
+			{Type: ShapeRect, X: 240, Y: 120, Width: 120, Height: 40, Color: "#2255ff", StrokeWidth: 4},
+			{Type: ShapeText, X: 40, Y: 40, Text: "Email", FontSize: 20},
+			{Type: ShapeArrow, Points: []Point{{100, 100}, {250, 140}}},
+			{Type: ShapeStroke, Points: []Point{{40, 80}, {200, 80}}},
+		},
+	}
+}
+
+func TestVectorSketchValidate_FillsDefaults(t *testing.T) {
+	drawing := loginDrawing()
+	require.NoError(t, drawing.Validate(DefaultUploadLimits))
+
+	assert.Equal(t, DefaultShapeColor, drawing.Shapes[0].Color)
+	assert.Equal(t, float64(DefaultStrokeWidth), drawing.Shapes[0].StrokeWidth)
+	assert.Equal(t, float64(4), drawing.Shapes[1].StrokeWidth)
+	assert.Equal(t, float64(20), drawing.Shapes[2].FontSize)
+}
+
+func TestVectorSketchValidate_RejectsInvalidDrawings(t *testing.T) {
+	tests := map[string]struct {
+		edit    func(*VectorSketch)
+		message string
+	}{
+		"version":        {func(v *VectorSketch) { v.Version = 2 }, "version 2"},
+		"empty":          {func(v *VectorSketch) { v.Shapes = nil }, "empty"},
+		"unknown shape":  {func(v *VectorSketch) { v.Shapes[0].Type = "circle" }, `shape 0: unknown shape type "circle"`},
+		"arrow points":   {func(v *VectorSketch) { v.Shapes[3].Points = v.Shapes[3].Points[:1] }, "shape 3: an arrow"},
+		"point outside":  {func(v *VectorSketch) { v.Shapes[4].Points[1].X = 401 }, "shape 4: the point (401, 80) is outside"},
+		"rect outside":   {func(v *VectorSketch) { v.Shapes[1].Width = 200 }, "shape 1: the rectangle is outside"},
+		"empty text":     {func(v *VectorSketch) { v.Shapes[2].Text = "  " }, "shape 2: a text label cannot be empty"},
+		"color":          {func(v *VectorSketch) { v.Shapes[1].Color = "blue" }, `shape 1: colors are written #rrggbb, got "blue"`},
+		"stroke width":   {func(v *VectorSketch) { v.Shapes[4].StrokeWidth = 51 }, "shape 4: the stroke width"},
+		"too many shape": {func(v *VectorSketch) { v.Shapes = make([]Shape, MaxVectorShapes+1) }, "at most 1000 shapes"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			drawing := loginDrawing()
+			tt.edit(drawing)
+
+			err := drawing.Validate(DefaultUploadLimits)
+			var invalid *InvalidVectorError
+			require.ErrorAs(t, err, &invalid)
+			assert.Contains(t, err.Error(), tt.message)
+		})
+	}
+}
+
+func TestVectorSketchValidate_RejectsOversizedCanvas(t *testing.T) {
+	drawing := loginDrawing()
+	drawing.Width = float64(DefaultUploadLimits.MaxDimension + 1)
+
+	var oversized *UploadTooLargeError
+	assert.ErrorAs(t, drawing.Validate(DefaultUploadLimits), &oversized)
+}
+
+func TestVectorSketchValidate_CapsCanvasToSketchpadSize(t *testing.T) {
+	drawing := loginDrawing()
+	drawing.Width = MaxVectorCanvasSize + 1
+
+	var oversized *UploadTooLargeError
+	assert.ErrorAs(t, drawing.Validate(DefaultUploadLimits), &oversized)
+}
+
+func TestVectorSketchValidate_RejectsManyLargeShapes(t *testing.T) {
+	// Each diagonal stroke spans the whole canvas, so rasterising all of them would
+	// go through far more pixels than the drawing has
+	drawing := &VectorSketch{Version: VectorFormatVersion, Width: MaxVectorCanvasSize, Height: MaxVectorCanvasSize}
+	for range 20 {
+		drawing.Shapes = append(drawing.Shapes, Shape{
+			Type:   ShapeStroke,
+			Points: []Point{{0, 0}, {MaxVectorCanvasSize, MaxVectorCanvasSize}},
+		})
+	}
+
+	var oversized *UploadTooLargeError
+	require.ErrorAs(t, drawing.Validate(DefaultUploadLimits), &oversized)
+	assert.Contains(t, oversized.Error(), "too many large shapes")
+
+	// Rectangle outlines only cost the pixels along their sides
+	drawing.Shapes = nil
+	for range MaxVectorShapes {
+		drawing.Shapes = append(drawing.Shapes, Shape{Type: ShapeRect, Width: MaxVectorCanvasSize, Height: MaxVectorCanvasSize})
+	}
+	assert.NoError(t, drawing.Validate(DefaultUploadLimits))
+}
+
+func TestVectorSketchLayoutHints(t *testing.T) {
+	drawing := loginDrawing()
+	require.NoError(t, drawing.Validate(DefaultUploadLimits))
+
+	hints := drawing.LayoutHints()
+	assert.Contains(t, hints, "- R1 at x=0.05, y=0.10 with width 0.90 and height 0.80\n")
+	assert.Contains(t, hints, "- R2 at x=0.60, y=0.60 with width 0.30 and height 0.20, inside R1\n")
+	assert.Contains(t, hints, `- "Email" at x=0.10, y=0.20, inside R1`)
+	assert.Contains(t, hints, "- from x=0.25, y=0.50 to x=0.62, y=0.70, from R1 to R2")
+	// Freehand strokes are left to the image
+	assert.Equal(t, 2, strings.Count(hints, "\n- R"))
+	assert.NotContains(t, hints, "stroke")
+
+	strokes := &VectorSketch{Version: VectorFormatVersion, Width: 10, Height: 10, Shapes: []Shape{{Type: ShapeStroke, Points: []Point{{1, 1}}}}}
+	assert.Empty(t, strokes.LayoutHints())
+	assert.Empty(t, (&Sketch{}).LayoutHints())
+}
+
+func TestRasterize(t *testing.T) {
+	drawing := loginDrawing()
+	require.NoError(t, drawing.Validate(DefaultUploadLimits))
+
+	data, err := Rasterize(context.Background(), drawing)
+	require.NoError(t, err)
+	assert.Equal(t, StoredMediaType, detectImageType(data))
+
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 400, 200), img.Bounds())
+
+	isDark := func(x, y int) bool {
+		r, g, b, _ := img.At(x, y).RGBA()
+		return r < 0x8000 && g < 0x8000 && b < 0x8000
+	}
+	// The outline of the card is drawn and its inside is left white
+	assert.True(t, isDark(200, 20))
+	assert.True(t, isDark(20, 100))
+	assert.Equal(t, color.RGBA{0xff, 0xff, 0xff, 0xff}, color.RGBAModel.Convert(img.At(300, 50)))
+	// The button is blue
+	assert.Equal(t, color.RGBA{0x22, 0x55, 0xff, 0xff}, color.RGBAModel.Convert(img.At(300, 120)))
+	// The stroke and the arrow shaft
+	assert.True(t, isDark(120, 80))
+	assert.True(t, isDark(175, 120))
+
+	// The label is drawn below its top-left corner
+	inked := 0
+	for y := 40; y < 62; y++ {
+		for x := 40; x < 100; x++ {
+			if isDark(x, y) {
+				inked++
+			}
+		}
+	}
+	assert.Greater(t, inked, 20)
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FileSystemStore keeps blobs as files below a root directory. Its signed URLs point
+// at ServeSigned, which checks an HMAC of the key and expiry time.
+type FileSystemStore struct {
+	root   string
+	secret []byte
+	now    func() time.Time
+}
+
+// NewFileSystemStore creates the root directory if needed. The secret signs download
+// URLs and must be at least 16 bytes long.
+func NewFileSystemStore(root string, secret []byte) (*FileSystemStore, error) {
+	if len(secret) < 16 {
+		return nil, errors.New("the blob signing key must be at least 16 characters long")
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	return &FileSystemStore{root: root, secret: secret, now: time.Now}, nil
+}
+
+func (s *FileSystemStore) path(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+// Put writes the blob to a temporary file and renames it into place, so readers never
+// see a partly written blob.
+func (s *FileSystemStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create blob file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to store blob: %w", err)
+	}
+	return nil
+}
+
+func (s *FileSystemStore) Get(ctx context.Context, key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob: %w", err)
+	}
+	return data, nil
+}
+
+func (s *FileSystemStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+	return nil
+}
+
+func (s *FileSystemStore) signature(key string, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s\n%d", key, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignedURL returns a /blobs/ URL on this application for the blob
+func (s *FileSystemStore) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	if err := validateExpiry(expiry); err != nil {
+		return "", err
+	}
+	expires := s.now().Add(expiry).Unix()
+	query := url.Values{
+		"expires":   {strconv.FormatInt(expires, 10)},
+		"signature": {s.signature(key, expires)},
+	}
+	return "/blobs/" + key + "?" + query.Encode(), nil
+}
+
+// ServeSigned serves GET /blobs/*key for URLs made by SignedURL. Unsigned, tampered
+// and expired URLs are all answered with 403 Forbidden.
+func (s *FileSystemStore) ServeSigned(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || validateKey(key) != nil ||
+		!hmac.Equal([]byte(c.Query("signature")), []byte(s.signature(key, expires))) ||
+		s.now().Unix() > expires {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+
+	data, err := s.Get(c.Request.Context(), key)
+	if errors.Is(err, ErrBlobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	// Blobs never change, so the response may be cached for as long as the link is valid
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", expires-s.now().Unix()))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, contentTypeOf(key), data)
+}
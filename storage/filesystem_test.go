@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFileSystemStore(t *testing.T) *FileSystemStore {
+	t.Helper()
+	store, err := NewFileSystemStore(t.TempDir(), []byte("0123456789abcdef"))
+	require.NoError(t, err)
+	return store
+}
+
+func TestFileSystemStorePutGetDelete(t *testing.T) {
+	store := newFileSystemStore(t)
+	ctx := context.Background()
+	key := ContentKey("sketches", []byte("image"), "image/png")
+
+	require.NoError(t, store.Put(ctx, key, []byte("image"), "image/png"))
+	data, err := store.Get(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, "image", string(data))
+
+	require.NoError(t, store.Delete(ctx, key))
+	_, err = store.Get(ctx, key)
+	assert.ErrorIs(t, err, ErrBlobNotFound)
+	assert.NoError(t, store.Delete(ctx, key), "deleting a missing blob is not an error")
+}
+
+func TestFileSystemStoreRejectsUnsafeKeys(t *testing.T) {
+	store := newFileSystemStore(t)
+
+	for _, key := range []string{"../outside", "/absolute", "a//b", "a/./b", "Upper", ""} {
+		assert.Error(t, store.Put(context.Background(), key, []byte("x"), ""), key)
+	}
+}
+
+func TestContentKey(t *testing.T) {
+	key := ContentKey("avatars", []byte("a"), "image/png")
+	assert.Equal(t, "avatars/ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb.png", key)
+	assert.Equal(t, key, ContentKey("avatars", []byte("a"), "image/png"), "the same content has the same key")
+	assert.Equal(t, "image/png", contentTypeOf(key))
+}
+
+func TestFileSystemStoreServeSigned(t *testing.T) {
+	store := newFileSystemStore(t)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+	key := ContentKey("sketches", []byte("image"), "image/png")
+	require.NoError(t, store.Put(ctx, key, []byte("image"), "image/png"))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/blobs/*key", store.ServeSigned)
+
+	signed, err := store.SignedURL(ctx, key, time.Minute)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", signed, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image", w.Body.String())
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+
+	// A link for one blob does not open another
+	other := ContentKey("sketches", []byte("other"), "image/png")
+	require.NoError(t, store.Put(ctx, other, []byte("other"), "image/png"))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/blobs/"+other+signed[len("/blobs/"+key):], nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/blobs/"+key, nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	now = now.Add(2 * time.Minute)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", signed, nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
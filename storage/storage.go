@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrBlobNotFound is returned when no blob is stored under the requested key.
+var ErrBlobNotFound = errors.New("blob not found")
+
+// MaxURLExpiry is the longest a signed URL may stay valid, the limit S3 puts on
+// presigned URLs.
+const MaxURLExpiry = 7 * 24 * time.Hour
+
+// BlobStore stores immutable binary objects, such as uploaded sketches and avatars,
+// under slash-separated keys.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get returns ErrBlobNotFound when there is no blob with key
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL that downloads the blob without a session until expiry
+	// has passed.
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+var keyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*(/[a-z0-9][a-z0-9._-]*)*$`)
+
+// validateKey rejects keys that could escape the storage root or need escaping in URLs.
+func validateKey(key string) error {
+	if !keyPattern.MatchString(key) || path.Clean(key) != key {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
+
+func validateExpiry(expiry time.Duration) error {
+	if expiry <= 0 || expiry > MaxURLExpiry {
+		return fmt.Errorf("signed URL expiry must be between 1s and %s, got %s", MaxURLExpiry, expiry)
+	}
+	return nil
+}
+
+// extensions maps the media types stored as blobs to the extension of their keys.
+var extensions = map[string]string{
+	"image/png":     ".png",
+	"image/jpeg":    ".jpg",
+	"image/bmp":     ".bmp",
+	"image/gif":     ".gif",
+	"image/webp":    ".webp",
+	"image/svg+xml": ".svg",
+}
+
+// ContentKey returns the key of data under prefix, named by its SHA-256 hash. Storing
+// the same content twice yields the same key, so blobs are deduplicated and never
+// change once written.
+func ContentKey(prefix string, data []byte, contentType string) string {
+	sum := sha256.Sum256(data)
+	return prefix + "/" + hex.EncodeToString(sum[:]) + extensions[contentType]
+}
+
+// contentTypeOf returns the media type of a blob from the extension of its key.
+func contentTypeOf(key string) string {
+	ext := path.Ext(key)
+	for contentType, e := range extensions {
+		if e == ext {
+			return contentType
+		}
+	}
+	return "application/octet-stream"
+}
+
+// SetupStorage creates the blob store selected by the BLOB_STORAGE env variable:
+//   - "filesystem" (default): files under BLOB_DIR (./data/blobs), downloaded through
+//     signed /blobs/ URLs served by this application.
+//   - "s3": a bucket on any S3-compatible service, configured with S3_ENDPOINT,
+//     S3_REGION, S3_BUCKET, S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY and
+//     S3_USE_PATH_STYLE (true for MinIO).
+//
+// Filesystem URLs are signed with BLOB_SIGNING_KEY, or SESSION_SECRET_KEY if unset.
+func SetupStorage(router *gin.Engine) (BlobStore, error) {
+	switch backend := os.Getenv("BLOB_STORAGE"); backend {
+	case "", "filesystem":
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = "./data/blobs"
+		}
+		secret := os.Getenv("BLOB_SIGNING_KEY")
+		if secret == "" {
+			secret = os.Getenv("SESSION_SECRET_KEY")
+		}
+		store, err := NewFileSystemStore(dir, []byte(secret))
+		if err != nil {
+			return nil, err
+		}
+		router.GET("/blobs/*key", store.ServeSigned)
+		slog.Info("Blob storage on the filesystem", "dir", dir)
+		return store, nil
+	case "s3":
+		store, err := NewS3Store(S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			UsePathStyle:    os.Getenv("S3_USE_PATH_STYLE") == "true",
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("Blob storage on S3", "endpoint", os.Getenv("S3_ENDPOINT"), "bucket", os.Getenv("S3_BUCKET"))
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown BLOB_STORAGE %q", backend)
+	}
+}
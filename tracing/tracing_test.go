@@ -0,0 +1,44 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestLogHandlerAddsTraceIDs(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	ctx, span := provider.Tracer("test").Start(context.Background(), "op")
+	defer span.End()
+
+	var buf bytes.Buffer
+	logger := slog.New(NewLogHandler(slog.NewTextHandler(&buf, nil)))
+
+	logger.InfoContext(ctx, "with span")
+	assert.Contains(t, buf.String(), "trace_id="+span.SpanContext().TraceID().String())
+	assert.Contains(t, buf.String(), "span_id="+span.SpanContext().SpanID().String())
+
+	buf.Reset()
+	logger.Info("without span")
+	assert.NotContains(t, buf.String(), "trace_id")
+}
+
+func TestEndRecordsError(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	_, span := provider.Tracer("test").Start(context.Background(), "failing")
+	End(span, errors.New("query failed"))
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, "query failed", spans[0].Status().Description)
+}
@@ -1,8 +1,11 @@
 package uicomponents
 
 import (
+	"context"
 	"database/sql"
-	"sketch-to-ui-final-proj/ai"
+	"sketch-to-ui-final-proj/accounts"
+	"sketch-to-ui-final-proj/experiments"
+	"sketch-to-ui-final-proj/layout"
 	"sketch-to-ui-final-proj/sketch"
 	"time"
 
@@ -19,6 +22,48 @@ type UIComponent struct {
 	UpdatedAt  time.Time `db:"updated_at"`
 	ArchivedAt time.Time `db:"archived_at"`
 	UserID     int       `db:"user_id"`
+
+	// Generation provenance. SketchID is empty for components generated from a
+	// description, and GenerationPrompt when the default prompt was used.
+	ModelID          string    `db:"model_id"`
+	PromptVersion    string    `db:"prompt_version"`
+	SketchID         string    `db:"sketch_id"`
+	GenerationPrompt string    `db:"generation_prompt"`
+	GeneratedAt      time.Time `db:"generated_at"`
+
+	// Layout is the layout tree the code was rendered from, nil when the model wrote the code
+	Layout *layout.Node `db:"layout"`
+
+	// Hierarchy: ParentID is 0 for top-level components. The code of a page or
+	// section is composed from Template and the code of its children.
+	ParentID   int           `db:"parent_id"`
+	Position   int           `db:"position"`
+	Template   string        `db:"template"`
+	Children   []UIComponent `db:"-"`
+	ChildCount int           `db:"-"`
+
+	// FeedbackRating is the owner's rating: 1 (thumbs up), -1 (thumbs down) or 0 (none)
+	FeedbackRating int `db:"-"`
+}
+
+// ComponentRepository stores UI components, their hierarchy and their feedback.
+// UIComponentsStore implements it on Postgres.
+type ComponentRepository interface {
+	// CreateComponents creates components with their children, all of them or none
+	CreateComponents(ctx context.Context, components []UIComponent) error
+	UpdateComponent(ctx context.Context, id int, component *UIComponent) error
+	// UpdateGeneration replaces the generated code and provenance of a component
+	UpdateGeneration(ctx context.Context, component *UIComponent) error
+	ArchiveComponent(ctx context.Context, id int) error
+	GetComponentByID(ctx context.Context, id int) (*UIComponent, error)
+	GetComponentsByUserPaginated(ctx context.Context, userID int, limit int, offset int) ([]UIComponent, int, error)
+
+	// GetChildren returns the parts of a page or section in order
+	GetChildren(ctx context.Context, parentID int) ([]UIComponent, error)
+	GetComponentTree(ctx context.Context, id int) (*UIComponent, error)
+
+	SaveFeedback(ctx context.Context, feedback *ComponentFeedback) error
+	ForEachFeedback(ctx context.Context, fn func(ComponentFeedback) error) error
 }
 
 // PublicComponentWithUser holds a public component and its owner's name
@@ -36,14 +81,9 @@ type PublicComponentWithUser struct {
 	ArchivedAt time.Time
 }
 
-
-func SetupComponents(router *gin.Engine ,db *sql.DB, sketchStore *sketch.SketchStore, openRouterProvider *ai.OpenRouterProvider){
-
-
+func SetupComponents(router *gin.Engine, adminGroup *gin.RouterGroup, db *sql.DB, sketches sketch.SketchRepository, providers *accounts.Keyring, experimentManager *experiments.Manager) {
 	componentStore := NewUIComponentsStore(db)
-	componentHandler := NewUIComponentHandler(componentStore, sketchStore,  openRouterProvider)
-
-	componentHandler.RegisterRoutes(router)
-
+	componentHandler := NewUIComponentHandler(componentStore, sketches, providers, experimentManager)
 
+	componentHandler.RegisterRoutes(router, adminGroup)
 }
@@ -2,12 +2,17 @@ package uicomponents
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"sketch-to-ui-final-proj/accounts"
 	"sketch-to-ui-final-proj/ai"
 	"sketch-to-ui-final-proj/auth"
+	"sketch-to-ui-final-proj/experiments"
+	"sketch-to-ui-final-proj/layout"
 	"sketch-to-ui-final-proj/sketch"
 	"sketch-to-ui-final-proj/utils/htmx"
 
@@ -16,26 +21,31 @@ import (
 
 // UIComponentHandler handles all UI component related operations
 type UIComponentHandler struct {
-	componentStore *UIComponentsStore
-	sketchStore    *sketch.SketchStore
-	aiProvider     *ai.OpenRouterProvider
+	componentStore ComponentRepository
+	sketches       sketch.SketchRepository
+	providers      *accounts.Keyring
+	experiments    *experiments.Manager
 }
 
 // NewUIComponentHandler creates a new instance of UIComponentHandler
-func NewUIComponentHandler(componentStore *UIComponentsStore, sketchStore *sketch.SketchStore, aiProvider *ai.OpenRouterProvider) *UIComponentHandler {
+func NewUIComponentHandler(componentStore ComponentRepository, sketches sketch.SketchRepository, providers *accounts.Keyring, experimentManager *experiments.Manager) *UIComponentHandler {
 	return &UIComponentHandler{
 		componentStore: componentStore,
-		sketchStore:    sketchStore,
-		aiProvider:     aiProvider,
+		sketches:       sketches,
+		providers:      providers,
+		experiments:    experimentManager,
 	}
 }
 
-// CreateComponentRequest represents the request payload for creating a new component
+// CreateComponentRequest represents the request payload for creating a new component.
+// Without a sketch, UserPrompt describes the component and is required.
 type CreateComponentRequest struct {
-	SketchID    string `form:"sketch_id" binding:"required"`
-	UserPrompt  string `form:"user_prompt" binding:"omitempty"`
-	Title       string `form:"title" binding:"max=20,omitempty"`
-	IsPublic    bool
+	SketchID   string `form:"sketch_id" binding:"omitempty"`
+	UserPrompt string `form:"user_prompt" binding:"max=4000,omitempty"`
+	Title      string `form:"title" binding:"max=20,omitempty"`
+	IsPublic   bool
+
+	GenerationOptionsRequest
 }
 
 // UpdateComponentRequest represents the request payload for updating a component
@@ -44,6 +54,8 @@ type UpdateComponentRequest struct {
 	Type        string `form:"type,omitempty"`
 	Code        string `form:"code,omitempty"`
 	Description string `form:"description,omitempty"`
+	// AIEdited is set when the code was previewed with UpdateComponentCode
+	AIEdited bool `form:"ai_edited"`
 }
 
 type PaginationQuery struct {
@@ -51,6 +63,31 @@ type PaginationQuery struct {
 	Offset int `form:"offset"`
 }
 
+// userProvider returns the provider that generates for the user, and the charge to
+// make once the generation is saved. When there is none, e.g. because the free quota
+// is used up, it writes the error response and returns false.
+func (h *UIComponentHandler) userProvider(c *gin.Context, userID int) (ai.LLMProvider, accounts.Charge, bool) {
+	provider, charge, err := h.providers.ProviderFor(c.Request.Context(), userID)
+	if errors.Is(err, accounts.ErrFreeQuotaUsed) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "You have used today's free generations. Add your own API key in account settings to keep generating."})
+		return nil, nil, false
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to get AI provider for user", "user_id", userID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare the AI provider"})
+		return nil, nil, false
+	}
+	return provider, charge, true
+}
+
+// chargeGeneration counts a saved generation against the user's free quota. The
+// generation is kept when it cannot be counted.
+func chargeGeneration(c *gin.Context, charge accounts.Charge, userID int) {
+	if err := charge(c.Request.Context()); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to count free generation", "user_id", userID, "error", err)
+	}
+}
+
 // CreateComponent handles POST requests to create a new UI component from a sketch
 func (h *UIComponentHandler) CreateComponent(c *gin.Context) {
 	var req CreateComponentRequest
@@ -59,6 +96,12 @@ func (h *UIComponentHandler) CreateComponent(c *gin.Context) {
 		return
 	}
 
+	options, err := req.CompletionOptions()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid advanced settings", "details": err.Error()})
+		return
+	}
+
 	// Get user ID from context, set by auth middleware
 	userID, exists := auth.GetUserIDFromContext(c)
 	if !exists {
@@ -66,28 +109,56 @@ func (h *UIComponentHandler) CreateComponent(c *gin.Context) {
 		return
 	}
 
-	// Get the sketch from the sketch store
-	sketch, _, err := h.sketchStore.GetSketch(req.SketchID)
-	if err != nil || sketch == nil {
-		slog.Error("Failed to get sketch", "sketch_id", req.SketchID, "error", err)
-		c.JSON(http.StatusNotFound, gin.H{"error": "Sketch not found"})
+	// Without a sketch the component is generated from its description alone
+	var imageURI, layoutHints string
+	if req.SketchID != "" {
+		// SECURITY: Only sketches the user owns or that were shared with them can be generated from
+		sketch, err := sketch.GetAccessibleSketch(c.Request.Context(), h.sketches, req.SketchID, userID)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to get sketch", "sketch_id", req.SketchID, "error", err)
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sketch not found"})
+			return
+		}
+
+		if sketch.ImageURL == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Sketch does not have a valid image"})
+			return
+		}
+		imageURI = sketch.DataURI()
+		layoutHints = sketch.LayoutHints()
+	} else if strings.TrimSpace(req.UserPrompt) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload a sketch or describe the component to generate"})
 		return
 	}
 
-	if sketch.ImageURL == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Sketch does not have a valid image"})
+	provider, charge, ok := h.userProvider(c, userID)
+	if !ok {
 		return
 	}
 
 	// Generate UI code using the AI package
-	userPrompt := req.UserPrompt
-	if userPrompt == "" {
-		userPrompt = "Analyze the following sketch image from the image url I sent and generate the corresponding UI component code (using  HTML and CSS in a style tag above the HTML code) in JSON format."
+	assignment := h.experiments.Assign(experiments.OperationCreate, userID)
+	settings := assignment.Settings
+	settings.Options = options
+	// Generation from a description always uses the direct pipeline. A component
+	// generated without the arm's pipeline is not recorded under the arm.
+	recordAssignment := true
+	var uiGenResp ai.UIGenerationResponse
+	if imageURI == "" {
+		recordAssignment = settings.Pipeline == ai.PipelineDirect
+		uiGenResp, err = ai.GenerateUICodeFromText(c.Request.Context(), req.UserPrompt, provider, settings)
+	} else {
+		userPrompt := req.UserPrompt
+		if userPrompt == "" {
+			userPrompt = "Analyze the following sketch image from the image url I sent and generate the corresponding UI component code (using  HTML and CSS in a style tag above the HTML code) in JSON format."
+		}
+		if layoutHints != "" {
+			userPrompt += "\n\n" + layoutHints
+		}
+		uiGenResp, err = ai.GenerateUICode(c.Request.Context(), userPrompt, imageURI, provider, settings)
 	}
-
-	uiGenResp, err := ai.GenerateUICode(c.Request.Context(), userPrompt, "data:image/png;base64,"+sketch.ImageURL, h.aiProvider)
 	if err != nil {
-		slog.Error("Failed to generate UI code", "error", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to generate UI code", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate UI components"})
 		return
 	}
@@ -95,36 +166,47 @@ func (h *UIComponentHandler) CreateComponent(c *gin.Context) {
 	if len(uiGenResp.Components) == 0 {
 		failureMsg := uiGenResp.FailureResponse
 		if failureMsg == "" {
-			failureMsg = "Failed to generate UI components from the provided sketch"
+			failureMsg = "Failed to generate UI components from the provided sketch or description"
 		}
 		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": failureMsg})
 		return
 	}
 
-	// NOTE: If your componentStore supports transactions, it would be best to wrap
-	// the following loop in a transaction to ensure all components are created or none are.
-	var createdComponents []UIComponent
-	for _, dto := range uiGenResp.Components {
-		component := UIComponent{
-			UserID: userID, // Associate the component with the user
-			Title:  dto.Title,
-			Type:   dto.Type,
-			Code:   dto.Code,
-		}
+	// Markup problems are fixed, or sent back to the model, before anything is saved
+	ai.RepairComponents(c.Request.Context(), uiGenResp.Components, provider, settings)
 
+	base := UIComponent{
+		UserID:           userID, // Associate the component with the user
+		ModelID:          assignment.Settings.ModelID,
+		PromptVersion:    assignment.Settings.PromptVersion,
+		SketchID:         req.SketchID,
+		GenerationPrompt: strings.TrimSpace(req.UserPrompt),
+	}
+	components := make([]UIComponent, 0, len(uiGenResp.Components))
+	for i, dto := range uiGenResp.Components {
 		// Override title if provided in request and only one component is generated
 		if req.Title != "" && len(uiGenResp.Components) == 1 {
-			component.Title = req.Title
+			dto.Title = req.Title
 		}
+		components = append(components, componentTree(base, dto, i))
+	}
 
-		if err := h.componentStore.CreateComponent(&component); err != nil {
-			slog.Error("Failed to create component", "error", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save component"})
-			return // Exit on first error
-		}
+	// Pages and sections are saved together with their parts, all or nothing
+	if err := h.componentStore.CreateComponents(c.Request.Context(), components); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to create components", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save component"})
+		return
+	}
 
-		createdComponents = append(createdComponents, component)
+	if recordAssignment {
+		for _, component := range components {
+			if err := h.experiments.Record(c.Request.Context(), assignment, component.ID, userID); err != nil {
+				// The component exists; losing the assignment only affects the experiment report
+				slog.ErrorContext(c.Request.Context(), "Failed to record experiment assignment", "component_id", component.ID, "error", err)
+			}
+		}
 	}
+	chargeGeneration(c, charge, userID)
 
 	location := map[string]interface{}{
 		"path":   "/components/dashboard",
@@ -164,9 +246,9 @@ func (h *UIComponentHandler) UpdateComponent(c *gin.Context) {
 	}
 
 	// Get existing component
-	existingComponent, err := h.componentStore.GetComponentByID(componentID)
+	existingComponent, err := h.componentStore.GetComponentByID(c.Request.Context(), componentID)
 	if err != nil {
-		slog.Error("Failed to get component", "component_id", componentID, "error", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to get component", "component_id", componentID, "error", err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "Component not found"})
 		return
 	}
@@ -178,6 +260,7 @@ func (h *UIComponentHandler) UpdateComponent(c *gin.Context) {
 	}
 
 	// Update fields if provided in the request
+	codeChanged := false
 	if req.Title != "" {
 		existingComponent.Title = req.Title
 	}
@@ -185,16 +268,53 @@ func (h *UIComponentHandler) UpdateComponent(c *gin.Context) {
 		existingComponent.Type = req.Type
 	}
 	if req.Code != "" {
-		existingComponent.Code = req.Code
+		// The code of a page or section is composed from its template and parts, and
+		// would be composed again, dropping the edit, when one of the parts changes
+		if existingComponent.Template != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The code of a page or section is composed from its parts; edit the parts instead"})
+			return
+		}
+		// Edited code is checked like generated code. Only deterministic fixes are
+		// applied; code that still has problems is sent back to the editor.
+		code, fixes := req.Code, []string(nil)
+		if len(ai.VerifyHTML(code)) > 0 {
+			code, fixes = ai.FixHTML(code)
+		}
+		if problems := ai.VerifyHTML(code); len(problems) > 0 {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "The code has HTML problems that could not be fixed", "details": strings.Join(problems, "; ")})
+			return
+		}
+		if len(fixes) > 0 {
+			slog.InfoContext(c.Request.Context(), "Fixed edited component HTML", "component_id", componentID, "fixes", fixes)
+		}
+		if code != existingComponent.Code {
+			existingComponent.Code = code
+			existingComponent.Layout = nil // The code no longer comes from a layout tree
+			codeChanged = true
+		}
 	}
 
 	// Update in database
-	if err = h.componentStore.UpdateComponent(existingComponent.ID, existingComponent); err != nil {
-		slog.Error("Failed to update component", "component_id", componentID, "error", err)
+	if err = h.componentStore.UpdateComponent(c.Request.Context(), existingComponent.ID, existingComponent); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to update component", "component_id", componentID, "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update component"})
 		return
 	}
 
+	// The page or section containing this part shows its new code too
+	if _, err := h.recomposeAncestors(c.Request.Context(), existingComponent); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to recompose parent component", "component_id", componentID, "error", err)
+	}
+
+	// An AI edit is counted in its experiment once it is saved. Arms are assigned by
+	// user, so this is the arm that made the previews.
+	if req.AIEdited && codeChanged {
+		assignment := h.experiments.Assign(experiments.OperationUpdate, userID)
+		if err := h.experiments.Record(c.Request.Context(), assignment, componentID, userID); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to record experiment assignment", "component_id", componentID, "error", err)
+		}
+	}
+
 	location := map[string]interface{}{
 		"path":   "/components/dashboard",
 		"target": "#content",
@@ -227,9 +347,9 @@ func (h *UIComponentHandler) ArchiveComponent(c *gin.Context) {
 	}
 
 	// Get existing component to verify ownership
-	existingComponent, err := h.componentStore.GetComponentByID(componentID)
+	existingComponent, err := h.componentStore.GetComponentByID(c.Request.Context(), componentID)
 	if err != nil {
-		slog.Error("Failed to get component", "component_id", componentID, "error", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to get component", "component_id", componentID, "error", err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "Component not found"})
 		return
 	}
@@ -241,11 +361,16 @@ func (h *UIComponentHandler) ArchiveComponent(c *gin.Context) {
 	}
 
 	// Archive the component
-	if err = h.componentStore.ArchiveComponent(componentID); err != nil {
-		slog.Error("Failed to archive component", "component_id", componentID, "error", err)
+	if err = h.componentStore.ArchiveComponent(c.Request.Context(), componentID); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to archive component", "component_id", componentID, "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to archive component"})
 		return
 	}
+
+	// The page or section containing this part no longer shows it
+	if _, err := h.recomposeAncestors(c.Request.Context(), existingComponent); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to recompose parent component", "component_id", componentID, "error", err)
+	}
 	htmx.TriggerToast(c, htmx.InfoLevel, "The Component Was Deleted Successfully")
 
 	c.Status(http.StatusOK)
@@ -260,7 +385,7 @@ func (h *UIComponentHandler) RenderComponents(c *gin.Context) {
 	}
 
 	userID, exists := auth.GetUserIDFromContext(c)
-	slog.Debug("userID in RenderComponents Handler: ", "userID", userID)
+	slog.DebugContext(c.Request.Context(), "userID in RenderComponents Handler: ", "userID", userID)
 	if !exists {
 		c.HTML(http.StatusUnauthorized, "error.html", gin.H{"error": "Unauthorized access"})
 		return
@@ -271,9 +396,9 @@ func (h *UIComponentHandler) RenderComponents(c *gin.Context) {
 		pagination.Limit = 10
 	}
 
-	components, total, err := h.componentStore.GetComponentsByUserPaginated(userID, pagination.Limit, pagination.Offset)
+	components, total, err := h.componentStore.GetComponentsByUserPaginated(c.Request.Context(), userID, pagination.Limit, pagination.Offset)
 	if err != nil {
-		slog.Error("Failed to get components", "error", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to get components", "error", err)
 		c.HTML(http.StatusInternalServerError, "error.html", gin.H{"error": "Failed to load components"})
 		return
 	}
@@ -307,10 +432,10 @@ func (h *UIComponentHandler) RenderComponentsEdit(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid component ID"})
 		return
 	}
-	component, err := h.componentStore.GetComponentByID(componentID)
+	component, err := h.componentStore.GetComponentTree(c.Request.Context(), componentID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Component not found"})
-		slog.Error("Error Loading the component from the store", "error", err)
+		slog.ErrorContext(c.Request.Context(), "Error Loading the component from the store", "error", err)
 		return
 	}
 
@@ -318,20 +443,52 @@ func (h *UIComponentHandler) RenderComponentsEdit(c *gin.Context) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to access this resource"})
 		return
 	}
-	slog.Debug("Component is:", "component", component)
+	slog.DebugContext(c.Request.Context(), "Component is:", "component", component)
+
+	// A page or section is edited through its parts
+	if len(component.Children) > 0 {
+		c.HTML(http.StatusOK, "page-view.html", gin.H{
+			"Component": component,
+		})
+		return
+	}
+
+	// The sketch is shown next to the code. It is missing when it was deleted, or
+	// unshared from the user, after the component was generated.
+	var source *sketch.Sketch
+	if component.SketchID != "" {
+		// SECURITY: Only sketches the user may still access are shown
+		source, err = sketch.GetAccessibleSketch(c.Request.Context(), h.sketches, component.SketchID, userID)
+		if err != nil && !errors.Is(err, sketch.ErrSketchNotFound) {
+			slog.ErrorContext(c.Request.Context(), "Failed to get source sketch", "sketch_id", component.SketchID, "error", err)
+		}
+	}
 
 	c.HTML(http.StatusOK, "edit-view.html", gin.H{
-		"Component": component,
+		"Component":     component,
+		"SourceSketch":  source,
+		"RenderTargets": layout.Targets(),
 	})
 }
 
+// RenderComponentsCreate renders the create view. The sketch library opens it with
+// ?sketch_id= to generate from one of the user's sketches.
 func (h *UIComponentHandler) RenderComponentsCreate(c *gin.Context) {
+	data := gin.H{}
+	if sketchID := c.Query("sketch_id"); sketchID != "" {
+		userID, _ := auth.GetUserIDFromContext(c)
+		// SECURITY: Only sketches the user may access are preselected
+		if _, err := sketch.GetAccessibleSketch(c.Request.Context(), h.sketches, sketchID, userID); err == nil {
+			data["SketchID"] = sketchID
+		}
+	}
 
-	c.HTML(http.StatusOK, "create-view.html", gin.H{})
+	c.HTML(http.StatusOK, "create-view.html", data)
 }
 
-// RegisterRoutes registers all component-related routes with the Gin router
-func (h *UIComponentHandler) RegisterRoutes(router *gin.Engine) {
+// RegisterRoutes registers all component-related routes with the Gin router, and the
+// feedback export in the admin-only group
+func (h *UIComponentHandler) RegisterRoutes(router *gin.Engine, adminGroup *gin.RouterGroup) {
 	componentGroup := router.Group("/components")
 	componentGroup.Use(auth.AuthRequiredMiddleware())
 
@@ -344,13 +501,74 @@ func (h *UIComponentHandler) RegisterRoutes(router *gin.Engine) {
 	componentGroup.GET("/create", h.RenderComponentsCreate)
 	componentGroup.GET("/:id/edit", h.RenderComponentsEdit)
 	componentGroup.POST("/update-code", h.UpdateComponentCode)
+	componentGroup.POST("/:id/render", h.RenderLayout)
+	componentGroup.POST("/:id/regenerate", h.RegenerateFromSketch)
+	componentGroup.POST("/:id/sketch", h.AttachSketch)
+	componentGroup.POST("/:id/feedback", h.SubmitFeedback)
+
+	adminGroup.GET("/feedback/export", h.ExportFeedback)
 }
 
+// RenderLayoutRequest selects the render target of a layout re-render
+type RenderLayoutRequest struct {
+	Target string `json:"target" binding:"omitempty"`
+}
+
+// RenderLayout handles POST requests that re-render a component's stored layout tree
+// with the current renderers, without another model call. The code is returned to the
+// editor and only saved with the rest of the component.
+func (h *UIComponentHandler) RenderLayout(c *gin.Context) {
+	componentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid component ID"})
+		return
+	}
+
+	var req RenderLayoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload", "details": err.Error()})
+		return
+	}
+
+	userID, exists := auth.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized access"})
+		return
+	}
+
+	component, err := h.componentStore.GetComponentByID(c.Request.Context(), componentID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to get component", "component_id", componentID, "error", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Component not found"})
+		return
+	}
+
+	// SECURITY: Check if the user owns this component
+	if component.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to render this component"})
+		return
+	}
+
+	if component.Layout == nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "This component has no layout to render"})
+		return
+	}
+
+	code, err := layout.Render(req.Target, *component.Layout)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": code})
+}
 
 // UpdateCodeRequest represents the request payload for updating component code
 type UpdateCodeRequest struct {
 	Code       string `json:"code" binding:"required"`
 	UserPrompt string `json:"user_prompt" binding:"required"`
+
+	Options GenerationOptionsRequest `json:"options"`
 }
 
 // UpdateComponentCode handles POST requests to update the code of a UI component using AI
@@ -361,22 +579,32 @@ func (h *UIComponentHandler) UpdateComponentCode(c *gin.Context) {
 		return
 	}
 
-	
+	options, err := req.Options.CompletionOptions()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid advanced settings", "details": err.Error()})
+		return
+	}
 
 	// Get user ID from context
-	_, exists := auth.GetUserIDFromContext(c)
+	userID, exists := auth.GetUserIDFromContext(c)
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized access"})
 		return
 	}
 
-	// Embed the code with the user prompt
-	prompt := req.UserPrompt + "\n\nHere is the code to update:\n\n" + req.Code
+	provider, charge, ok := h.userProvider(c, userID)
+	if !ok {
+		return
+	}
 
-	// Generate UI code using the AI package
-	codeUpdateResp, err := ai.UpdateCode(c.Request.Context(), prompt, h.aiProvider)
+	// Generate UI code using the AI package. The instructions and the code are passed
+	// separately so that text inside the code (e.g. of a forked component) is not read as instructions.
+	assignment := h.experiments.Assign(experiments.OperationUpdate, userID)
+	settings := assignment.Settings
+	settings.Options = options
+	codeUpdateResp, err := ai.UpdateCode(c.Request.Context(), req.UserPrompt, req.Code, provider, settings)
 	if err != nil {
-		slog.Error("Failed to update code with AI", "error", err)
+		slog.ErrorContext(c.Request.Context(), "Failed to update code with AI", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update code"})
 		return
 	}
@@ -386,5 +614,11 @@ func (h *UIComponentHandler) UpdateComponentCode(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"code": codeUpdateResp.Component.Code})
+	// The editor saves whatever code is returned, so it is repaired here
+	code, _ := ai.RepairHTML(c.Request.Context(), codeUpdateResp.Component, provider, settings)
+
+	// The preview cost a model call whether or not it is saved
+	chargeGeneration(c, charge, userID)
+
+	c.JSON(http.StatusOK, gin.H{"code": code})
 }
@@ -0,0 +1,423 @@
+package uicomponents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sketch-to-ui-final-proj/accounts"
+	"sketch-to-ui-final-proj/ai"
+	"sketch-to-ui-final-proj/auth"
+	"sketch-to-ui-final-proj/experiments"
+	"sketch-to-ui-final-proj/layout"
+	"sketch-to-ui-final-proj/sketch"
+)
+
+// memoryStore is a ComponentRepository kept in memory.
+type memoryStore struct {
+	mu         sync.Mutex
+	components map[int]UIComponent
+	feedback   []ComponentFeedback
+	nextID     int
+	// failInsert makes the nth insert of CreateComponents fail when set
+	failInsert int
+}
+
+func newMemoryStore(components ...UIComponent) *memoryStore {
+	store := &memoryStore{components: map[int]UIComponent{}}
+	for _, c := range components {
+		store.components[c.ID] = c
+		store.nextID = max(store.nextID, c.ID)
+	}
+	return store
+}
+
+func (m *memoryStore) CreateComponents(_ context.Context, components []UIComponent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Like the transaction of the database store, the components are kept only
+	// once all of them are inserted
+	staged, nextID := maps.Clone(m.components), m.nextID
+	var insert func(component *UIComponent) error
+	insert = func(component *UIComponent) error {
+		if m.failInsert > 0 && len(staged)-len(m.components) == m.failInsert-1 {
+			return errors.New("insert failed")
+		}
+		nextID++
+		component.ID = nextID
+		for i := range component.Children {
+			component.Children[i].ParentID = component.ID
+		}
+		stored := *component
+		stored.Children = nil
+		staged[component.ID] = stored
+		for i := range component.Children {
+			if err := insert(&component.Children[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for i := range components {
+		if err := insert(&components[i]); err != nil {
+			return err
+		}
+	}
+	m.components, m.nextID = staged, nextID
+	return nil
+}
+
+func (m *memoryStore) UpdateComponent(_ context.Context, id int, component *UIComponent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.components[id]
+	if !ok {
+		return fmt.Errorf("component with id %d not found or already archived", id)
+	}
+	stored.Title, stored.Type, stored.Code, stored.IsPublic = component.Title, component.Type, component.Code, component.IsPublic
+	stored.Layout = component.Layout
+	m.components[id] = stored
+	component.ID = id
+	return nil
+}
+
+func (m *memoryStore) UpdateGeneration(_ context.Context, component *UIComponent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.components[component.ID]
+	if !ok {
+		return fmt.Errorf("component with id %d not found or already archived", component.ID)
+	}
+	stored.Code, stored.Layout, stored.ModelID, stored.PromptVersion = component.Code, component.Layout, component.ModelID, component.PromptVersion
+	stored.SketchID, stored.GenerationPrompt = component.SketchID, component.GenerationPrompt
+	m.components[component.ID] = stored
+	return nil
+}
+
+func (m *memoryStore) ArchiveComponent(_ context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.components, id)
+	return nil
+}
+
+func (m *memoryStore) GetComponentByID(_ context.Context, id int) (*UIComponent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.components[id]
+	if !ok {
+		return nil, fmt.Errorf("component with id %d not found", id)
+	}
+	return &c, nil
+}
+
+func (m *memoryStore) GetComponentsByUserPaginated(_ context.Context, userID int, limit int, offset int) ([]UIComponent, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var owned []UIComponent
+	for _, c := range m.components {
+		if c.UserID == userID && c.ParentID == 0 {
+			owned = append(owned, c)
+		}
+	}
+	slices.SortFunc(owned, func(a, b UIComponent) int { return b.ID - a.ID })
+	total := len(owned)
+	owned = owned[min(offset, total):min(offset+limit, total)]
+	return owned, total, nil
+}
+
+func (m *memoryStore) GetChildren(_ context.Context, parentID int) ([]UIComponent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var children []UIComponent
+	for _, c := range m.components {
+		if c.ParentID == parentID {
+			children = append(children, c)
+		}
+	}
+	slices.SortFunc(children, func(a, b UIComponent) int { return a.Position - b.Position })
+	return children, nil
+}
+
+func (m *memoryStore) GetComponentTree(ctx context.Context, id int) (*UIComponent, error) {
+	root, err := m.GetComponentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	children, err := m.GetChildren(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, child := range children {
+		tree, err := m.GetComponentTree(ctx, child.ID)
+		if err != nil {
+			return nil, err
+		}
+		root.Children = append(root.Children, *tree)
+	}
+	root.ChildCount = len(root.Children)
+	return root, nil
+}
+
+func (m *memoryStore) SaveFeedback(_ context.Context, feedback *ComponentFeedback) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.feedback = slices.DeleteFunc(m.feedback, func(f ComponentFeedback) bool {
+		return f.ComponentID == feedback.ComponentID && f.UserID == feedback.UserID
+	})
+	feedback.ID = len(m.feedback) + 1
+	m.feedback = append(m.feedback, *feedback)
+	return nil
+}
+
+func (m *memoryStore) ForEachFeedback(_ context.Context, fn func(ComponentFeedback) error) error {
+	m.mu.Lock()
+	feedback := slices.Clone(m.feedback)
+	m.mu.Unlock()
+	for _, f := range feedback {
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// memorySketches is a sketch.SketchRepository that only looks sketches up.
+type memorySketches struct {
+	sketch.SketchRepository
+	sketches map[string]*sketch.Sketch
+}
+
+func (m memorySketches) GetSketch(_ context.Context, id string) (*sketch.Sketch, error) {
+	if s, ok := m.sketches[id]; ok {
+		return s, nil
+	}
+	return nil, sketch.ErrSketchNotFound
+}
+
+// ownersSketch is a private sketch of user 7.
+func ownersSketch() memorySketches {
+	return memorySketches{sketches: map[string]*sketch.Sketch{
+		"sketch-1": {ID: "sketch-1", OwnerID: "7", MediaType: "image/png", ImageURL: "aGVsbG8="},
+	}}
+}
+
+// replyProvider replies to every request with reply, and counts the requests.
+type replyProvider struct {
+	reply    string
+	requests int
+}
+
+func (p *replyProvider) RequestChatCompletion(context.Context, []ai.Message, string, ai.CompletionOptions) (string, error) {
+	p.requests++
+	return p.reply, nil
+}
+
+// newTestHandler creates a handler that generates with provider, as a shared
+// provider without API keys, and runs no experiments.
+// quotaKeyStore is an accounts.KeyStore of users without API keys, who share one
+// free generation counter.
+type quotaKeyStore struct {
+	used int
+}
+
+func (s *quotaKeyStore) GetAPIKey(context.Context, int) (*accounts.StoredKey, error) {
+	return nil, accounts.ErrNoAPIKey
+}
+
+func (s *quotaKeyStore) UseFreeGeneration(_ context.Context, _ int, limit int) (bool, error) {
+	if s.used >= limit {
+		return false, nil
+	}
+	s.used++
+	return true, nil
+}
+
+func (s *quotaKeyStore) FreeGenerationsUsed(context.Context, int) (int, error) {
+	return s.used, nil
+}
+
+func newTestHandler(store ComponentRepository, sketches sketch.SketchRepository, provider ai.LLMProvider) *UIComponentHandler {
+	keyring := accounts.NewKeyring(nil, nil, ai.ProviderOllama, provider, nil, 0)
+	return NewUIComponentHandler(store, sketches, keyring, experiments.NewManager(nil, nil))
+}
+
+// newComponentRouter serves the component routes of h for a caller logged in as userID.
+func newComponentRouter(h *UIComponentHandler, userID auth.ID) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("userID", userID)
+	})
+	router.LoadHTMLGlob("../templates/**/*.html")
+	router.GET("/components/create", h.RenderComponentsCreate)
+	router.POST("/components/", h.CreateComponent)
+	router.PUT("/components/:id", h.UpdateComponent)
+	router.DELETE("/components/:id", h.ArchiveComponent)
+	router.POST("/components/:id/regenerate", h.RegenerateFromSketch)
+	router.POST("/components/:id/sketch", h.AttachSketch)
+	router.POST("/components/update-code", h.UpdateComponentCode)
+	router.POST("/components/:id/feedback", h.SubmitFeedback)
+	router.GET("/admin/feedback/export", h.ExportFeedback)
+	return router
+}
+
+// sendForm sends values as a form to router and returns the response.
+func sendForm(router *gin.Engine, method string, path string, values url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestUpdateComponent_FixesEditedHTML(t *testing.T) {
+	store := newMemoryStore(UIComponent{ID: 1, UserID: 7, Title: "Card", Code: "<div>Card</div>"})
+	router := newComponentRouter(NewUIComponentHandler(store, nil, nil, nil), 7)
+
+	w := sendForm(router, http.MethodPut, "/components/1", url.Values{"code": {"<html><body><div>Edited</div></body></html>"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	stored, err := store.GetComponentByID(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, "<div>Edited</div>", strings.TrimSpace(stored.Code))
+}
+
+func TestUpdateComponent_CodeEditDropsTheLayout(t *testing.T) {
+	tree := &layout.Node{Type: "card", Text: "Card"}
+	store := newMemoryStore(UIComponent{ID: 1, UserID: 7, Title: "Card", Code: "<div>Card</div>", Layout: tree})
+	router := newComponentRouter(NewUIComponentHandler(store, nil, nil, nil), 7)
+
+	// Renaming keeps the code, so the layout still describes it
+	w := sendForm(router, http.MethodPut, "/components/1", url.Values{"title": {"Profile"}, "code": {"<div>Card</div>"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, tree, store.components[1].Layout)
+
+	w = sendForm(router, http.MethodPut, "/components/1", url.Values{"code": {"<div>Edited</div>"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Nil(t, store.components[1].Layout)
+}
+
+func TestUpdateComponent_RejectsUnfixableHTML(t *testing.T) {
+	store := newMemoryStore(UIComponent{ID: 1, UserID: 7, Title: "Card", Code: "<div>Card</div>"})
+	router := newComponentRouter(NewUIComponentHandler(store, nil, nil, nil), 7)
+
+	w := sendForm(router, http.MethodPut, "/components/1", url.Values{"code": {"   "}})
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "empty output")
+
+	stored, err := store.GetComponentByID(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, "<div>Card</div>", stored.Code)
+}
+
+func TestCreateComponent_SketchNotSharedIsNotFound(t *testing.T) {
+	store := newMemoryStore()
+	provider := &replyProvider{reply: `{"components":[{"title":"Login","type":"Form","code":"<form>Login</form>"}]}`}
+	handler := newTestHandler(store, ownersSketch(), provider)
+
+	w := sendForm(newComponentRouter(handler, 8), http.MethodPost, "/components/", url.Values{"sketch_id": {"sketch-1"}})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Zero(t, provider.requests)
+	assert.Empty(t, store.components)
+
+	// The owner generates from it
+	w = sendForm(newComponentRouter(handler, 7), http.MethodPost, "/components/", url.Values{"sketch_id": {"sketch-1"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Len(t, store.components, 1)
+	assert.Equal(t, "sketch-1", store.components[1].SketchID)
+}
+
+func TestRenderComponentsCreate_OnlyPreselectsAccessibleSketches(t *testing.T) {
+	handler := newTestHandler(newMemoryStore(), ownersSketch(), &replyProvider{})
+
+	for userID, preselected := range map[auth.ID]bool{7: true, 8: false} {
+		w := httptest.NewRecorder()
+		newComponentRouter(handler, userID).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/components/create?sketch_id=sketch-1", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, preselected, strings.Contains(w.Body.String(), `sketchId: "sketch-1"`), "user %d", userID)
+	}
+}
+
+func TestCreateComponent_TextOnlyIsNotRecordedUnderOtherPipeline(t *testing.T) {
+	store := newMemoryStore()
+	provider := &replyProvider{reply: `{"components":[{"title":"Login","type":"Form","code":"<form>Login</form>"}]}`}
+	handler := newTestHandler(store, ownersSketch(), provider)
+	// Every user is in the layout pipeline arm. The manager has no store to record
+	// assignments in, so recording one would crash the request.
+	handler.experiments = experiments.NewManager([]experiments.Experiment{{
+		Name:      "layout",
+		Operation: experiments.OperationCreate,
+		Fraction:  1,
+		Treatment: experiments.Arm{Name: "layout", Pipeline: ai.PipelineLayout},
+	}}, nil)
+
+	w := sendForm(newComponentRouter(handler, 7), http.MethodPost, "/components/", url.Values{"user_prompt": {"A login form"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Len(t, store.components, 1)
+}
+
+func TestUpdateComponentCode_ChargesPreviewsToTheFreeQuota(t *testing.T) {
+	store := newMemoryStore()
+	provider := &replyProvider{reply: `{"component":{"title":"Card","type":"Card","code":"<div>Dark</div>"}}`}
+	keys := &quotaKeyStore{}
+	handler := NewUIComponentHandler(store, ownersSketch(), accounts.NewKeyring(keys, nil, ai.ProviderOpenRouter, provider, nil, 1), experiments.NewManager(nil, nil))
+	router := newComponentRouter(handler, 7)
+
+	preview := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/components/update-code", strings.NewReader(`{"code":"<div>Card</div>","user_prompt":"Make it dark"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := preview()
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "Dark")
+	assert.Equal(t, 1, keys.used)
+
+	// With the quota used up, the shared key is not used again
+	w = preview()
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, 1, provider.requests)
+}
+
+func TestUpdateComponentCode_PreviewIsNotRecorded(t *testing.T) {
+	store := newMemoryStore(UIComponent{ID: 1, UserID: 7, Title: "Card", Code: "<div>Card</div>"})
+	provider := &replyProvider{reply: `{"component":{"title":"Card","type":"Card","code":"<div>Dark</div>"}}`}
+	handler := newTestHandler(store, ownersSketch(), provider)
+	// Every user is in the treatment arm. The manager has no store to record
+	// assignments in, so recording one would crash the request.
+	handler.experiments = experiments.NewManager([]experiments.Experiment{{
+		Name:      "prompts",
+		Operation: experiments.OperationUpdate,
+		Fraction:  1,
+		Treatment: experiments.Arm{Name: "v2", PromptVersion: "v2"},
+	}}, nil)
+	router := newComponentRouter(handler, 7)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/components/update-code", strings.NewReader(`{"code":"<div>Card</div>","user_prompt":"Make it dark"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	}
+
+	// Saving code written by hand is not recorded either
+	w := sendForm(router, http.MethodPut, "/components/1", url.Values{"code": {"<div>Mine</div>"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
@@ -1,8 +1,16 @@
 package uicomponents
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"sketch-to-ui-final-proj/layout"
+	"sketch-to-ui-final-proj/tracing"
 )
 
 type UIComponentsStore struct {
@@ -15,15 +23,48 @@ func NewUIComponentsStore(db *sql.DB) *UIComponentsStore {
 	}
 }
 
+// startSpan starts a client span for a single store operation.
+func (cs *UIComponentsStore) startSpan(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "UIComponentsStore."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation", operation),
+		),
+	)
+}
+
+// rowQuerier runs single row queries on the database or within a transaction.
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 // CreateComponent creates a new UI component
-func (cs *UIComponentsStore) CreateComponent(component *UIComponent) error {
+func (cs *UIComponentsStore) CreateComponent(ctx context.Context, component *UIComponent) (err error) {
+	ctx, span := cs.startSpan(ctx, "CreateComponent")
+	defer func() { tracing.End(span, err) }()
+
+	return insertComponent(ctx, cs.db, component)
+}
+
+// insertComponent inserts component and sets its ID and timestamps.
+func insertComponent(ctx context.Context, q rowQuerier, component *UIComponent) error {
+	layoutJSON, err := marshalLayout(component.Layout)
+	if err != nil {
+		return err
+	}
+
 	sqlQuery := `
-		INSERT INTO uicomponents (title, type, code, is_public, user_id, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-		RETURNING id, created_at, updated_at`
+		INSERT INTO uicomponents (title, type, code, is_public, user_id, model_id, prompt_version, sketch_id,
+			generation_prompt, layout, parent_id, position, template, created_at, updated_at, generated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, 0), $12, $13,
+			CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		RETURNING id, created_at, updated_at, generated_at`
 
-	err := cs.db.QueryRow(sqlQuery, component.Title, component.Type, component.Code, component.IsPublic, component.UserID).
-		Scan(&component.ID, &component.CreatedAt, &component.UpdatedAt)
+	err = q.QueryRowContext(ctx, sqlQuery, component.Title, component.Type, component.Code, component.IsPublic, component.UserID,
+		component.ModelID, component.PromptVersion, component.SketchID, component.GenerationPrompt, layoutJSON,
+		component.ParentID, component.Position, component.Template).
+		Scan(&component.ID, &component.CreatedAt, &component.UpdatedAt, &component.GeneratedAt)
 
 	if err != nil {
 		return fmt.Errorf("failed to create component: %w", err)
@@ -32,15 +73,23 @@ func (cs *UIComponentsStore) CreateComponent(component *UIComponent) error {
 	return nil
 }
 
-// UpdateComponent updates an existing UI component
-func (cs *UIComponentsStore) UpdateComponent(id int, component *UIComponent) error {
+// UpdateComponent updates an existing UI component, and its layout tree
+func (cs *UIComponentsStore) UpdateComponent(ctx context.Context, id int, component *UIComponent) (err error) {
+	ctx, span := cs.startSpan(ctx, "UpdateComponent")
+	defer func() { tracing.End(span, err) }()
+
+	layoutJSON, err := marshalLayout(component.Layout)
+	if err != nil {
+		return err
+	}
+
 	sqlQuery := `
 		UPDATE uicomponents 
-		SET title = $1, type = $2, code = $3, is_public = $4, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $5 AND archived_at IS NULL
+		SET title = $1, type = $2, code = $3, is_public = $4, layout = $5, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $6 AND archived_at IS NULL
 		RETURNING updated_at`
 
-	err := cs.db.QueryRow(sqlQuery, component.Title, component.Type, component.Code, component.IsPublic, id).
+	err = cs.db.QueryRowContext(ctx, sqlQuery, component.Title, component.Type, component.Code, component.IsPublic, layoutJSON, id).
 		Scan(&component.UpdatedAt)
 
 	if err != nil {
@@ -54,14 +103,23 @@ func (cs *UIComponentsStore) UpdateComponent(id int, component *UIComponent) err
 	return nil
 }
 
-// ArchiveComponent soft deletes a UI component by setting archived_at timestamp
-func (cs *UIComponentsStore) ArchiveComponent(id int) error {
+// ArchiveComponent soft deletes a UI component, and the parts of a page or section,
+// by setting archived_at timestamp
+func (cs *UIComponentsStore) ArchiveComponent(ctx context.Context, id int) (err error) {
+	ctx, span := cs.startSpan(ctx, "ArchiveComponent")
+	defer func() { tracing.End(span, err) }()
+
 	sqlQuery := `
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM uicomponents WHERE id = $1
+			UNION ALL
+			SELECT c.id FROM uicomponents c JOIN subtree s ON c.parent_id = s.id
+		)
 		UPDATE uicomponents 
 		SET archived_at = CURRENT_TIMESTAMP 
-		WHERE id = $1 AND archived_at IS NULL`
+		WHERE id IN (SELECT id FROM subtree) AND archived_at IS NULL`
 
-	result, err := cs.db.Exec(sqlQuery, id)
+	result, err := cs.db.ExecContext(ctx, sqlQuery, id)
 	if err != nil {
 		return fmt.Errorf("failed to archive component: %w", err)
 	}
@@ -79,14 +137,21 @@ func (cs *UIComponentsStore) ArchiveComponent(id int) error {
 }
 
 // GetComponentByID retrieves a component by its ID
-func (cs *UIComponentsStore) GetComponentByID(id int) (*UIComponent, error) {
+func (cs *UIComponentsStore) GetComponentByID(ctx context.Context, id int) (_ *UIComponent, err error) {
+	ctx, span := cs.startSpan(ctx, "GetComponentByID")
+	defer func() { tracing.End(span, err) }()
+
 	sqlQuery := `
-		SELECT id, title, type, code, is_public, user_id, created_at, updated_at
-		FROM uicomponents
-		WHERE id = $1 AND archived_at IS NULL`
+		SELECT c.id, c.title, c.type, c.code, c.is_public, c.user_id, c.created_at, c.updated_at,
+			c.model_id, c.prompt_version, c.sketch_id, c.generation_prompt, COALESCE(c.generated_at, c.created_at),
+			c.layout, COALESCE(c.parent_id, 0), c.position, c.template, COALESCE(f.rating, 0)
+		FROM uicomponents c
+		LEFT JOIN component_feedback f ON f.component_id = c.id AND f.user_id = c.user_id
+		WHERE c.id = $1 AND c.archived_at IS NULL`
 
 	var component UIComponent
-	err := cs.db.QueryRow(sqlQuery, id).Scan(
+	var layoutJSON []byte
+	err = cs.db.QueryRowContext(ctx, sqlQuery, id).Scan(
 		&component.ID,
 		&component.Title,
 		&component.Type,
@@ -95,6 +160,16 @@ func (cs *UIComponentsStore) GetComponentByID(id int) (*UIComponent, error) {
 		&component.UserID,
 		&component.CreatedAt,
 		&component.UpdatedAt,
+		&component.ModelID,
+		&component.PromptVersion,
+		&component.SketchID,
+		&component.GenerationPrompt,
+		&component.GeneratedAt,
+		&layoutJSON,
+		&component.ParentID,
+		&component.Position,
+		&component.Template,
+		&component.FeedbackRating,
 	)
 
 	if err != nil {
@@ -104,18 +179,25 @@ func (cs *UIComponentsStore) GetComponentByID(id int) (*UIComponent, error) {
 		return nil, fmt.Errorf("failed to get component by id: %w", err)
 	}
 
+	if component.Layout, err = unmarshalLayout(layoutJSON); err != nil {
+		return nil, err
+	}
+
 	return &component, nil
 }
 
 // GetAllComponentsByUser retrieves all non-archived UI components for a user
-func (cs *UIComponentsStore) GetAllComponentsByUser(userID int) ([]UIComponent, error) {
+func (cs *UIComponentsStore) GetAllComponentsByUser(ctx context.Context, userID int) (_ []UIComponent, err error) {
+	ctx, span := cs.startSpan(ctx, "GetAllComponentsByUser")
+	defer func() { tracing.End(span, err) }()
+
 	sqlQuery := `
 		SELECT id, title, type, code, is_public, user_id, created_at, updated_at, archived_at
 		FROM uicomponents 
 		WHERE user_id = $1 AND archived_at IS NULL
 		ORDER BY created_at DESC`
 
-	rows, err := cs.db.Query(sqlQuery, userID)
+	rows, err := cs.db.QueryContext(ctx, sqlQuery, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query components by user: %w", err)
 	}
@@ -148,24 +230,29 @@ func (cs *UIComponentsStore) GetAllComponentsByUser(userID int) ([]UIComponent,
 	return components, nil
 }
 
-func (cs *UIComponentsStore) GetComponentsByUserPaginated(userID int, limit int, offset int) ([]UIComponent, int, error) {
-	// Get total count
-	countQuery := `SELECT COUNT(*) FROM uicomponents WHERE user_id = $1 AND archived_at IS NULL`
+func (cs *UIComponentsStore) GetComponentsByUserPaginated(ctx context.Context, userID int, limit int, offset int) (_ []UIComponent, _ int, err error) {
+	ctx, span := cs.startSpan(ctx, "GetComponentsByUserPaginated")
+	defer func() { tracing.End(span, err) }()
+
+	// Get total count of top-level components; parts of a page are listed with the page
+	countQuery := `SELECT COUNT(*) FROM uicomponents WHERE user_id = $1 AND parent_id IS NULL AND archived_at IS NULL`
 	var total int
-	err := cs.db.QueryRow(countQuery, userID).Scan(&total)
+	err = cs.db.QueryRowContext(ctx, countQuery, userID).Scan(&total)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to get total count: %w", err)
 	}
 
 	// Get paginated results
 	sqlQuery := `
-        SELECT id, title, type, code, user_id, created_at, updated_at
-        FROM uicomponents 
-        WHERE user_id = $1 AND archived_at IS NULL
-        ORDER BY created_at DESC
+        SELECT c.id, c.title, c.type, c.code, c.user_id, c.created_at, c.updated_at, COALESCE(f.rating, 0),
+            (SELECT COUNT(*) FROM uicomponents ch WHERE ch.parent_id = c.id AND ch.archived_at IS NULL)
+        FROM uicomponents c
+        LEFT JOIN component_feedback f ON f.component_id = c.id AND f.user_id = c.user_id
+        WHERE c.user_id = $1 AND c.parent_id IS NULL AND c.archived_at IS NULL
+        ORDER BY c.created_at DESC
         LIMIT $2 OFFSET $3`
 
-	rows, err := cs.db.Query(sqlQuery, userID, limit, offset)
+	rows, err := cs.db.QueryContext(ctx, sqlQuery, userID, limit, offset)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to query components: %w", err)
 	}
@@ -176,7 +263,8 @@ func (cs *UIComponentsStore) GetComponentsByUserPaginated(userID int, limit int,
 		var component UIComponent
 		err := rows.Scan(
 			&component.ID, &component.Title, &component.Type, &component.Code,
-			&component.UserID, &component.CreatedAt, &component.UpdatedAt,
+			&component.UserID, &component.CreatedAt, &component.UpdatedAt, &component.FeedbackRating,
+			&component.ChildCount,
 		)
 		if err != nil {
 			return nil, 0, fmt.Errorf("failed to scan component: %w", err)
@@ -188,14 +276,17 @@ func (cs *UIComponentsStore) GetComponentsByUserPaginated(userID int, limit int,
 }
 
 // GetAllComponents retrieves all non-archived UI components (admin function)
-func (cs *UIComponentsStore) GetAllComponents() ([]UIComponent, error) {
+func (cs *UIComponentsStore) GetAllComponents(ctx context.Context) (_ []UIComponent, err error) {
+	ctx, span := cs.startSpan(ctx, "GetAllComponents")
+	defer func() { tracing.End(span, err) }()
+
 	sqlQuery := `
 		SELECT id, title, type, code, is_public, user_id, created_at, updated_at, archived_at
 		FROM uicomponents 
 		WHERE archived_at IS NULL
 		ORDER BY created_at DESC`
 
-	rows, err := cs.db.Query(sqlQuery)
+	rows, err := cs.db.QueryContext(ctx, sqlQuery)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query all components: %w", err)
 	}
@@ -229,7 +320,10 @@ func (cs *UIComponentsStore) GetAllComponents() ([]UIComponent, error) {
 }
 
 // GetAllPublicComponentsWithUser retrieves all public components with user first and last name
-func (cs *UIComponentsStore) GetAllPublicComponentsWithUser() ([]PublicComponentWithUser, error) {
+func (cs *UIComponentsStore) GetAllPublicComponentsWithUser(ctx context.Context) (_ []PublicComponentWithUser, err error) {
+	ctx, span := cs.startSpan(ctx, "GetAllPublicComponentsWithUser")
+	defer func() { tracing.End(span, err) }()
+
 	sqlQuery := `
 		SELECT 
 			c.id, c.title, c.type, c.code, c.is_public, c.user_id,
@@ -241,7 +335,7 @@ func (cs *UIComponentsStore) GetAllPublicComponentsWithUser() ([]PublicComponent
 		ORDER BY c.created_at DESC
 	`
 
-	rows, err := cs.db.Query(sqlQuery)
+	rows, err := cs.db.QueryContext(ctx, sqlQuery)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query public components with user: %w", err)
 	}
@@ -275,3 +369,27 @@ func (cs *UIComponentsStore) GetAllPublicComponentsWithUser() ([]PublicComponent
 
 	return results, nil
 }
+
+// marshalLayout encodes a layout tree for the layout column (NULL when nil)
+func marshalLayout(tree *layout.Node) (any, error) {
+	if tree == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode layout: %w", err)
+	}
+	return data, nil
+}
+
+// unmarshalLayout decodes the layout column
+func unmarshalLayout(data []byte) (*layout.Node, error) {
+	if data == nil {
+		return nil, nil
+	}
+	var tree layout.Node
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("failed to decode layout: %w", err)
+	}
+	return &tree, nil
+}
@@ -0,0 +1,131 @@
+package uicomponents
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sketch-to-ui-final-proj/auth"
+	"sketch-to-ui-final-proj/utils/htmx"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FeedbackRequest represents the payload sent by the thumbs up/down buttons
+type FeedbackRequest struct {
+	Rating string `form:"rating" binding:"required,oneof=up down"`
+	Reason string `form:"feedback_reason" binding:"max=1000"`
+}
+
+// FeedbackRecord is one line of the exported JSONL feedback dataset
+type FeedbackRecord struct {
+	ComponentID   int       `json:"component_id"`
+	Rating        string    `json:"rating"`
+	Reason        string    `json:"reason,omitempty"`
+	ModelID       string    `json:"model_id"`
+	PromptVersion string    `json:"prompt_version"`
+	SketchID      string    `json:"sketch_id,omitempty"`
+	Title         string    `json:"title"`
+	Type          string    `json:"type"`
+	Code          string    `json:"code"`
+	RatedAt       time.Time `json:"rated_at"`
+}
+
+// SubmitFeedback handles POST requests rating a component the user owns
+func (h *UIComponentHandler) SubmitFeedback(c *gin.Context) {
+	componentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid component ID"})
+		return
+	}
+
+	var req FeedbackRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload", "details": err.Error()})
+		return
+	}
+
+	userID, exists := auth.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized access"})
+		return
+	}
+
+	component, err := h.componentStore.GetComponentByID(c.Request.Context(), componentID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to get component", "component_id", componentID, "error", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Component not found"})
+		return
+	}
+
+	// SECURITY: Check if the user owns this component
+	if component.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to rate this component"})
+		return
+	}
+
+	rating := RatingUp
+	if req.Rating == "down" {
+		rating = RatingDown
+	}
+
+	feedback := ComponentFeedback{
+		ComponentID:   component.ID,
+		UserID:        userID,
+		Rating:        rating,
+		Reason:        strings.TrimSpace(req.Reason),
+		ModelID:       component.ModelID,
+		PromptVersion: component.PromptVersion,
+		SketchID:      component.SketchID,
+		Code:          component.Code,
+	}
+	if err := h.componentStore.SaveFeedback(c.Request.Context(), &feedback); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to save feedback", "component_id", componentID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save feedback"})
+		return
+	}
+
+	component.FeedbackRating = rating
+	htmx.TriggerToast(c, htmx.InfoLevel, "Thanks for the feedback!")
+	c.HTML(http.StatusOK, "_feedback.html", component)
+}
+
+// ExportFeedback streams every rating as a JSONL dataset (admin only)
+func (h *UIComponentHandler) ExportFeedback(c *gin.Context) {
+	filename := "component-feedback-" + time.Now().UTC().Format("20060102") + ".jsonl"
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	w := bufio.NewWriter(c.Writer)
+	encoder := json.NewEncoder(w)
+	err := h.componentStore.ForEachFeedback(c.Request.Context(), func(f ComponentFeedback) error {
+		rating := "up"
+		if f.Rating == RatingDown {
+			rating = "down"
+		}
+		return encoder.Encode(FeedbackRecord{
+			ComponentID:   f.ComponentID,
+			Rating:        rating,
+			Reason:        f.Reason,
+			ModelID:       f.ModelID,
+			PromptVersion: f.PromptVersion,
+			SketchID:      f.SketchID,
+			Title:         f.Title,
+			Type:          f.Type,
+			Code:          f.Code,
+			RatedAt:       f.UpdatedAt,
+		})
+	})
+	if err != nil {
+		// Headers are already sent, so the export is cut short
+		slog.ErrorContext(c.Request.Context(), "Failed to export feedback", "error", err)
+	}
+	if err := w.Flush(); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to write feedback export", "error", err)
+	}
+}
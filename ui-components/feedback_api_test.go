@@ -0,0 +1,78 @@
+package uicomponents
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ratedComponent() UIComponent {
+	return UIComponent{ID: 1, UserID: 7, Title: "Login", Type: "Form", Code: "<form></form>", ModelID: "model-a", PromptVersion: "v2", SketchID: "sketch-1"}
+}
+
+func TestSubmitFeedback_KeepsTheLatestRatingWithItsProvenance(t *testing.T) {
+	store := newMemoryStore(ratedComponent())
+	router := newComponentRouter(NewUIComponentHandler(store, nil, nil, nil), 7)
+
+	w := sendForm(router, http.MethodPost, "/components/1/feedback", url.Values{"rating": {"up"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "mdi:thumb-up\"")
+
+	// Rating again replaces the first rating
+	w = sendForm(router, http.MethodPost, "/components/1/feedback", url.Values{"rating": {"down"}, "feedback_reason": {"  Wrong colors "}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "mdi:thumb-down\"")
+
+	require.Len(t, store.feedback, 1)
+	feedback := store.feedback[0]
+	assert.Equal(t, RatingDown, feedback.Rating)
+	assert.Equal(t, "Wrong colors", feedback.Reason)
+	assert.Equal(t, "model-a", feedback.ModelID)
+	assert.Equal(t, "v2", feedback.PromptVersion)
+	assert.Equal(t, "sketch-1", feedback.SketchID)
+	assert.Equal(t, "<form></form>", feedback.Code)
+}
+
+func TestSubmitFeedback_RejectsOthersAndUnknownRatings(t *testing.T) {
+	store := newMemoryStore(ratedComponent())
+
+	w := sendForm(newComponentRouter(NewUIComponentHandler(store, nil, nil, nil), 8), http.MethodPost, "/components/1/feedback", url.Values{"rating": {"up"}})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = sendForm(newComponentRouter(NewUIComponentHandler(store, nil, nil, nil), 7), http.MethodPost, "/components/1/feedback", url.Values{"rating": {"meh"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, store.feedback)
+}
+
+func TestExportFeedback_WritesOneRecordPerLine(t *testing.T) {
+	store := newMemoryStore(ratedComponent())
+	store.feedback = []ComponentFeedback{
+		{ComponentID: 1, UserID: 7, Rating: RatingUp, ModelID: "model-a", PromptVersion: "v2", Title: "Login", Type: "Form", Code: "<form></form>"},
+		{ComponentID: 2, UserID: 8, Rating: RatingDown, Reason: "Broken", ModelID: "model-b", PromptVersion: "v1", SketchID: "sketch-2", Title: "Card", Type: "Card", Code: "<div></div>"},
+	}
+	router := newComponentRouter(NewUIComponentHandler(store, nil, nil, nil), 1)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/feedback/export", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), ".jsonl")
+
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, 2)
+	var records []FeedbackRecord
+	for _, line := range lines {
+		var record FeedbackRecord
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	assert.Equal(t, "up", records[0].Rating)
+	assert.NotContains(t, lines[0], "sketch_id", "empty provenance is left out")
+	assert.Equal(t, FeedbackRecord{ComponentID: 2, Rating: "down", Reason: "Broken", ModelID: "model-b", PromptVersion: "v1", SketchID: "sketch-2", Title: "Card", Type: "Card", Code: "<div></div>"}, records[1])
+}
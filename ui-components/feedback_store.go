@@ -0,0 +1,98 @@
+package uicomponents
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sketch-to-ui-final-proj/tracing"
+)
+
+// Ratings a user can give a generated component
+const (
+	RatingUp   = 1
+	RatingDown = -1
+)
+
+// ComponentFeedback is a user's rating of a generated component together with the
+// generation provenance and code at the time of rating.
+type ComponentFeedback struct {
+	ID            int       `db:"id"`
+	ComponentID   int       `db:"component_id"`
+	UserID        int       `db:"user_id"`
+	Rating        int       `db:"rating"`
+	Reason        string    `db:"reason"`
+	ModelID       string    `db:"model_id"`
+	PromptVersion string    `db:"prompt_version"`
+	SketchID      string    `db:"sketch_id"`
+	Title         string    `db:"title"`
+	Type          string    `db:"type"`
+	Code          string    `db:"code"`
+	CreatedAt     time.Time `db:"created_at"`
+	UpdatedAt     time.Time `db:"updated_at"`
+}
+
+// SaveFeedback creates or replaces the user's rating of a component
+func (cs *UIComponentsStore) SaveFeedback(ctx context.Context, feedback *ComponentFeedback) (err error) {
+	ctx, span := cs.startSpan(ctx, "SaveFeedback")
+	defer func() { tracing.End(span, err) }()
+
+	sqlQuery := `
+		INSERT INTO component_feedback (component_id, user_id, rating, reason, model_id, prompt_version, sketch_id, code)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (component_id, user_id) DO UPDATE
+		SET rating = EXCLUDED.rating, reason = EXCLUDED.reason, model_id = EXCLUDED.model_id,
+			prompt_version = EXCLUDED.prompt_version, sketch_id = EXCLUDED.sketch_id,
+			code = EXCLUDED.code, updated_at = CURRENT_TIMESTAMP
+		RETURNING id, created_at, updated_at`
+
+	err = cs.db.QueryRowContext(ctx, sqlQuery,
+		feedback.ComponentID, feedback.UserID, feedback.Rating, feedback.Reason,
+		feedback.ModelID, feedback.PromptVersion, feedback.SketchID, feedback.Code,
+	).Scan(&feedback.ID, &feedback.CreatedAt, &feedback.UpdatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to save feedback: %w", err)
+	}
+
+	return nil
+}
+
+// ForEachFeedback streams every feedback row, oldest first, to fn
+func (cs *UIComponentsStore) ForEachFeedback(ctx context.Context, fn func(ComponentFeedback) error) (err error) {
+	ctx, span := cs.startSpan(ctx, "ForEachFeedback")
+	defer func() { tracing.End(span, err) }()
+
+	sqlQuery := `
+		SELECT f.id, f.component_id, f.user_id, f.rating, f.reason, f.model_id, f.prompt_version,
+			f.sketch_id, c.title, c.type, f.code, f.created_at, f.updated_at
+		FROM component_feedback f
+		JOIN uicomponents c ON c.id = f.component_id
+		ORDER BY f.created_at`
+
+	rows, err := cs.db.QueryContext(ctx, sqlQuery)
+	if err != nil {
+		return fmt.Errorf("failed to query feedback: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f ComponentFeedback
+		err := rows.Scan(
+			&f.ID, &f.ComponentID, &f.UserID, &f.Rating, &f.Reason, &f.ModelID, &f.PromptVersion,
+			&f.SketchID, &f.Title, &f.Type, &f.Code, &f.CreatedAt, &f.UpdatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan feedback row: %w", err)
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over feedback rows: %w", err)
+	}
+
+	return nil
+}
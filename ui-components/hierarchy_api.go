@@ -0,0 +1,200 @@
+package uicomponents
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"sketch-to-ui-final-proj/ai"
+	"sketch-to-ui-final-proj/auth"
+	"sketch-to-ui-final-proj/sketch"
+	"sketch-to-ui-final-proj/utils/htmx"
+
+	"github.com/gin-gonic/gin"
+)
+
+// componentTree returns the component generated as dto at position, with its
+// children filled in from base like the component itself. The code of a page or
+// section is composed from its own markup, kept as its template, and the code of
+// its children.
+func componentTree(base UIComponent, dto ai.UIComponentDTO, position int) UIComponent {
+	component := base
+	component.Title = dto.Title
+	component.Type = dto.Type
+	component.Code = dto.ComposedCode()
+	component.Layout = dto.Layout
+	component.Position = position
+	if len(dto.Children) > 0 {
+		component.Template = dto.Code
+	}
+	for i, childDTO := range dto.Children {
+		component.Children = append(component.Children, componentTree(base, childDTO, i))
+	}
+	return component
+}
+
+// recomposeAncestors composes the code of every page or section above component
+// again after the component changed, and returns the ID of the top-level component.
+func (h *UIComponentHandler) recomposeAncestors(ctx context.Context, component *UIComponent) (int, error) {
+	rootID := component.ID
+	for parentID := component.ParentID; parentID != 0; {
+		parent, err := h.componentStore.GetComponentByID(ctx, parentID)
+		if err != nil {
+			return 0, err
+		}
+		children, err := h.componentStore.GetChildren(ctx, parent.ID)
+		if err != nil {
+			return 0, err
+		}
+
+		codes := make([]string, 0, len(children))
+		for _, child := range children {
+			codes = append(codes, child.Code)
+		}
+		parent.Code = ai.ComposeCode(parent.Template, codes)
+		if err := h.componentStore.UpdateComponent(ctx, parent.ID, parent); err != nil {
+			return 0, err
+		}
+
+		rootID = parent.ID
+		parentID = parent.ParentID
+	}
+	return rootID, nil
+}
+
+// RegenerateRequest carries the user's new instructions for a regeneration. Without
+// them the component is generated again from its sketch alone.
+type RegenerateRequest struct {
+	UserPrompt string `form:"user_prompt" binding:"max=4000,omitempty"`
+}
+
+// RegenerateFromSketch handles POST requests that generate a component, or one part
+// of a page, again from the sketch it was generated from. The siblings of a part are
+// left untouched and the page is composed again.
+func (h *UIComponentHandler) RegenerateFromSketch(c *gin.Context) {
+	componentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid component ID"})
+		return
+	}
+
+	var req RegenerateRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload", "details": err.Error()})
+		return
+	}
+
+	userID, exists := auth.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized access"})
+		return
+	}
+
+	component, err := h.componentStore.GetComponentByID(c.Request.Context(), componentID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to get component", "component_id", componentID, "error", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Component not found"})
+		return
+	}
+
+	// SECURITY: Check if the user owns this component
+	if component.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to regenerate this component"})
+		return
+	}
+
+	children, err := h.componentStore.GetChildren(c.Request.Context(), component.ID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to get child components", "component_id", componentID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load component"})
+		return
+	}
+	if len(children) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A page or section is regenerated one part at a time"})
+		return
+	}
+
+	if component.SketchID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This component was generated from a description; there is no sketch to regenerate it from"})
+		return
+	}
+	// SECURITY: The sketch may have been unshared or made private since the component
+	// was generated; it is reported as not found like any inaccessible sketch
+	sketch, err := sketch.GetAccessibleSketch(c.Request.Context(), h.sketches, component.SketchID, userID)
+	if err != nil || sketch.ImageURL == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "The sketch of this component is no longer available; upload it again to regenerate"})
+		return
+	}
+
+	part := ai.PartRequest{Title: component.Title, Type: component.Type, Instructions: req.UserPrompt, LayoutHints: sketch.LayoutHints()}
+	settings := ai.GenerationSettings{ModelID: component.ModelID, PromptVersion: component.PromptVersion, Pipeline: ai.PipelineDirect}
+	if component.ParentID != 0 {
+		parent, err := h.componentStore.GetComponentByID(c.Request.Context(), component.ParentID)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to get parent component", "component_id", component.ParentID, "error", err)
+			c.JSON(http.StatusNotFound, gin.H{"error": "Component not found"})
+			return
+		}
+		part.PageTitle = parent.Title
+	}
+	if component.Layout != nil {
+		// The box of a whole component is the sketch itself
+		if component.ParentID != 0 {
+			part.Box = component.Layout.Box
+		}
+		settings.Pipeline = ai.PipelineLayout
+	}
+
+	provider, charge, ok := h.userProvider(c, userID)
+	if !ok {
+		return
+	}
+
+	dto, failure, err := ai.RegeneratePart(c.Request.Context(), part, sketch.DataURI(), provider, settings)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to regenerate component", "component_id", componentID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to regenerate component"})
+		return
+	}
+	if failure != "" || dto.Code == "" {
+		if failure == "" {
+			failure = "Failed to regenerate the component from its sketch"
+		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": failure})
+		return
+	}
+
+	component.Code, _ = ai.RepairHTML(c.Request.Context(), dto, provider, settings)
+	component.Layout = dto.Layout
+	component.GenerationPrompt = strings.TrimSpace(req.UserPrompt)
+	if err := h.componentStore.UpdateGeneration(c.Request.Context(), component); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to save regenerated component", "component_id", componentID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save component"})
+		return
+	}
+	chargeGeneration(c, charge, userID)
+
+	rootID, err := h.recomposeAncestors(c.Request.Context(), component)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to recompose parent component", "component_id", componentID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update the page"})
+		return
+	}
+
+	location := map[string]interface{}{
+		"path":   fmt.Sprintf("/components/%d/edit", rootID),
+		"target": "#content",
+	}
+	locationJSON, err := json.Marshal(location)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal HX-Location"})
+		return
+	}
+	htmx.TriggerToast(c, htmx.InfoLevel, "The Component Was Regenerated Successfully")
+	c.Header("HX-Location", string(locationJSON))
+	c.Status(http.StatusOK)
+}
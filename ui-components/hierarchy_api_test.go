@@ -0,0 +1,89 @@
+package uicomponents
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegenerateFromSketch_SketchNotSharedIsNotFound(t *testing.T) {
+	// User 8 generated the component from user 7's sketch, which is no longer shared
+	store := newMemoryStore(UIComponent{ID: 1, UserID: 8, Title: "Login", Type: "Form", Code: "<form></form>", SketchID: "sketch-1"})
+	provider := &replyProvider{reply: `{"components":[{"title":"Login","type":"Form","code":"<form>Again</form>"}]}`}
+	sketches := ownersSketch()
+	handler := newTestHandler(store, sketches, provider)
+
+	w := sendForm(newComponentRouter(handler, 8), http.MethodPost, "/components/1/regenerate", url.Values{})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Zero(t, provider.requests)
+	assert.Equal(t, "<form></form>", store.components[1].Code)
+
+	// Shared again, it is regenerated
+	sketches.sketches["sketch-1"].SharedWith = []string{"8"}
+	w = sendForm(newComponentRouter(handler, 8), http.MethodPost, "/components/1/regenerate", url.Values{})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "<form>Again</form>", store.components[1].Code)
+}
+
+const pageReply = `{"components":[{"title":"Home","type":"Page","code":"<main><!-- children --></main>","children":[` +
+	`{"title":"Header","type":"Header","code":"<header>Header</header>"},` +
+	`{"title":"Footer","type":"Footer","code":"<footer>Footer</footer>"}]}]}`
+
+func TestCreateComponent_StoresPageWithItsParts(t *testing.T) {
+	store := newMemoryStore()
+	handler := newTestHandler(store, ownersSketch(), &replyProvider{reply: pageReply})
+
+	w := sendForm(newComponentRouter(handler, 7), http.MethodPost, "/components/", url.Values{"user_prompt": {"A home page"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Len(t, store.components, 3)
+
+	page := store.components[1]
+	assert.Equal(t, "<main><!-- children --></main>", page.Template)
+	assert.Equal(t, "<main><header>Header</header>\n<footer>Footer</footer></main>", page.Code)
+	assert.Equal(t, 1, store.components[2].ParentID)
+	assert.Equal(t, 1, store.components[3].ParentID)
+	assert.Equal(t, 1, store.components[3].Position)
+}
+
+func TestCreateComponent_FailedPartStoresNothing(t *testing.T) {
+	store := newMemoryStore()
+	store.failInsert = 3
+	handler := newTestHandler(store, ownersSketch(), &replyProvider{reply: pageReply})
+
+	w := sendForm(newComponentRouter(handler, 7), http.MethodPost, "/components/", url.Values{"user_prompt": {"A home page"}})
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Empty(t, store.components)
+}
+
+func TestUpdateComponent_PageCodeIsComposedFromItsParts(t *testing.T) {
+	store := newMemoryStore(
+		UIComponent{ID: 1, UserID: 7, Title: "Home", Type: "Page", Template: "<main><!-- children --></main>", Code: "<main><header>Header</header></main>"},
+		UIComponent{ID: 2, UserID: 7, Title: "Header", Type: "Header", Code: "<header>Header</header>", ParentID: 1},
+	)
+	router := newComponentRouter(NewUIComponentHandler(store, nil, nil, nil), 7)
+
+	w := sendForm(router, http.MethodPut, "/components/1", url.Values{"code": {"<main>Edited</main>"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "<main><header>Header</header></main>", store.components[1].Code)
+
+	// The page is edited through its parts
+	w = sendForm(router, http.MethodPut, "/components/2", url.Values{"code": {"<header>Edited</header>"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "<main><header>Edited</header></main>", store.components[1].Code)
+}
+
+func TestArchiveComponent_RecomposesThePage(t *testing.T) {
+	store := newMemoryStore(
+		UIComponent{ID: 1, UserID: 7, Title: "Home", Type: "Page", Template: "<main><!-- children --></main>", Code: "<main><header>Header</header>\n<footer>Footer</footer></main>"},
+		UIComponent{ID: 2, UserID: 7, Title: "Header", Type: "Header", Code: "<header>Header</header>", ParentID: 1},
+		UIComponent{ID: 3, UserID: 7, Title: "Footer", Type: "Footer", Code: "<footer>Footer</footer>", ParentID: 1, Position: 1},
+	)
+	router := newComponentRouter(NewUIComponentHandler(store, nil, nil, nil), 7)
+
+	w := sendForm(router, http.MethodDelete, "/components/3", url.Values{})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "<main><header>Header</header></main>", store.components[1].Code)
+}
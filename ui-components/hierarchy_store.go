@@ -0,0 +1,158 @@
+package uicomponents
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"sketch-to-ui-final-proj/ai"
+	"sketch-to-ui-final-proj/tracing"
+)
+
+// CreateComponents creates components with their children, and theirs, in one
+// transaction, so a generated page is stored completely or not at all. The IDs and
+// timestamps of every component are set, and the ParentID of every child.
+func (cs *UIComponentsStore) CreateComponents(ctx context.Context, components []UIComponent) (err error) {
+	ctx, span := cs.startSpan(ctx, "CreateComponents")
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := cs.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for i := range components {
+		if err = insertTree(ctx, tx, &components[i]); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit components: %w", err)
+	}
+	return nil
+}
+
+// insertTree inserts component, then its children under it.
+func insertTree(ctx context.Context, tx *sql.Tx, component *UIComponent) error {
+	if err := insertComponent(ctx, tx, component); err != nil {
+		return err
+	}
+	for i := range component.Children {
+		component.Children[i].ParentID = component.ID
+		if err := insertTree(ctx, tx, &component.Children[i]); err != nil {
+			return err
+		}
+	}
+	component.ChildCount = len(component.Children)
+	return nil
+}
+
+// GetChildren retrieves the non-archived children of a page or section in order
+func (cs *UIComponentsStore) GetChildren(ctx context.Context, parentID int) (_ []UIComponent, err error) {
+	ctx, span := cs.startSpan(ctx, "GetChildren")
+	defer func() { tracing.End(span, err) }()
+
+	sqlQuery := `
+		SELECT id, title, type, code, is_public, user_id, created_at, updated_at,
+			model_id, prompt_version, sketch_id, generation_prompt, COALESCE(generated_at, created_at),
+			layout, parent_id, position, template
+		FROM uicomponents
+		WHERE parent_id = $1 AND archived_at IS NULL
+		ORDER BY position, id`
+
+	rows, err := cs.db.QueryContext(ctx, sqlQuery, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query children: %w", err)
+	}
+	defer rows.Close()
+
+	var children []UIComponent
+	for rows.Next() {
+		var child UIComponent
+		var layoutJSON []byte
+		err := rows.Scan(
+			&child.ID, &child.Title, &child.Type, &child.Code, &child.IsPublic, &child.UserID,
+			&child.CreatedAt, &child.UpdatedAt, &child.ModelID, &child.PromptVersion, &child.SketchID,
+			&child.GenerationPrompt, &child.GeneratedAt, &layoutJSON, &child.ParentID, &child.Position, &child.Template,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan child row: %w", err)
+		}
+		if child.Layout, err = unmarshalLayout(layoutJSON); err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over child rows: %w", err)
+	}
+
+	return children, nil
+}
+
+// GetComponentTree retrieves a component with its children, and theirs, filled in
+func (cs *UIComponentsStore) GetComponentTree(ctx context.Context, id int) (*UIComponent, error) {
+	root, err := cs.GetComponentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := cs.loadChildren(ctx, root, 1); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+func (cs *UIComponentsStore) loadChildren(ctx context.Context, component *UIComponent, depth int) error {
+	// Hierarchies are at most page, section and component deep
+	if depth >= ai.MaxComponentDepth {
+		return nil
+	}
+
+	children, err := cs.GetChildren(ctx, component.ID)
+	if err != nil {
+		return err
+	}
+	for i := range children {
+		if err := cs.loadChildren(ctx, &children[i], depth+1); err != nil {
+			return err
+		}
+	}
+	component.Children = children
+	component.ChildCount = len(children)
+	return nil
+}
+
+// UpdateGeneration replaces the generated code, layout, sketch and provenance of a
+// component, and stamps generated_at
+func (cs *UIComponentsStore) UpdateGeneration(ctx context.Context, component *UIComponent) (err error) {
+	ctx, span := cs.startSpan(ctx, "UpdateGeneration")
+	defer func() { tracing.End(span, err) }()
+
+	layoutJSON, err := marshalLayout(component.Layout)
+	if err != nil {
+		return err
+	}
+
+	sqlQuery := `
+		UPDATE uicomponents
+		SET code = $1, layout = $2, model_id = $3, prompt_version = $4, sketch_id = $5, generation_prompt = $6,
+			updated_at = CURRENT_TIMESTAMP, generated_at = CURRENT_TIMESTAMP
+		WHERE id = $7 AND archived_at IS NULL
+		RETURNING updated_at, generated_at`
+
+	err = cs.db.QueryRowContext(ctx, sqlQuery, component.Code, layoutJSON, component.ModelID, component.PromptVersion,
+		component.SketchID, component.GenerationPrompt, component.ID).
+		Scan(&component.UpdatedAt, &component.GeneratedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("component with id %d not found or already archived", component.ID)
+		}
+		return fmt.Errorf("failed to update component generation: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package uicomponents
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"sketch-to-ui-final-proj/ai"
+)
+
+// GenerationOptionsRequest holds the advanced settings of the create and edit views.
+// Fields are kept as strings so that an empty input means "use the model default"
+// rather than zero.
+type GenerationOptionsRequest struct {
+	Temperature    string `form:"temperature" json:"temperature"`
+	MaxTokens      string `form:"max_tokens" json:"max_tokens"`
+	TopP           string `form:"top_p" json:"top_p"`
+	Seed           string `form:"seed" json:"seed"`
+	Stop           string `form:"stop" json:"stop"` // one stop sequence per line
+	ResponseFormat string `form:"response_format" json:"response_format"`
+}
+
+// CompletionOptions parses and validates the advanced settings.
+func (r GenerationOptionsRequest) CompletionOptions() (ai.CompletionOptions, error) {
+	var opts ai.CompletionOptions
+
+	if v := strings.TrimSpace(r.Temperature); v != "" {
+		temperature, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return ai.CompletionOptions{}, fmt.Errorf("temperature must be a number")
+		}
+		opts.Temperature = &temperature
+	}
+	if v := strings.TrimSpace(r.MaxTokens); v != "" {
+		maxTokens, err := strconv.Atoi(v)
+		if err != nil {
+			return ai.CompletionOptions{}, fmt.Errorf("max_tokens must be a whole number")
+		}
+		opts.MaxTokens = maxTokens
+	}
+	if v := strings.TrimSpace(r.TopP); v != "" {
+		topP, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return ai.CompletionOptions{}, fmt.Errorf("top_p must be a number")
+		}
+		opts.TopP = &topP
+	}
+	if v := strings.TrimSpace(r.Seed); v != "" {
+		seed, err := strconv.Atoi(v)
+		if err != nil {
+			return ai.CompletionOptions{}, fmt.Errorf("seed must be a whole number")
+		}
+		opts.Seed = &seed
+	}
+	for _, stop := range strings.Split(r.Stop, "\n") {
+		if stop = strings.TrimRight(stop, "\r"); stop != "" {
+			opts.Stop = append(opts.Stop, stop)
+		}
+	}
+	opts.ResponseFormat = r.ResponseFormat
+
+	if err := opts.Validate(); err != nil {
+		return ai.CompletionOptions{}, err
+	}
+	return opts, nil
+}
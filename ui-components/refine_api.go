@@ -0,0 +1,141 @@
+package uicomponents
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"sketch-to-ui-final-proj/ai"
+	"sketch-to-ui-final-proj/auth"
+	"sketch-to-ui-final-proj/sketch"
+	"sketch-to-ui-final-proj/utils/htmx"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AttachSketchRequest attaches a sketch to a component. Code is the current code in
+// the editor, which may have unsaved changes; the stored code is used when it is empty.
+type AttachSketchRequest struct {
+	SketchID   string `form:"sketch_id" binding:"required"`
+	UserPrompt string `form:"user_prompt" binding:"max=4000,omitempty"`
+	Code       string `form:"code"`
+}
+
+// AttachSketch handles POST requests that attach a sketch to a component, typically
+// one generated from a description, and refine its code to match the sketch. The
+// refined code and the sketch are saved, and the page is composed again.
+func (h *UIComponentHandler) AttachSketch(c *gin.Context) {
+	componentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid component ID"})
+		return
+	}
+
+	var req AttachSketchRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload", "details": err.Error()})
+		return
+	}
+
+	userID, exists := auth.GetUserIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized access"})
+		return
+	}
+
+	component, err := h.componentStore.GetComponentByID(c.Request.Context(), componentID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to get component", "component_id", componentID, "error", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Component not found"})
+		return
+	}
+
+	// SECURITY: Check if the user owns this component
+	if component.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to update this component"})
+		return
+	}
+
+	// A page or section only holds the markup around its parts
+	children, err := h.componentStore.GetChildren(c.Request.Context(), component.ID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to get child components", "component_id", componentID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load component"})
+		return
+	}
+	if len(children) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A sketch can only be attached to a single component, not a page or section"})
+		return
+	}
+
+	// SECURITY: Only sketches the user owns or that were shared with them can be attached
+	sketch, err := sketch.GetAccessibleSketch(c.Request.Context(), h.sketches, req.SketchID, userID)
+	if err != nil || sketch.ImageURL == "" {
+		slog.ErrorContext(c.Request.Context(), "Failed to get sketch", "sketch_id", req.SketchID, "error", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sketch not found"})
+		return
+	}
+
+	provider, charge, ok := h.userProvider(c, userID)
+	if !ok {
+		return
+	}
+
+	code := req.Code
+	if code == "" {
+		code = component.Code
+	}
+	settings := ai.GenerationSettings{ModelID: component.ModelID, PromptVersion: component.PromptVersion}
+	instructions := req.UserPrompt
+	if hints := sketch.LayoutHints(); hints != "" {
+		instructions = strings.TrimSpace(instructions + "\n\n" + hints)
+	}
+	refined, err := ai.RefineWithSketch(c.Request.Context(), instructions, code, sketch.DataURI(), provider, settings)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to refine component with sketch", "component_id", componentID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refine component"})
+		return
+	}
+	if refined.FailureResponse != "" || refined.Component.Code == "" {
+		failure := refined.FailureResponse
+		if failure == "" {
+			failure = "Failed to match the component to the sketch"
+		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": failure})
+		return
+	}
+
+	component.Code, _ = ai.RepairHTML(c.Request.Context(), refined.Component, provider, settings)
+	component.Layout = nil // The code no longer comes from a layout tree
+	component.SketchID = req.SketchID
+	component.GenerationPrompt = strings.TrimSpace(req.UserPrompt)
+	if err := h.componentStore.UpdateGeneration(c.Request.Context(), component); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to save refined component", "component_id", componentID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save component"})
+		return
+	}
+	chargeGeneration(c, charge, userID)
+
+	rootID, err := h.recomposeAncestors(c.Request.Context(), component)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to recompose parent component", "component_id", componentID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update the page"})
+		return
+	}
+
+	location := map[string]interface{}{
+		"path":   fmt.Sprintf("/components/%d/edit", rootID),
+		"target": "#content",
+	}
+	locationJSON, err := json.Marshal(location)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal HX-Location"})
+		return
+	}
+	htmx.TriggerToast(c, htmx.InfoLevel, "The Component Was Matched to Your Sketch")
+	c.Header("HX-Location", string(locationJSON))
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,29 @@
+package uicomponents
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttachSketch_SketchNotSharedIsNotFound(t *testing.T) {
+	store := newMemoryStore(UIComponent{ID: 1, UserID: 8, Title: "Login", Type: "Form", Code: "<form></form>"})
+	provider := &replyProvider{reply: `{"component":{"title":"Login","type":"Form","code":"<form>Matched</form>"}}`}
+	sketches := ownersSketch()
+	handler := newTestHandler(store, sketches, provider)
+
+	w := sendForm(newComponentRouter(handler, 8), http.MethodPost, "/components/1/sketch", url.Values{"sketch_id": {"sketch-1"}})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Zero(t, provider.requests)
+	assert.Empty(t, store.components[1].SketchID)
+
+	// Once shared, it is attached
+	sketches.sketches["sketch-1"].SharedWith = []string{"8"}
+	w = sendForm(newComponentRouter(handler, 8), http.MethodPost, "/components/1/sketch", url.Values{"sketch_id": {"sketch-1"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "sketch-1", store.components[1].SketchID)
+	assert.Equal(t, "<form>Matched</form>", store.components[1].Code)
+}